@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"SnapReport/internal/config"
+)
+
+// runDevicesStatus 实现 "SnapReport devices status"：直接请求配置的行车记录仪，
+// 检查能否建立会话和读取录像列表。设备不可用时返回 1。
+func runDevicesStatus(args []string) int {
+	fs := flag.NewFlagSet("devices status", flag.ContinueOnError)
+	configFlags(fs)
+	baseURL := fs.String("base-url", "", "设备地址，默认为配置中的 ddpai.base_url")
+	asJSON := fs.Bool("json", false, "输出 JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: SnapReport devices status [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *baseURL != "" {
+		cfg.DDPai.BaseURL = *baseURL
+	}
+	client := newDDPaiClient(cfg, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.DDPai.CaptureTimeoutSeconds)*time.Second)
+	defer cancel()
+	st := client.Status(ctx)
+
+	if *asJSON {
+		printJSON(st)
+	} else {
+		fmt.Printf("device:    %s\n", st.BaseURL)
+		fmt.Printf("reachable: %t (%d ms)\n", st.Reachable, st.LatencyMS)
+		if st.Reachable {
+			fmt.Printf("session:   %t\n", st.Session)
+			fmt.Printf("clips:     %d\n", st.Clips)
+			if st.Latest != "" {
+				fmt.Printf("latest:    %s\n", st.Latest)
+			}
+		}
+		if st.Error != "" {
+			fmt.Printf("error:     %s\n", st.Error)
+		}
+		if cfg.DDPai.MockMode {
+			fmt.Println("mock_mode is enabled: prepare falls back to mock clips when the device is unavailable")
+		}
+	}
+	if !st.Reachable || st.Error != "" {
+		return 1
+	}
+	return 0
+}
+
+// runConfigValidate 实现 "SnapReport config validate"：报告配置中的全部问题
+// 及其所在的文件行或环境变量，再按 serve 的方式构造服务，但不打开存储、
+// 不启动任何任务。配置有误时返回 1。
+func runConfigValidate(args []string) int {
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	configFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: SnapReport config validate")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := loadConfig()
+	if err == nil {
+		err = validateConfig(cfg)
+	}
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		for _, p := range invalid.Problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d problem(s)\n", configPath.path, len(invalid.Problems))
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configPath.path, err)
+		return 1
+	}
+	fmt.Printf("%s: ok\n", configPath.path)
+	return 0
+}
+
+// validateConfig 严格校验配置，然后像 serve 一样构造服务以发现其余问题
+func validateConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	svc, err := newService(cfg, nil)
+	if err != nil {
+		return err
+	}
+	_, _, err = newHandler(cfg, svc)
+	return err
+}
+
+// runMigrate 实现 "SnapReport migrate"：直接读写配置的报告存储，将旧版本保存的
+// 报告升级到当前格式。文件存储只在启动时加载，迁移前应先停止服务。
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	configFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "只列出将要执行的升级，不做修改")
+	asJSON := fs.Bool("json", false, "输出完整的 JSON 结果")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: SnapReport migrate [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := loadConfig()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if cfg.Store.Type == "memory" {
+		fmt.Fprintln(os.Stderr, "store.type is memory: there are no stored reports to migrate")
+		return 1
+	}
+	reports, err := openStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open report store: %v\n", err)
+		return 1
+	}
+	svc, err := newService(cfg, reports)
+	if err != nil {
+		closeStore(reports)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	res := svc.Migrate(context.Background(), *dryRun)
+	code := 0
+	if len(res.Errors) > 0 {
+		code = 1
+	}
+	// 升级后的报告须同步到磁盘才算完成
+	if err := closeStore(reports); err != nil {
+		fmt.Fprintf(os.Stderr, "flush report store: %v\n", err)
+		code = 1
+	}
+	if *asJSON {
+		printJSON(res)
+	} else {
+		for _, c := range res.Changed {
+			fmt.Printf("%s: %s\n", c.ReportID, strings.Join(c.Changes, ", "))
+		}
+		for _, e := range res.Errors {
+			fmt.Fprintf(os.Stderr, "error: %s\n", e)
+		}
+		verb := "upgraded"
+		if res.DryRun {
+			verb = "to upgrade"
+		}
+		fmt.Printf("%d reports scanned, %d %s, %d errors\n", res.Scanned, len(res.Changed), verb, len(res.Errors))
+	}
+	return code
+}
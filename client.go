@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// client 是客户端命令访问运行中服务的 HTTP 客户端
+type client struct {
+	server string
+	apiKey string
+}
+
+// clientFlags 在 fs 上注册 -server 和 -api-key 参数
+func clientFlags(fs *flag.FlagSet) *client {
+	c := &client{}
+	configFlags(fs)
+	fs.StringVar(&c.server, "server", "", "服务地址，默认为 http://localhost:<server.port>")
+	fs.StringVar(&c.apiKey, "api-key", os.Getenv("SNAPREPORT_API_KEY"), "API Key，默认读取 SNAPREPORT_API_KEY")
+	return c
+}
+
+// do 发送请求并返回响应，调用方负责关闭 Body。状态码不是 2xx 时返回
+// 包含服务端错误信息的错误。
+func (c *client) do(method, path string, q url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	if c.server == "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		c.server = fmt.Sprintf("http://localhost:%d", cfg.Server.Port)
+	}
+	u := strings.TrimSuffix(c.server, "/") + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(b, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, e.Error)
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+// call 以 JSON 发送 in（为 nil 时没有请求体），并将响应解码到 out
+func (c *client) call(method, path string, q url.Values, in, out any) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(b), "application/json"
+	}
+	resp, err := c.do(method, path, q, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// printJSON 将 v 以缩进的 JSON 写到标准输出
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"SnapReport/internal/job"
+	"SnapReport/internal/model"
+)
+
+// filterFlags 在 fs 上注册报告过滤参数，返回对应的查询参数
+func filterFlags(fs *flag.FlagSet) func() url.Values {
+	names := []struct{ name, usage string }{
+		{"org", "组织 ID，只对平台管理员生效"},
+		{"device", "设备 ID"},
+		{"status", "prepared 或 submitted"},
+		{"from", "起始时间（RFC3339，包含）"},
+		{"to", "结束时间（RFC3339，不包含）"},
+		{"plate", "号牌或号牌片段"},
+	}
+	params := map[string]string{"org": "org_id", "device": "device_id"}
+	values := make(map[string]*string, len(names))
+	for _, n := range names {
+		values[n.name] = fs.String(n.name, "", n.usage)
+	}
+	return func() url.Values {
+		q := url.Values{}
+		for name, v := range values {
+			if *v == "" {
+				continue
+			}
+			param := name
+			if p, ok := params[name]; ok {
+				param = p
+			}
+			q.Set(param, *v)
+		}
+		return q
+	}
+}
+
+// runPrepare 实现 "SnapReport prepare"：通过 POST /reports/prepare 创建报告。
+// -async 时创建异步任务并等待其完成。
+func runPrepare(args []string) int {
+	fs := flag.NewFlagSet("prepare", flag.ContinueOnError)
+	c := clientFlags(fs)
+	device := fs.String("device", "", "设备 ID（必填）")
+	lat := fs.Float64("lat", 0, "纬度")
+	lng := fs.Float64("lng", 0, "经度")
+	duration := fs.Int("duration", 20, "视频时长（秒）")
+	violation := fs.String("violation", "", "违法类型 ID、代码、名称或别名")
+	description := fs.String("description", "", "描述")
+	occurredAt := fs.String("occurred-at", "", "事件发生时间（RFC3339）")
+	plate := fs.String("plate", "", "违法车辆号牌")
+	tags := fs.String("tags", "", "逗号分隔的标签")
+	async := fs.Bool("async", false, "使用异步任务，下载视频后再创建报告")
+	timeout := fs.Duration("timeout", 5*time.Minute, "-async 时等待任务完成的最长时间，0 表示一直等待")
+	asJSON := fs.Bool("json", false, "输出完整的 JSON 结果")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: SnapReport prepare -device ID -lat LAT -lng LNG [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *device == "" || fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	body := map[string]any{
+		"device_id":      *device,
+		"lat":            *lat,
+		"lng":            *lng,
+		"duration_sec":   *duration,
+		"violation_type": *violation,
+		"description":    *description,
+		"occurred_at":    *occurredAt,
+	}
+	if *plate != "" {
+		body["vehicle"] = model.Vehicle{Plate: *plate}
+	}
+	if *tags != "" {
+		body["tags"] = strings.Split(*tags, ",")
+	}
+
+	var q url.Values
+	if *async {
+		q = url.Values{"async": {"true"}}
+	}
+	var res map[string]any
+	if err := c.call(http.MethodPost, "/reports/prepare", q, body, &res); err != nil {
+		fmt.Fprintf(os.Stderr, "prepare failed: %v\n", err)
+		return 1
+	}
+	if *async {
+		jobID, _ := res["job_id"].(string)
+		j, err := c.waitJob(jobID, *timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "job %s: %v\n", jobID, err)
+			return 1
+		}
+		if *asJSON {
+			printJSON(j)
+		} else {
+			fmt.Printf("%s\t%s\n", j.ReportID, j.Status)
+		}
+		if j.Status != job.StatusSucceeded {
+			fmt.Fprintf(os.Stderr, "job %s failed: %s\n", j.ID, j.Error)
+			return 1
+		}
+		return 0
+	}
+	if *asJSON {
+		printJSON(res)
+		return 0
+	}
+	fmt.Printf("%v\t%v\t%v %v\n", res["id"], res["status"], res["city"], res["road_name"])
+	if dup, _ := res["duplicate"].(bool); dup {
+		fmt.Println("duplicate of an existing report")
+	}
+	return 0
+}
+
+// waitJob 轮询异步任务直到成功或失败。timeout 大于 0 时最多等待 timeout，
+// 超时返回错误，任务仍在服务端继续执行。
+func (c *client) waitJob(id string, timeout time.Duration) (*job.Job, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		var j job.Job
+		if err := c.call(http.MethodGet, "/jobs/"+url.PathEscape(id), nil, nil, &j); err != nil {
+			return nil, err
+		}
+		if j.Status == job.StatusSucceeded || j.Status == job.StatusFailed {
+			return &j, nil
+		}
+		wait := time.Second
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return nil, fmt.Errorf("still %s after %s; check GET /jobs/%s later", j.Status, timeout, id)
+			}
+			wait = min(wait, left)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// runSend 实现 "SnapReport send ID..."：通过 POST /reports/send 提交报告
+func runSend(args []string) int {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	c := clientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: SnapReport send [flags] ID...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	code := 0
+	for _, id := range fs.Args() {
+		var res struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		}
+		if err := c.call(http.MethodPost, "/reports/send", nil, map[string]string{"id": id}, &res); err != nil {
+			fmt.Fprintf(os.Stderr, "send %s failed: %v\n", id, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s\t%s\n", res.ID, res.Status)
+	}
+	return code
+}
+
+// runList 实现 "SnapReport list"：通过 GET /reports 列出报告
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	c := clientFlags(fs)
+	filter := filterFlags(fs)
+	asJSON := fs.Bool("json", false, "输出完整的 JSON 结果")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: SnapReport list [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	var reports []model.Report
+	if err := c.call(http.MethodGet, "/reports", filter(), nil, &reports); err != nil {
+		fmt.Fprintf(os.Stderr, "list failed: %v\n", err)
+		return 1
+	}
+	if *asJSON {
+		printJSON(reports)
+		return 0
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tSTATUS\tDEVICE\tCITY\tROAD\tVIOLATION\tPLATE")
+	for _, r := range reports {
+		plate := ""
+		if r.Vehicle != nil {
+			plate = r.Vehicle.Plate
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.ID, r.Timestamp, r.Status, r.DeviceID, r.City, r.RoadName, r.ViolationType, plate)
+	}
+	tw.Flush()
+	return 0
+}
+
+// runExport 实现 "SnapReport export"：通过 GET /reports/export 下载导出文件
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	c := clientFlags(fs)
+	filter := filterFlags(fs)
+	format := fs.String("format", "csv", "csv、xlsx、geojson 或 kml")
+	output := fs.String("o", "", "输出文件，默认写到标准输出")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: SnapReport export [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	q := filter()
+	q.Set("format", *format)
+	resp, err := c.do(http.MethodGet, "/reports/export", q, nil, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if *output == "" {
+		_, err = io.Copy(os.Stdout, resp.Body)
+	} else {
+		var f *os.File
+		if f, err = os.Create(*output); err == nil {
+			_, err = io.Copy(f, resp.Body)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"SnapReport/internal/service"
+)
+
+// runImport 实现 "SnapReport import"：将 CSV 或 JSON Lines 文件提交到运行中的
+// 服务的 POST /reports/import，打印失败的行和汇总。有失败的行时返回 1。
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	c := clientFlags(fs)
+	format := fs.String("format", "", "csv 或 jsonl，默认根据扩展名判断")
+	geocode := fs.Bool("geocode", false, "对缺少城市或道路的行重新地理编码")
+	dryRun := fs.Bool("dry-run", false, "只校验，不保存")
+	asJSON := fs.Bool("json", false, "输出完整的 JSON 结果")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: SnapReport import [flags] FILE")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = "csv"
+		case ".jsonl", ".ndjson", ".json":
+			*format = "jsonl"
+		default:
+			fmt.Fprintf(os.Stderr, "cannot infer format of %s, use -format\n", path)
+			return 2
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+	q := url.Values{"format": {*format}}
+	if *geocode {
+		q.Set("geocode", "true")
+	}
+	if *dryRun {
+		q.Set("dry_run", "true")
+	}
+	resp, err := c.do(http.MethodPost, "/reports/import", q, f, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *asJSON {
+		os.Stdout.Write(body)
+	}
+
+	var res service.ImportResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid response: %v\n", err)
+		return 1
+	}
+	if !*asJSON {
+		for _, row := range res.Rows {
+			if row.Status == service.ImportFailed || row.Status == service.ImportSkipped {
+				fmt.Printf("line %d: %s: %s\n", row.Line, row.Status, row.Error)
+			}
+		}
+		verb := "created"
+		if res.DryRun {
+			verb = "valid"
+		}
+		fmt.Printf("%d rows: %d %s, %d skipped, %d failed\n", res.Total, res.Created, verb, res.Skipped, res.Failed)
+	}
+	if res.Failed > 0 {
+		return 1
+	}
+	return 0
+}
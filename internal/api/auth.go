@@ -0,0 +1,183 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"SnapReport/internal/auth"
+	"SnapReport/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKey 从 Authorization: Bearer <key> 或 X-API-Key 请求头中取出 API Key
+func apiKey(r *http.Request) string {
+	if v := r.Header.Get("Authorization"); strings.HasPrefix(v, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(v, "Bearer "))
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+func (h *Handler) authEnabled() bool {
+	return h.Auth != nil && h.Auth.Enabled
+}
+
+// authGin 认证请求并将用户放入 request context，服务层据此限定数据范围
+func (h *Handler) authGin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.authEnabled() {
+			c.Next()
+			return
+		}
+		u, ok := h.Auth.Authenticate(apiKey(c.Request))
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="snapreport"`)
+			c.AbortWithStatusJSON(401, gin.H{"error": "invalid or missing api key"})
+			return
+		}
+		c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), u))
+		c.Next()
+	}
+}
+
+// adminGin 要求调用方为管理员，须在 authGin 之后使用
+func (h *Handler) adminGin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.authEnabled() {
+			c.Next()
+			return
+		}
+		if u, ok := auth.UserFromContext(c.Request.Context()); !ok || !u.IsAdmin() {
+			c.AbortWithStatusJSON(403, gin.H{"error": "admin only"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// superAdminGin 要求调用方为平台管理员，须在 authGin 之后使用
+func (h *Handler) superAdminGin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.authEnabled() {
+			c.Next()
+			return
+		}
+		if u, ok := auth.UserFromContext(c.Request.Context()); !ok || !u.IsSuperAdmin() {
+			c.AbortWithStatusJSON(403, gin.H{"error": "superadmin only"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// scopeOrg 返回调用方被限定的组织，不受组织限制时返回空字符串
+func scopeOrg(c *gin.Context) string {
+	if orgID, restricted := auth.OrgFromContext(c.Request.Context()); restricted {
+		return orgID
+	}
+	return ""
+}
+
+func (h *Handler) authHTTP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.authEnabled() {
+			next(w, r)
+			return
+		}
+		u, ok := h.Auth.Authenticate(apiKey(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="snapreport"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid or missing api key"})
+			return
+		}
+		next(w, r.WithContext(auth.WithUser(r.Context(), u)))
+	}
+}
+
+func (h *Handler) meGin(c *gin.Context) {
+	u, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(200, gin.H{"auth_enabled": false})
+		return
+	}
+	c.JSON(200, u)
+}
+
+func (h *Handler) registerUserRoutes(router gin.IRoutes) {
+	router.GET("/users", h.listUsersGin)
+	router.POST("/users", h.createUserGin)
+	router.POST("/users/:id/devices", h.assignDeviceGin)
+}
+
+func (h *Handler) listUsersGin(c *gin.Context) {
+	c.JSON(200, h.Auth.Users(scopeOrg(c)))
+}
+
+// createUserGin 创建用户并返回 API Key，Key 不会再次显示
+func (h *Handler) createUserGin(c *gin.Context) {
+	var body struct {
+		OrgID   string   `json:"org_id"` // 仅平台管理员可指定，组织管理员只能在本组织创建用户
+		ID      string   `json:"id" binding:"required"`
+		Name    string   `json:"name"`
+		Role    string   `json:"role"`
+		Devices []string `json:"devices"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "invalid json"})
+		return
+	}
+	orgID := body.OrgID
+	if scoped := scopeOrg(c); scoped != "" {
+		orgID = scoped
+		if auth.Role(body.Role) == auth.RoleSuperAdmin {
+			c.JSON(403, gin.H{"error": "only superadmin can create superadmin"})
+			return
+		}
+	}
+	if orgID == "" {
+		orgID = tenant.DefaultOrg
+	}
+	if h.Tenants != nil {
+		if _, ok := h.Tenants.Get(orgID); !ok {
+			c.JSON(404, gin.H{"error": tenant.ErrOrgNotFound.Error()})
+			return
+		}
+	}
+	u, key, err := h.Auth.Create(orgID, body.ID, body.Name, auth.Role(body.Role), body.Devices)
+	if err != nil {
+		status := 400
+		if errors.Is(err, auth.ErrUserExists) || errors.Is(err, auth.ErrDeviceOwned) {
+			status = 409
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(201, gin.H{"user": u, "api_key": key})
+}
+
+func (h *Handler) assignDeviceGin(c *gin.Context) {
+	var body struct {
+		DeviceID string `json:"device_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "invalid json"})
+		return
+	}
+	if u, ok := h.Auth.User(c.Param("id")); !ok || (scopeOrg(c) != "" && u.OrgID != scopeOrg(c)) {
+		c.JSON(404, gin.H{"error": auth.ErrUserNotFound.Error()})
+		return
+	}
+	err := h.Auth.AssignDevice(c.Param("id"), body.DeviceID)
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrDeviceOwned):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+	default:
+		u, _ := h.Auth.User(c.Param("id"))
+		c.JSON(200, u)
+	}
+}
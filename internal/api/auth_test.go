@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"SnapReport/internal/auth"
+	"SnapReport/internal/ids"
+	"SnapReport/internal/model"
+	"SnapReport/internal/service"
+	"SnapReport/internal/tenant"
+	"SnapReport/internal/webhook"
+)
+
+// tenantFixture 是两个组织的测试数据：平台管理员 root，fleet-a 的管理员和
+// 只拥有 dev-a1 的普通用户，fleet-b 的管理员，每个组织各一份报告和一个订阅
+type tenantFixture struct {
+	h                           *Handler
+	root, adminA, userA, adminB string // API Key
+	reportA, reportA2, reportB  string
+	webhookB                    string
+}
+
+func newTenantFixture(t *testing.T) tenantFixture {
+	t.Helper()
+	h := newTestHandler(t)
+	h.Tenants = tenant.NewRegistry(nil)
+	for _, id := range []string{"fleet-a", "fleet-b"} {
+		if _, err := h.Tenants.Put(tenant.Org{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Auth = auth.NewRegistry(true)
+	h.Webhooks = webhook.NewDispatcher(1, time.Millisecond)
+	f := tenantFixture{h: h}
+	for _, u := range []struct {
+		key     *string
+		org, id string
+		role    auth.Role
+		devices []string
+	}{
+		{&f.root, tenant.DefaultOrg, "root", auth.RoleSuperAdmin, nil},
+		{&f.adminA, "fleet-a", "admin-a", auth.RoleAdmin, nil},
+		{&f.userA, "fleet-a", "user-a", auth.RoleUser, []string{"dev-a1"}},
+		{&f.adminB, "fleet-b", "admin-b", auth.RoleAdmin, nil},
+	} {
+		_, key, err := h.Auth.Create(u.org, u.id, "", u.role, u.devices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*u.key = key
+	}
+	for _, r := range []struct {
+		id          *string
+		org, device string
+	}{
+		{&f.reportA, "fleet-a", "dev-a1"},
+		{&f.reportA2, "fleet-a", "dev-a2"},
+		{&f.reportB, "fleet-b", "dev-b1"},
+	} {
+		*r.id = ids.New(service.ReportIDPrefix)
+		h.Service.Store.Save(model.Report{
+			ID: *r.id, OrgID: r.org, DeviceID: r.device, Status: "prepared",
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		})
+	}
+	sub, err := h.Webhooks.Create("fleet-b", "https://example.com/hook", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.webhookB = sub.ID
+	return f
+}
+
+func TestRoleGating(t *testing.T) {
+	f := newTenantFixture(t)
+	srv := router(f.h)
+	for _, c := range []struct {
+		name, method, path, key, body string
+		want                          int
+	}{
+		{"no key", "GET", "/reports", "", "", http.StatusUnauthorized},
+		{"bad key", "GET", "/reports", "sr_wrong", "", http.StatusUnauthorized},
+		{"user reads reports", "GET", "/reports", f.userA, "", http.StatusOK},
+		{"user lists users", "GET", "/users", f.userA, "", http.StatusForbidden},
+		{"user lists webhooks", "GET", "/webhooks", f.userA, "", http.StatusForbidden},
+		{"user sets legal hold", "PUT", "/reports/" + f.reportA + "/legal-hold", f.userA, `{"reason":"x"}`, http.StatusForbidden},
+		{"admin lists users", "GET", "/users", f.adminA, "", http.StatusOK},
+		{"admin lists orgs", "GET", "/orgs", f.adminA, "", http.StatusForbidden},
+		{"admin creates org", "POST", "/orgs", f.adminA, `{"id":"fleet-c"}`, http.StatusForbidden},
+		{"admin sweeps retention", "POST", "/retention/sweep", f.adminA, "", http.StatusForbidden},
+		{"admin creates superadmin", "POST", "/users", f.adminA, `{"id":"evil","role":"superadmin"}`, http.StatusForbidden},
+		{"superadmin lists orgs", "GET", "/orgs", f.root, "", http.StatusOK},
+		{"superadmin creates org", "POST", "/orgs", f.root, `{"id":"fleet-c"}`, http.StatusCreated},
+	} {
+		if rec := do(srv, c.method, c.path, c.key, c.body); rec.Code != c.want {
+			t.Errorf("%s: %s %s = %d %s, want %d", c.name, c.method, c.path, rec.Code, rec.Body, c.want)
+		}
+	}
+}
+
+func TestCrossOrgAccessIsNotFound(t *testing.T) {
+	f := newTenantFixture(t)
+	srv := router(f.h)
+	for _, c := range []struct {
+		name, method, path, key, body string
+	}{
+		{"admin patches other org's report", "PATCH", "/reports/" + f.reportB, f.adminA, `{"description":"x"}`},
+		{"admin holds other org's report", "PUT", "/reports/" + f.reportB + "/legal-hold", f.adminA, `{"reason":"x"}`},
+		{"admin assigns device to other org's user", "POST", "/users/admin-b/devices", f.adminA, `{"device_id":"dev-x"}`},
+		{"admin deletes other org's webhook", "DELETE", "/webhooks/" + f.webhookB, f.adminA, ""},
+		{"user patches unowned device's report", "PATCH", "/reports/" + f.reportA2, f.userA, `{"description":"x"}`},
+		{"user lists media of other org's report", "GET", "/reports/" + f.reportB + "/media", f.userA, ""},
+	} {
+		if rec := do(srv, c.method, c.path, c.key, c.body); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: %s %s = %d %s, want 404", c.name, c.method, c.path, rec.Code, rec.Body)
+		}
+	}
+	if got, _ := f.h.Service.Store.Get(f.reportB); got.Description != "" || got.LegalHold {
+		t.Fatalf("other org's report modified: %+v", got)
+	}
+	if _, ok := f.h.Auth.DeviceOwner("fleet-b", "dev-x"); ok {
+		t.Fatalf("device assigned across orgs")
+	}
+	if subs := f.h.Webhooks.Subscriptions("fleet-b"); len(subs) != 1 {
+		t.Fatalf("other org's webhook removed: %+v", subs)
+	}
+
+	// 列表只包含本组织、普通用户只包含自己设备的数据
+	for key, want := range map[string][]string{
+		f.adminA: {f.reportA, f.reportA2},
+		f.userA:  {f.reportA},
+		f.adminB: {f.reportB},
+		f.root:   {f.reportA, f.reportA2, f.reportB},
+	} {
+		rec := do(srv, "GET", "/reports", key, "")
+		var reports []model.Report
+		if err := json.Unmarshal(rec.Body.Bytes(), &reports); err != nil {
+			t.Fatalf("list: %v: %s", err, rec.Body)
+		}
+		var got []string
+		for _, r := range reports {
+			got = append(got, r.ID)
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("list = %v, want %v", got, want)
+		}
+	}
+	rec := do(srv, "GET", "/users", f.adminA, "")
+	if strings.Contains(rec.Body.String(), "admin-b") || !strings.Contains(rec.Body.String(), "user-a") {
+		t.Errorf("admin-a sees users %s", rec.Body)
+	}
+}
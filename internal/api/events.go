@@ -0,0 +1,90 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"SnapReport/internal/auth"
+	"SnapReport/internal/events"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// sseHeartbeat 是空闲时发送注释行的间隔，防止代理断开长连接
+const sseHeartbeat = 15 * time.Second
+
+// eventsGin 以 Server-Sent Events 推送报告和任务事件。
+// 支持 ?device_id= 过滤，以及通过 Last-Event-ID 请求头（或 ?last_event_id=）补发历史事件。
+func (h *Handler) eventsGin(c *gin.Context) {
+	if h.Service.Events == nil {
+		c.JSON(503, gin.H{"error": "event stream not enabled"})
+		return
+	}
+
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	var after int64
+	if lastID != "" {
+		n, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+		after = n
+	}
+
+	ctx := c.Request.Context()
+	byDevice := events.ForDevice(c.Query("device_id"))
+	filter := func(e events.Event) bool {
+		if byDevice != nil && !byDevice(e) {
+			return false
+		}
+		return auth.CanAccess(ctx, e.OrgID, e.DeviceID)
+	}
+	replay, ch, cancel := h.Service.Events.Subscribe(after, filter)
+	defer cancel()
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+
+	for _, e := range replay {
+		writeEvent(c, e)
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-h.streams:
+			// 服务正在关闭
+			return
+		case e, ok := <-ch:
+			if !ok {
+				// 订阅者跟不上被断开，客户端会带着 Last-Event-ID 重连
+				return
+			}
+			writeEvent(c, e)
+			c.Writer.Flush()
+		case <-ticker.C:
+			_, _ = c.Writer.WriteString(": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+func writeEvent(c *gin.Context, e events.Event) {
+	_ = sse.Encode(c.Writer, sse.Event{
+		Id:    strconv.FormatInt(e.ID, 10),
+		Event: e.Type,
+		Data:  e,
+	})
+}
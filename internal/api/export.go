@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"SnapReport/internal/export"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportReports 按列表查询的过滤条件导出报告，?format=csv|xlsx|geojson|kml，默认 csv。
+// 从存储逐条读取并写出到响应，不在内存中保留完整结果；写出过程中出错时只能中断响应。
+func (h *Handler) exportReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	f, err := parseFilter(q)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = export.CSV
+	}
+	if !slices.Contains(export.Formats, format) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": export.ErrUnknownFormat.Error()})
+		return
+	}
+	contentType, ext := export.ContentType(format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="reports-%s%s"`, time.Now().UTC().Format("20060102-150405"), ext))
+	ew, err := export.New(format, w)
+	if err != nil {
+		log.Printf("Export aborted: %v", err)
+		return
+	}
+
+	if err := h.Service.Each(r.Context(), f, ew.Write); err != nil {
+		log.Printf("Export aborted: %v", err)
+		return
+	}
+	if err := ew.Close(); err != nil {
+		log.Printf("Export aborted: %v", err)
+	}
+}
+
+func (h *Handler) exportReportsGin(c *gin.Context) {
+	h.exportReports(c.Writer, c.Request)
+}
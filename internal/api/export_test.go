@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"SnapReport/internal/model"
+)
+
+func TestExportStreamsFilteredReportsInOrder(t *testing.T) {
+	h := newTestHandler(t)
+	for _, r := range []model.Report{
+		{ID: "rep_c", DeviceID: "dev1", Timestamp: "2024-05-03T00:00:00Z", Status: "prepared"},
+		{ID: "rep_a", DeviceID: "dev1", Timestamp: "2024-05-01T00:00:00Z", Status: "prepared"},
+		{ID: "rep_x", DeviceID: "dev2", Timestamp: "2024-05-02T00:00:00Z", Status: "prepared"},
+		{ID: "rep_b", DeviceID: "dev1", Timestamp: "2024-05-02T00:00:00Z", Status: "prepared"},
+	} {
+		h.Service.Store.Save(r)
+	}
+
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	for name, srv := range map[string]http.Handler{"gin": router(h), "mux": mux} {
+		rec := do(srv, "GET", "/reports/export?format=csv&device_id=dev1", "", "")
+		if rec.Code != 200 {
+			t.Fatalf("%s: status %d: %s", name, rec.Code, rec.Body)
+		}
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		var got []string
+		for _, l := range lines[1:] {
+			got = append(got, strings.SplitN(l, ",", 2)[0])
+		}
+		if strings.Join(got, " ") != "rep_a rep_b rep_c" {
+			t.Fatalf("%s: exported %v", name, got)
+		}
+	}
+}
@@ -1,105 +1,329 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"SnapReport/internal/auth"
+	"SnapReport/internal/idempotency"
+	"SnapReport/internal/ids"
+	"SnapReport/internal/metrics"
+	"SnapReport/internal/model"
 	"SnapReport/internal/service"
+	"SnapReport/internal/store"
+	"SnapReport/internal/tenant"
+	"SnapReport/internal/vehicle"
+	"SnapReport/internal/violation"
+	"SnapReport/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
-	Service *service.ReportService
+	Service  *service.ReportService
+	Webhooks *webhook.Dispatcher // 为 nil 时不注册 /webhooks 路由
+	Auth     *auth.Registry      // 为 nil 或未启用时不做认证
+	Tenants  *tenant.Registry    // 为 nil 时不注册 /orgs 路由
+	// Idempotency 为 nil 时忽略 Idempotency-Key 请求头
+	Idempotency *idempotency.Cache
+	// Dashboard 是挂载在 /ui/ 下的网页控制台，为 nil 时不注册
+	Dashboard http.Handler
+	// Metrics 记录请求指标并在 /metrics 导出，为 nil 时不注册
+	Metrics *metrics.Metrics
+	// ReconcileGrace 是 POST /media/reconcile 未指定 grace_minutes 时的宽限期
+	ReconcileGrace time.Duration
+
+	draining    atomic.Bool
+	streams     chan struct{} // 关闭时结束所有事件流
+	streamsOnce sync.Once
 }
 
 func NewHandler(s *service.ReportService) *Handler {
-	return &Handler{Service: s}
+	return &Handler{Service: s, ReconcileGrace: service.DefaultReconcileGrace, streams: make(chan struct{})}
+}
+
+// Drain 使 /ready 返回 503，让负载均衡在关闭前摘除本实例，其他请求照常处理
+func (h *Handler) Drain() {
+	h.draining.Store(true)
+}
+
+// CloseStreams 结束所有事件流，客户端会带着 Last-Event-ID 重连。事件流是长连接，
+// 应在 http.Server.Shutdown 开始时调用，否则 Shutdown 会一直等到期限。
+func (h *Handler) CloseStreams() {
+	h.streamsOnce.Do(func() { close(h.streams) })
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/health", h.health)
-	mux.HandleFunc("/reports/prepare", h.prepare)
-	mux.HandleFunc("/reports/send", h.send)
-	mux.HandleFunc("/reports", h.list)
+	handle := func(pattern string, f http.HandlerFunc) {
+		mux.HandleFunc(pattern, h.metricsHTTP(pattern, f))
+	}
+	handle("/health", h.health)
+	handle("/ready", h.ready)
+	handle("/reports/prepare", h.authHTTP(h.idempotentHTTP(h.prepare)))
+	handle("/reports/send", h.authHTTP(h.idempotentHTTP(h.send)))
+	handle("/reports", h.authHTTP(h.list))
+	handle("/reports/export", h.authHTTP(h.exportReports))
+	handle("/reports/import", h.authHTTP(h.importReportsHTTP))
+	handle("/reports/", h.authHTTP(h.reportItem))
+	handle("/jobs/", h.authHTTP(h.getJob))
+	handle("/stats", h.authHTTP(h.statsHTTP))
+	handle("/violation-types", h.authHTTP(h.violationTypesHTTP))
+	if blobs := h.blobHandler(); blobs != nil {
+		handle("/blobs/", blobs.ServeHTTP)
+	}
+	if h.Dashboard != nil {
+		handle("/ui/", http.StripPrefix("/ui", h.Dashboard).ServeHTTP)
+	}
+	if h.Metrics != nil {
+		mux.Handle("/metrics", h.Metrics)
+	}
 }
 
 func (h *Handler) RegisterGinRoutes(router *gin.Engine) {
+	if h.Metrics != nil {
+		// 须在注册路由之前添加，抓取本身不计入请求指标
+		router.GET("/metrics", gin.WrapH(h.Metrics))
+		router.Use(h.metricsGin())
+	}
 	router.GET("/health", h.healthGin)
-	router.POST("/reports/prepare", h.prepareGin)
-	router.POST("/reports/send", h.sendGin)
-	router.GET("/reports", h.listGin)
+	router.GET("/ready", h.readyGin)
+	// 控制台页面是静态文件，数据接口仍需认证
+	if h.Dashboard != nil {
+		router.GET("/ui/*path", gin.WrapH(http.StripPrefix("/ui", h.Dashboard)))
+		router.GET("/", func(c *gin.Context) { c.Redirect(http.StatusFound, "/ui/") })
+	}
+	// 下载地址自带签名，不需要认证
+	if blobs := h.blobHandler(); blobs != nil {
+		router.GET("/blobs/*key", gin.WrapH(blobs))
+		router.HEAD("/blobs/*key", gin.WrapH(blobs))
+	}
+
+	authed := router.Group("/", h.authGin())
+	authed.POST("/reports/prepare", h.idempotentGin(), h.prepareGin)
+	authed.POST("/reports/send", h.idempotentGin(), h.sendGin)
+	authed.GET("/reports", h.listGin)
+	authed.GET("/reports/export", h.exportReportsGin)
+	authed.POST("/reports/import", h.importReportsGin)
+	authed.PATCH("/reports/:id", h.patchGin)
+	authed.POST("/reports/:id/media", h.uploadMediaGin)
+	authed.GET("/reports/:id/media", h.listMediaGin)
+	authed.GET("/jobs/:id", h.getJobGin)
+	authed.GET("/stats", h.statsGin)
+	authed.GET("/events", h.eventsGin)
+	authed.GET("/me", h.meGin)
+	authed.GET("/violation-types", h.violationTypesGin)
+
+	admin := authed.Group("/", h.adminGin())
+	if h.Webhooks != nil {
+		h.registerWebhookRoutes(admin)
+	}
+	if h.Auth != nil {
+		h.registerUserRoutes(admin)
+	}
+	h.registerLegalHoldRoutes(admin)
+	superAdmin := authed.Group("/", h.superAdminGin())
+	if h.Tenants != nil {
+		h.registerOrgRoutes(superAdmin)
+	}
+	if h.Service.Blobs != nil {
+		h.registerMediaAdminRoutes(superAdmin)
+	}
+	h.registerRetentionRoutes(superAdmin)
 }
 
 func (h *Handler) health(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// ready 是就绪检查，关闭过程中返回 503；/health 只表示进程存活
+func (h *Handler) ready(w http.ResponseWriter, _ *http.Request) {
+	if h.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
 func (h *Handler) prepare(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	var body struct {
-		DeviceID    string   `json:"device_id"`
-		Latitude    float64  `json:"lat"`
-		Longitude   float64  `json:"lng"`
-		DurationSec int      `json:"duration_sec"`
-		Tags        []string `json:"tags"`
-	}
+	var body prepareBody
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
 	}
-	if body.DurationSec <= 0 {
-		body.DurationSec = 20
-	}
 	if body.DeviceID == "" {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "device_id required"})
 		return
 	}
-
-	req := service.PrepareRequest{
-		DeviceID:    body.DeviceID,
-		Latitude:    body.Latitude,
-		Longitude:   body.Longitude,
-		DurationSec: body.DurationSec,
-		Tags:        body.Tags,
+	req := body.request()
+	if wantsAsync(r) {
+		j, err := h.Service.PrepareAsync(r.Context(), req)
+		if err != nil {
+			writeJSON(w, prepareErrorStatus(err), map[string]string{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+j.ID)
+		writeJSON(w, http.StatusAccepted, jobAccepted(j.ID))
+		return
+	}
+	report, err := h.Service.Prepare(r.Context(), req)
+	duplicate := false
+	var dup *service.DuplicateError
+	if errors.As(err, &dup) {
+		report, err, duplicate = &dup.Existing, nil, true
 	}
-	report, err := h.Service.Prepare(req)
 	if err != nil {
-		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		writeJSON(w, prepareErrorStatus(err), map[string]string{"error": err.Error()})
 		return
 	}
 
 	type response struct {
-		ID        string  `json:"id"`
-		Timestamp string  `json:"timestamp"`
-		Latitude  float64 `json:"lat"`
-		Longitude float64 `json:"lng"`
-		City      string  `json:"city"`
-		RoadName  string  `json:"road_name"`
-		IsHighway bool    `json:"is_highway"`
-		VideoURL  string  `json:"video_url"`
-		Status    string  `json:"status"`
-		DeviceID  string  `json:"device_id"`
-		Provider  string  `json:"provider"`
+		ID            string  `json:"id"`
+		Timestamp     string  `json:"timestamp"`
+		Latitude      float64 `json:"lat"`
+		Longitude     float64 `json:"lng"`
+		City          string  `json:"city"`
+		RoadName      string  `json:"road_name"`
+		IsHighway     bool    `json:"is_highway"`
+		VideoURL      string  `json:"video_url"`
+		Status        string  `json:"status"`
+		DeviceID      string  `json:"device_id"`
+		Provider      string  `json:"provider"`
+		ViolationType string  `json:"violation_type,omitempty"`
+		ViolationCode string  `json:"violation_code,omitempty"`
+
+		Vehicle *model.Vehicle `json:"vehicle,omitempty"`
+		// Duplicate 表示请求与已有报告重复，返回的是已有报告
+		Duplicate   bool   `json:"duplicate,omitempty"`
+		DuplicateOf string `json:"duplicate_of,omitempty"`
 	}
 	writeJSON(w, http.StatusOK, response{
-		ID:        report.ID,
-		Timestamp: report.Timestamp,
-		Latitude:  report.Latitude,
-		Longitude: report.Longitude,
-		City:      report.City,
-		RoadName:  report.RoadName,
-		IsHighway: report.IsHighway,
-		VideoURL:  report.VideoURL,
-		Status:    report.Status,
-		DeviceID:  report.DeviceID,
-		Provider:  report.Provider,
+		ID:            report.ID,
+		Timestamp:     report.Timestamp,
+		Latitude:      report.Latitude,
+		Longitude:     report.Longitude,
+		City:          report.City,
+		RoadName:      report.RoadName,
+		IsHighway:     report.IsHighway,
+		VideoURL:      report.VideoURL,
+		Status:        report.Status,
+		DeviceID:      report.DeviceID,
+		Provider:      report.Provider,
+		ViolationType: report.ViolationType,
+		ViolationCode: report.ViolationCode,
+		Vehicle:       report.Vehicle,
+		Duplicate:     duplicate,
+		DuplicateOf:   report.DuplicateOf,
 	})
 }
 
+// prepareBody 是 POST /reports/prepare 的请求体
+type prepareBody struct {
+	DeviceID      string   `json:"device_id" binding:"required"`
+	Latitude      float64  `json:"lat" binding:"required"`
+	Longitude     float64  `json:"lng" binding:"required"`
+	DurationSec   int      `json:"duration_sec"`
+	Tags          []string `json:"tags"`
+	ViolationType string   `json:"violation_type"`
+	Description   string   `json:"description"`
+	OccurredAt    string   `json:"occurred_at"`
+
+	Vehicle *model.Vehicle `json:"vehicle"`
+}
+
+// request 构造 PrepareRequest，occurred_at 等字段由服务层校验
+func (b prepareBody) request() service.PrepareRequest {
+	if b.DurationSec <= 0 {
+		b.DurationSec = 20
+	}
+	return service.PrepareRequest{
+		DeviceID:      b.DeviceID,
+		Latitude:      b.Latitude,
+		Longitude:     b.Longitude,
+		DurationSec:   b.DurationSec,
+		Tags:          b.Tags,
+		ViolationType: b.ViolationType,
+		Description:   b.Description,
+		OccurredAt:    b.OccurredAt,
+		Vehicle:       b.Vehicle,
+	}
+}
+
+// patchBody 是 PATCH /reports/:id 的请求体，省略的字段保持不变
+type patchBody struct {
+	ViolationType *string        `json:"violation_type"`
+	Description   *string        `json:"description"`
+	OccurredAt    *string        `json:"occurred_at"`
+	Tags          []string       `json:"tags"`
+	Vehicle       *model.Vehicle `json:"vehicle"`
+}
+
+func (b patchBody) patch() service.ReportPatch {
+	return service.ReportPatch{
+		ViolationType: b.ViolationType,
+		Description:   b.Description,
+		OccurredAt:    b.OccurredAt,
+		Tags:          b.Tags,
+		Vehicle:       b.Vehicle,
+	}
+}
+
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request) {
+	var body patchBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	p := body.patch()
+	id := strings.TrimPrefix(r.URL.Path, "/reports/")
+	if !ids.Valid(service.ReportIDPrefix, id) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid report id"})
+		return
+	}
+	report, err := h.Service.Update(r.Context(), id, p)
+	if err != nil {
+		writeJSON(w, updateErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func updateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrSave):
+		return http.StatusInternalServerError
+	case errors.Is(err, service.ErrReportNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrReportSubmitted):
+		return http.StatusConflict
+	case errors.Is(err, violation.ErrMissingEvidence):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrInvalidOccurredAt):
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// sendErrorStatus 报告不存在为 404，保存失败为 500
+func sendErrorStatus(err error) int {
+	if errors.Is(err, service.ErrReportNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
 func (h *Handler) send(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -112,9 +336,13 @@ func (h *Handler) send(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
 	}
-	report, err := h.Service.Send(body.ID)
+	if !ids.Valid(service.ReportIDPrefix, body.ID) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid report id"})
+		return
+	}
+	report, err := h.Service.Send(r.Context(), body.ID)
 	if err != nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		writeJSON(w, sendErrorStatus(err), map[string]string{"error": err.Error()})
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{
@@ -124,8 +352,92 @@ func (h *Handler) send(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *Handler) list(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, h.Service.List())
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.Service.List(r.Context(), f))
+}
+
+// parseFilter 解析报告列表的查询参数：org_id、device_id、status、from、to（RFC3339）、
+// plate（号牌或号牌片段）。org_id 只对平台管理员和未启用认证时生效。
+func parseFilter(q url.Values) (store.Filter, error) {
+	f := store.Filter{
+		OrgID:    q.Get("org_id"),
+		DeviceID: q.Get("device_id"),
+		Status:   q.Get("status"),
+		Plate:    vehicle.NormalizePlate(q.Get("plate")),
+	}
+	for _, p := range []struct {
+		name string
+		dst  *string
+	}{{"from", &f.From}, {"to", &f.To}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, fmt.Errorf("%s must be RFC3339", p.name)
+		}
+		*p.dst = t.UTC().Format(time.RFC3339)
+	}
+	return f, nil
+}
+
+func (h *Handler) getJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	j, ok := h.Service.Job(r.Context(), id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "job not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// wantsAsync 判断客户端是否请求异步准备：?async=true 或 Prefer: respond-async
+func wantsAsync(r *http.Request) bool {
+	if r.URL.Query().Get("async") == "true" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Prefer"), "respond-async")
+}
+
+func jobAccepted(id string) map[string]any {
+	return map[string]any{
+		"job_id":     id,
+		"status":     "queued",
+		"status_url": "/jobs/" + id,
+	}
+}
+
+// prepareErrorStatus 将 Prepare 的错误映射为 HTTP 状态码：设备不属于调用方为 403，
+// 未启用异步任务为 503，未知违法类型为 400，缺少证据为 422，阶段超时为 504，
+// 客户端断开为 499（nginx 约定），保存失败为 500，其余为 502。
+func prepareErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrSave):
+		return http.StatusInternalServerError
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrJobsDisabled):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, violation.ErrUnknownType),
+		errors.Is(err, service.ErrInvalidOccurredAt),
+		errors.Is(err, vehicle.ErrInvalidPlate),
+		errors.Is(err, vehicle.ErrInvalidField):
+		return http.StatusBadRequest
+	case errors.Is(err, violation.ErrMissingEvidence):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return 499
+	default:
+		return http.StatusBadGateway
+	}
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -138,50 +450,63 @@ func (h *Handler) healthGin(c *gin.Context) {
 	c.JSON(200, gin.H{"status": "ok"})
 }
 
-func (h *Handler) prepareGin(c *gin.Context) {
-	var body struct {
-		DeviceID    string   `json:"device_id" binding:"required"`
-		Latitude    float64  `json:"lat" binding:"required"`
-		Longitude   float64  `json:"lng" binding:"required"`
-		DurationSec int      `json:"duration_sec"`
-		Tags        []string `json:"tags"`
+func (h *Handler) readyGin(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
 	}
+	c.JSON(200, gin.H{"status": "ready"})
+}
+
+func (h *Handler) prepareGin(c *gin.Context) {
+	var body prepareBody
 
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(400, gin.H{"error": "invalid json"})
 		return
 	}
 
-	if body.DurationSec <= 0 {
-		body.DurationSec = 20
-	}
+	req := body.request()
 
-	req := service.PrepareRequest{
-		DeviceID:    body.DeviceID,
-		Latitude:    body.Latitude,
-		Longitude:   body.Longitude,
-		DurationSec: body.DurationSec,
-		Tags:        body.Tags,
+	if wantsAsync(c.Request) {
+		j, err := h.Service.PrepareAsync(c.Request.Context(), req)
+		if err != nil {
+			c.JSON(prepareErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Location", "/jobs/"+j.ID)
+		c.JSON(202, jobAccepted(j.ID))
+		return
 	}
 
-	report, err := h.Service.Prepare(req)
+	report, err := h.Service.Prepare(c.Request.Context(), req)
+	duplicate := false
+	var dup *service.DuplicateError
+	if errors.As(err, &dup) {
+		report, err, duplicate = &dup.Existing, nil, true
+	}
 	if err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
+		c.JSON(prepareErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(200, gin.H{
-		"id":         report.ID,
-		"timestamp":  report.Timestamp,
-		"lat":        report.Latitude,
-		"lng":        report.Longitude,
-		"city":       report.City,
-		"road_name":  report.RoadName,
-		"is_highway": report.IsHighway,
-		"video_url":  report.VideoURL,
-		"status":     report.Status,
-		"device_id":  report.DeviceID,
-		"provider":   report.Provider,
+		"id":             report.ID,
+		"timestamp":      report.Timestamp,
+		"lat":            report.Latitude,
+		"lng":            report.Longitude,
+		"city":           report.City,
+		"road_name":      report.RoadName,
+		"is_highway":     report.IsHighway,
+		"video_url":      report.VideoURL,
+		"status":         report.Status,
+		"device_id":      report.DeviceID,
+		"provider":       report.Provider,
+		"violation_type": report.ViolationType,
+		"violation_code": report.ViolationCode,
+		"vehicle":        report.Vehicle,
+		"duplicate":      duplicate,
+		"duplicate_of":   report.DuplicateOf,
 	})
 }
 
@@ -195,9 +520,13 @@ func (h *Handler) sendGin(c *gin.Context) {
 		return
 	}
 
-	report, err := h.Service.Send(body.ID)
+	if !ids.Valid(service.ReportIDPrefix, body.ID) {
+		c.JSON(400, gin.H{"error": "invalid report id"})
+		return
+	}
+	report, err := h.Service.Send(c.Request.Context(), body.ID)
 	if err != nil {
-		c.JSON(404, gin.H{"error": err.Error()})
+		c.JSON(sendErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -208,6 +537,59 @@ func (h *Handler) sendGin(c *gin.Context) {
 	})
 }
 
+func (h *Handler) patchGin(c *gin.Context) {
+	var body patchBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "invalid json"})
+		return
+	}
+	p := body.patch()
+	if !ids.Valid(service.ReportIDPrefix, c.Param("id")) {
+		c.JSON(400, gin.H{"error": "invalid report id"})
+		return
+	}
+	report, err := h.Service.Update(c.Request.Context(), c.Param("id"), p)
+	if err != nil {
+		c.JSON(updateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, report)
+}
+
 func (h *Handler) listGin(c *gin.Context) {
-	c.JSON(200, h.Service.List())
+	f, err := parseFilter(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, h.Service.List(c.Request.Context(), f))
+}
+
+func (h *Handler) getJobGin(c *gin.Context) {
+	j, ok := h.Service.Job(c.Request.Context(), c.Param("id"))
+	if !ok {
+		c.JSON(404, gin.H{"error": "job not found"})
+		return
+	}
+	c.JSON(200, j)
+}
+
+// violationTypes 返回可用的违法类型，未配置时为空列表
+func (h *Handler) violationTypes() []violation.Type {
+	if h.Service.Violations == nil {
+		return []violation.Type{}
+	}
+	return h.Service.Violations.Types()
+}
+
+func (h *Handler) violationTypesHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.violationTypes())
+}
+
+func (h *Handler) violationTypesGin(c *gin.Context) {
+	c.JSON(200, h.violationTypes())
 }
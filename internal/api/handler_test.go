@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"SnapReport/internal/blob"
+	"SnapReport/internal/ddpai"
+	"SnapReport/internal/service"
+	"SnapReport/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type stubGeocoder struct{}
+
+func (stubGeocoder) ReverseGeocode(context.Context, float64, float64) (string, string, string, error) {
+	return "深圳市", "滨河大道", "primary", nil
+}
+
+func (stubGeocoder) Provider() string { return "stub" }
+
+// newTestHandler 返回使用内存存储和模拟行车记录仪的处理器，路由在调用方
+// 设置好 Auth 等字段后通过 router 注册
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	svc := service.NewReportService(store.NewMemoryStore(), stubGeocoder{}, ddpai.NewClient("http://127.0.0.1:1", 1, true))
+	return NewHandler(svc)
+}
+
+func router(h *Handler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h.RegisterGinRoutes(r)
+	return r
+}
+
+// do 发送请求，key 非空时作为 API Key
+func do(h http.Handler, method, path, key, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRoutersShareValidation(t *testing.T) {
+	h := newTestHandler(t)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	for name, r := range map[string]http.Handler{"gin": router(h), "mux": mux} {
+		body := `{"device_id": "device_123", "lat": 22.5, "lng": 114.0, "occurred_at": "yesterday"}`
+		if rec := do(r, "POST", "/reports/prepare", "", body); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "RFC3339") {
+			t.Fatalf("%s: invalid occurred_at: %d %s", name, rec.Code, rec.Body)
+		}
+		if rec := do(r, "GET", "/violation-types", "", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":"running_red_light"`) {
+			t.Fatalf("%s: violation types: %d %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestReconcileUsesConfiguredGrace(t *testing.T) {
+	h := newTestHandler(t)
+	h.Service.Blobs = blob.NewFS(t.TempDir(), "", nil)
+	if err := h.Service.Blobs.Put(context.Background(), "reports/rep_orphan/a.jpg", strings.NewReader("x"), 1, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	r := router(h)
+	// 默认一小时的宽限期内，新对象不算孤立
+	if rec := do(r, "POST", "/media/reconcile", "", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"orphaned":[]`) {
+		t.Fatalf("default grace: %d %s", rec.Code, rec.Body)
+	}
+	h.ReconcileGrace = 0
+	if rec := do(r, "POST", "/media/reconcile", "", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "rep_orphan") {
+		t.Fatalf("configured grace ignored: %d %s", rec.Code, rec.Body)
+	}
+}
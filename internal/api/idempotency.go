@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"SnapReport/internal/auth"
+	"SnapReport/internal/idempotency"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	idempotentReplayed   = "Idempotent-Replayed"
+
+	// maxIdempotentBody 是带 Idempotency-Key 的请求体的大小上限，请求体需要
+	// 整个读入内存计算指纹
+	maxIdempotentBody = 1 << 20
+)
+
+// idempotencyBegin 登记带 Idempotency-Key 的请求。返回的 key 为空表示
+// 不需要幂等处理；replay 非 nil 时应直接重放；status 非零时应返回该错误。
+// key 按调用方和路径区分，不同用户使用相同的 key 互不影响。
+func (h *Handler) idempotencyBegin(r *http.Request) (key string, replay *idempotency.Response, status int, err error) {
+	raw := r.Header.Get(idempotencyKeyHeader)
+	if h.Idempotency == nil || raw == "" {
+		return "", nil, 0, nil
+	}
+	if len(raw) > 255 {
+		return "", nil, http.StatusBadRequest, errors.New("idempotency key too long")
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxIdempotentBody))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return "", nil, http.StatusRequestEntityTooLarge, errors.New("request body too large")
+	case err != nil:
+		return "", nil, http.StatusBadRequest, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	caller := ""
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		caller = u.OrgID + "/" + u.ID
+	}
+	key = caller + " " + r.Method + " " + r.URL.Path + " " + raw
+	// 查询参数和 Prefer 决定同步或异步处理，也算作请求内容
+	fp := idempotency.Fingerprint([]byte(r.URL.RawQuery), []byte(r.Header.Get("Prefer")), body)
+	replay, err = h.Idempotency.Begin(key, fp)
+	switch {
+	case errors.Is(err, idempotency.ErrInProgress):
+		return "", nil, http.StatusConflict, err
+	case errors.Is(err, idempotency.ErrMismatch):
+		return "", nil, http.StatusUnprocessableEntity, err
+	}
+	return key, replay, 0, nil
+}
+
+// idempotencyEnd 保存响应。5xx 和客户端取消的请求不保存，以便客户端重试。
+func (h *Handler) idempotencyEnd(key string, status int, header http.Header, body []byte) {
+	if status >= 500 || status == 499 {
+		h.Idempotency.Release(key)
+		return
+	}
+	saved := http.Header{}
+	for _, k := range []string{"Content-Type", "Location"} {
+		if v := header.Get(k); v != "" {
+			saved.Set(k, v)
+		}
+	}
+	h.Idempotency.Complete(key, idempotency.Response{Status: status, Header: saved, Body: body})
+}
+
+func writeReplay(w http.ResponseWriter, resp *idempotency.Response) {
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(idempotentReplayed, "true")
+	w.WriteHeader(resp.Status)
+	_, _ = w.Write(resp.Body)
+}
+
+// idempotentGin 为 POST 请求提供 Idempotency-Key 支持，须在 authGin 之后使用
+func (h *Handler) idempotentGin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, replay, status, err := h.idempotencyBegin(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		if replay != nil {
+			writeReplay(c.Writer, replay)
+			c.Abort()
+			return
+		}
+		if key == "" {
+			c.Next()
+			return
+		}
+		rec := &ginRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		defer func() {
+			if p := recover(); p != nil {
+				h.Idempotency.Release(key)
+				panic(p)
+			}
+		}()
+		c.Next()
+		h.idempotencyEnd(key, rec.Status(), rec.Header(), rec.body.Bytes())
+	}
+}
+
+func (h *Handler) idempotentHTTP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, replay, status, err := h.idempotencyBegin(r)
+		if err != nil {
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		if replay != nil {
+			writeReplay(w, replay)
+			return
+		}
+		if key == "" {
+			next(w, r)
+			return
+		}
+		rec := &httpRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if p := recover(); p != nil {
+				h.Idempotency.Release(key)
+				panic(p)
+			}
+		}()
+		next(rec, r)
+		h.idempotencyEnd(key, rec.status, rec.Header(), rec.body.Bytes())
+	}
+}
+
+// ginRecorder 在写出响应的同时保留一份响应体
+type ginRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *ginRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *ginRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+type httpRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *httpRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *httpRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"SnapReport/internal/idempotency"
+)
+
+func TestIdempotentBodyLimit(t *testing.T) {
+	h := newTestHandler(t)
+	h.Idempotency = idempotency.New(time.Hour)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	large := `{"device_id":"dev1","lat":22.5,"lng":113.9,"description":"` + strings.Repeat("x", maxIdempotentBody) + `"}`
+	small := `{"device_id":"dev1","lat":22.5,"lng":113.9}`
+	for name, srv := range map[string]http.Handler{"gin": router(h), "mux": mux} {
+		rec := do(srv, "POST", "/reports/prepare", "", large, idempotencyKeyHeader, name+"-large")
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: large body = %d %s", name, rec.Code, rec.Body)
+		}
+		first := do(srv, "POST", "/reports/prepare", "", small, idempotencyKeyHeader, name+"-small")
+		again := do(srv, "POST", "/reports/prepare", "", small, idempotencyKeyHeader, name+"-small")
+		if first.Code != http.StatusOK || again.Header().Get(idempotentReplayed) != "true" || again.Body.String() != first.Body.String() {
+			t.Errorf("%s: small body = %d %s, retry = %d %s", name, first.Code, first.Body, again.Code, again.Body)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"SnapReport/internal/importer"
+	"SnapReport/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportBytes 是导入文件的大小上限
+const maxImportBytes = 64 << 20
+
+// importFormats 将请求的 Content-Type 映射为导入格式
+var importFormats = map[string]string{
+	"text/csv":             importer.CSV,
+	"application/x-ndjson": importer.JSONL,
+	"application/jsonl":    importer.JSONL,
+	"application/json":     importer.JSONL,
+}
+
+// importReports 导入请求体中的 CSV 或 JSON Lines 文件。格式由 ?format= 或
+// Content-Type 决定；?geocode=true 补全缺少的城市和道路，?dry_run=true 只校验。
+// 部分行失败时仍返回 200，逐行结果在响应的 rows 中。
+func (h *Handler) importReports(r *http.Request) (int, any) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format = importFormats[ct]
+	}
+	opts := service.ImportOptions{
+		Geocode: r.URL.Query().Get("geocode") == "true",
+		DryRun:  r.URL.Query().Get("dry_run") == "true",
+	}
+	body := http.MaxBytesReader(nil, r.Body, maxImportBytes)
+	res, err := h.Service.Import(r.Context(), format, body, opts)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, importer.ErrUnknownFormat):
+		return http.StatusBadRequest, map[string]string{"error": err.Error()}
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge, map[string]any{"error": "import file too large", "result": res}
+	case err != nil:
+		return http.StatusBadRequest, map[string]any{"error": err.Error(), "result": res}
+	}
+	return http.StatusOK, res
+}
+
+func (h *Handler) importReportsHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	status, body := h.importReports(r)
+	writeJSON(w, status, body)
+}
+
+func (h *Handler) importReportsGin(c *gin.Context) {
+	status, body := h.importReports(c.Request)
+	c.JSON(status, body)
+}
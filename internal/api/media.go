@@ -0,0 +1,163 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"SnapReport/internal/ids"
+	"SnapReport/internal/model"
+	"SnapReport/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUploadFiles 是单个上传请求中允许的文件数
+const maxUploadFiles = 10
+
+// uploadMedia 逐个读取 multipart 请求中的文件并追加到报告，不将整个请求缓存
+// 到内存或临时文件。某个文件失败时，之前保存的文件仍然保留并在响应中列出。
+func (h *Handler) uploadMedia(r *http.Request, id string) (int, any) {
+	if !ids.Valid(service.ReportIDPrefix, id) {
+		return http.StatusBadRequest, map[string]string{"error": "invalid report id"}
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return http.StatusBadRequest, map[string]string{"error": "multipart/form-data required"}
+	}
+	attached := []model.Attachment{}
+	fail := func(status int, err error) (int, any) {
+		return status, map[string]any{"error": err.Error(), "attached": attached}
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(http.StatusBadRequest, err)
+		}
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		if len(attached) == maxUploadFiles {
+			part.Close()
+			return fail(http.StatusRequestEntityTooLarge, errors.New("too many files in one request"))
+		}
+		a, err := h.Service.Attach(r.Context(), id, service.Upload{Filename: part.FileName(), Body: part})
+		part.Close()
+		if err != nil {
+			return fail(mediaErrorStatus(err), err)
+		}
+		attached = append(attached, *a)
+	}
+	if len(attached) == 0 {
+		return http.StatusBadRequest, map[string]string{"error": "no files in request"}
+	}
+	return http.StatusCreated, attached
+}
+
+func mediaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrReportNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrReportSubmitted), errors.Is(err, service.ErrMediaPurged):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrUnsupportedMedia):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, service.ErrMediaTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrStorageDisabled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (h *Handler) uploadMediaGin(c *gin.Context) {
+	status, body := h.uploadMedia(c.Request, c.Param("id"))
+	c.JSON(status, body)
+}
+
+func (h *Handler) listMediaGin(c *gin.Context) {
+	list, err := h.Service.Attachments(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(mediaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, list)
+}
+
+// reportItem 分发 /reports/{id} 和 /reports/{id}/media
+func (h *Handler) reportItem(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/reports/")
+	id, sub, _ := strings.Cut(rest, "/")
+	switch {
+	case sub == "" && r.Method == http.MethodPatch:
+		h.patch(w, r)
+	case sub == "media" && r.Method == http.MethodPost:
+		status, body := h.uploadMedia(r, id)
+		writeJSON(w, status, body)
+	case sub == "media" && r.Method == http.MethodGet:
+		list, err := h.Service.Attachments(r.Context(), id)
+		if err != nil {
+			writeJSON(w, mediaErrorStatus(err), map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	case sub == "" || sub == "media":
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// blobHandler 返回本地媒体存储的下载路由。S3 等存储的下载地址直接指向
+// 存储服务，返回 nil。
+func (h *Handler) blobHandler() http.Handler {
+	fs, ok := h.Service.Blobs.(http.Handler)
+	if !ok {
+		return nil
+	}
+	return http.StripPrefix("/blobs", fs)
+}
+
+func (h *Handler) registerMediaAdminRoutes(router gin.IRoutes) {
+	router.GET("/media/reconcile", h.lastReconcileGin)
+	router.POST("/media/reconcile", h.reconcileGin)
+}
+
+func (h *Handler) lastReconcileGin(c *gin.Context) {
+	res, ok := h.Service.LastReconcile()
+	if !ok {
+		c.JSON(404, gin.H{"error": "no reconcile run yet"})
+		return
+	}
+	c.JSON(200, res)
+}
+
+// reconcileGin 立即执行一次对账，?delete_orphans=true 时删除孤立对象
+func (h *Handler) reconcileGin(c *gin.Context) {
+	opts := service.ReconcileOptions{
+		Grace:         h.ReconcileGrace,
+		DeleteOrphans: c.Query("delete_orphans") == "true",
+	}
+	if v := c.Query("grace_minutes"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(400, gin.H{"error": "invalid grace_minutes"})
+			return
+		}
+		opts.Grace = time.Duration(n) * time.Minute
+	}
+	res, err := h.Service.ReconcileNow(c.Request.Context(), opts)
+	if err != nil {
+		c.JSON(mediaErrorStatus(err), res)
+		return
+	}
+	c.JSON(200, res)
+}
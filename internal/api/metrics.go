@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsGin 按路由模板记录请求数和耗时，未匹配任何路由的请求记为 "unmatched"，
+// 避免任意路径造成过多的序列
+func (h *Handler) metricsGin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		h.Metrics.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// metricsHTTP 是 metricsGin 的 net/http 版本，pattern 是注册到 ServeMux 的模式
+func (h *Handler) metricsHTTP(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	if h.Metrics == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		h.Metrics.ObserveRequest(r.Method, pattern, rec.status, time.Since(start))
+	}
+}
+
+// statusRecorder 记录写出的状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+
+	"SnapReport/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) registerOrgRoutes(router gin.IRoutes) {
+	router.GET("/orgs", h.listOrgsGin)
+	router.POST("/orgs", h.createOrgGin)
+	router.GET("/orgs/:id", h.getOrgGin)
+}
+
+func (h *Handler) listOrgsGin(c *gin.Context) {
+	c.JSON(200, h.Tenants.List())
+}
+
+func (h *Handler) createOrgGin(c *gin.Context) {
+	var body struct {
+		ID       string `json:"id" binding:"required"`
+		Name     string `json:"name"`
+		Geocoder struct {
+			Type      string `json:"type"`
+			UserAgent string `json:"user_agent"`
+			APIKey    string `json:"api_key"`
+		} `json:"geocoder"`
+		Submitter tenant.SubmitterConfig `json:"submitter"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "invalid json"})
+		return
+	}
+	org, err := h.Tenants.Create(tenant.Org{
+		ID:   body.ID,
+		Name: body.Name,
+		Geocoder: tenant.GeocoderConfig{
+			Type:      body.Geocoder.Type,
+			UserAgent: body.Geocoder.UserAgent,
+			APIKey:    body.Geocoder.APIKey,
+		},
+		Submitter: body.Submitter,
+	})
+	switch {
+	case errors.Is(err, tenant.ErrOrgExists):
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, tenant.ErrInvalidOrgID), errors.Is(err, tenant.ErrInvalidGeocoder):
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(201, org)
+}
+
+func (h *Handler) getOrgGin(c *gin.Context) {
+	org, ok := h.Tenants.Get(c.Param("id"))
+	if !ok {
+		c.JSON(404, gin.H{"error": tenant.ErrOrgNotFound.Error()})
+		return
+	}
+	c.JSON(200, org)
+}
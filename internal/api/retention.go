@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+
+	"SnapReport/internal/audit"
+	"SnapReport/internal/ids"
+	"SnapReport/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerLegalHoldRoutes 注册组织管理员可用的法律保全和审计日志路由
+func (h *Handler) registerLegalHoldRoutes(router gin.IRoutes) {
+	router.PUT("/reports/:id/legal-hold", h.setLegalHoldGin)
+	router.DELETE("/reports/:id/legal-hold", h.clearLegalHoldGin)
+	router.GET("/audit", h.auditGin)
+}
+
+// registerRetentionRoutes 注册平台管理员手动清理的路由，清理跨越所有组织
+func (h *Handler) registerRetentionRoutes(router gin.IRoutes) {
+	router.POST("/retention/sweep", h.sweepGin)
+}
+
+func (h *Handler) setLegalHoldGin(c *gin.Context) {
+	var body struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "reason required"})
+		return
+	}
+	h.legalHold(c, true, body.Reason)
+}
+
+func (h *Handler) clearLegalHoldGin(c *gin.Context) {
+	h.legalHold(c, false, "")
+}
+
+func (h *Handler) legalHold(c *gin.Context, hold bool, reason string) {
+	id := c.Param("id")
+	if !ids.Valid(service.ReportIDPrefix, id) {
+		c.JSON(400, gin.H{"error": "invalid report id"})
+		return
+	}
+	report, err := h.Service.SetLegalHold(c.Request.Context(), id, hold, reason)
+	switch {
+	case errors.Is(err, service.ErrReportNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+	default:
+		c.JSON(200, report)
+	}
+}
+
+func (h *Handler) auditGin(c *gin.Context) {
+	c.JSON(200, h.Service.AuditLog(c.Request.Context(), audit.Filter{
+		OrgID:    c.Query("org_id"),
+		ReportID: c.Query("report_id"),
+		Action:   c.Query("action"),
+	}))
+}
+
+// sweepGin 立即按保留策略清理，?dry_run=true 时只返回将要清理的报告
+func (h *Handler) sweepGin(c *gin.Context) {
+	c.JSON(200, h.Service.Sweep(c.Request.Context(), c.Query("dry_run") == "true"))
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"SnapReport/internal/geo"
+	"SnapReport/internal/stats"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stats 按列表查询的过滤条件汇总报告。另外支持 precision（热点 geohash 长度，
+// 1-12）、top（返回的热点数，-1 表示全部）和 tz（按天、按周分组的 IANA 时区）。
+func (h *Handler) stats(r *http.Request) (int, any) {
+	q := r.URL.Query()
+	f, err := parseFilter(q)
+	if err != nil {
+		return http.StatusBadRequest, map[string]string{"error": err.Error()}
+	}
+	opts, err := parseStatsOptions(q)
+	if err != nil {
+		return http.StatusBadRequest, map[string]string{"error": err.Error()}
+	}
+	return http.StatusOK, h.Service.Stats(r.Context(), f, opts)
+}
+
+func parseStatsOptions(q url.Values) (stats.Options, error) {
+	var opts stats.Options
+	if v := q.Get("precision"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > geo.MaxGeohashPrecision {
+			return opts, errors.New("precision must be between 1 and 12")
+		}
+		opts.Precision = n
+	}
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < -1 || n == 0 {
+			return opts, errors.New("top must be a positive number or -1")
+		}
+		opts.Top = n
+	}
+	if v := q.Get("tz"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return opts, errors.New("unknown tz")
+		}
+		opts.Location = loc
+	}
+	return opts, nil
+}
+
+func (h *Handler) statsHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	status, body := h.stats(r)
+	writeJSON(w, status, body)
+}
+
+func (h *Handler) statsGin(c *gin.Context) {
+	status, body := h.stats(c.Request)
+	c.JSON(status, body)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+
+	"SnapReport/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) registerWebhookRoutes(router gin.IRoutes) {
+	router.GET("/webhooks", h.listWebhooksGin)
+	router.POST("/webhooks", h.createWebhookGin)
+	router.DELETE("/webhooks/:id", h.deleteWebhookGin)
+	router.GET("/webhooks/:id/deliveries", h.webhookDeliveriesGin)
+	router.GET("/webhooks/deliveries", h.allDeliveriesGin)
+	router.POST("/webhooks/deliveries/:id/retry", h.retryDeliveryGin)
+}
+
+func (h *Handler) listWebhooksGin(c *gin.Context) {
+	c.JSON(200, h.Webhooks.Subscriptions(scopeOrg(c)))
+}
+
+func (h *Handler) createWebhookGin(c *gin.Context) {
+	var body struct {
+		OrgID  string   `json:"org_id"` // 仅平台管理员可指定，为空表示平台级订阅
+		URL    string   `json:"url" binding:"required"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"` // 为空时生成
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "invalid json"})
+		return
+	}
+	orgID := body.OrgID
+	if scoped := scopeOrg(c); scoped != "" {
+		orgID = scoped
+	}
+	sub, err := h.Webhooks.Create(orgID, body.URL, body.Events, body.Secret)
+	switch {
+	case errors.Is(err, webhook.ErrInvalidURL), errors.Is(err, webhook.ErrInvalidEvent), errors.Is(err, webhook.ErrPrivateAddress):
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	// 密钥只在创建时返回一次
+	c.JSON(201, gin.H{"subscription": sub, "secret": sub.Secret})
+}
+
+func (h *Handler) deleteWebhookGin(c *gin.Context) {
+	err := h.Webhooks.Remove(scopeOrg(c), c.Param("id"))
+	switch {
+	case errors.Is(err, webhook.ErrNotFound):
+		c.JSON(404, gin.H{"error": "webhook not found"})
+	case errors.Is(err, webhook.ErrConfigured):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+	default:
+		c.Status(204)
+	}
+}
+
+func (h *Handler) webhookDeliveriesGin(c *gin.Context) {
+	c.JSON(200, h.Webhooks.Deliveries(scopeOrg(c), c.Param("id"), webhook.DeliveryStatus(c.Query("status"))))
+}
+
+// allDeliveriesGin 列出所有订阅的投递记录，?status=dead 即死信列表
+func (h *Handler) allDeliveriesGin(c *gin.Context) {
+	c.JSON(200, h.Webhooks.Deliveries(scopeOrg(c), "", webhook.DeliveryStatus(c.Query("status"))))
+}
+
+func (h *Handler) retryDeliveryGin(c *gin.Context) {
+	err := h.Webhooks.Retry(scopeOrg(c), c.Param("id"))
+	switch {
+	case errors.Is(err, webhook.ErrNotFound):
+		c.JSON(404, gin.H{"error": "delivery not found"})
+	case errors.Is(err, webhook.ErrNotDead):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+	default:
+		c.JSON(202, gin.H{"id": c.Param("id"), "status": webhook.DeliveryPending})
+	}
+}
@@ -0,0 +1,133 @@
+// Package audit 记录删除数据、法律保全等需要事后追查的操作。
+// 记录只追加，不能修改或删除。
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"SnapReport/internal/ids"
+)
+
+// 审计操作
+const (
+	ActionReportDeleted  = "report.deleted"      // 按保留策略删除整份报告
+	ActionMediaPurged    = "report.media_purged" // 删除视频和照片，只保留报告元数据
+	ActionLegalHoldSet   = "report.legal_hold_set"
+	ActionLegalHoldClear = "report.legal_hold_cleared"
+)
+
+type Entry struct {
+	ID       string   `json:"id"`
+	Time     string   `json:"time"`
+	Actor    string   `json:"actor"` // 用户 ID，后台任务为 "system:<名称>"
+	Action   string   `json:"action"`
+	OrgID    string   `json:"org_id"`
+	ReportID string   `json:"report_id,omitempty"`
+	Rule     string   `json:"rule,omitempty"`   // 触发删除的保留规则
+	Keys     []string `json:"keys,omitempty"`   // 删除的媒体对象
+	Reason   string   `json:"reason,omitempty"` // 例如法律保全的原因
+}
+
+// Filter 是审计记录的查询条件，零值字段不参与过滤
+type Filter struct {
+	OrgID    string
+	ReportID string
+	Action   string
+}
+
+func (f Filter) match(e Entry) bool {
+	return (f.OrgID == "" || e.OrgID == f.OrgID) &&
+		(f.ReportID == "" || e.ReportID == f.ReportID) &&
+		(f.Action == "" || e.Action == f.Action)
+}
+
+// Log 是只追加的审计日志。指定文件时每条记录以 JSON 行追加写入并同步到磁盘，
+// 打开时读回已有记录。
+type Log struct {
+	mu      sync.Mutex
+	entries []Entry
+	f       *os.File
+}
+
+// NewMemory 返回不持久化的审计日志，用于测试和未配置文件时
+func NewMemory() *Log {
+	return &Log{}
+}
+
+// Open 打开或创建 path 处的审计日志
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{f: f}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("audit: %s line %d: %w", path, line, err)
+		}
+		l.entries = append(l.entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record 追加一条记录，自动填写 ID 和时间。写入文件失败时返回错误，
+// 调用方应当放弃对应的操作。
+func (l *Log) Record(e Entry) (Entry, error) {
+	e.ID = ids.New("aud_")
+	if e.Time == "" {
+		e.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return e, err
+		}
+		if _, err := l.f.Write(append(b, '\n')); err != nil {
+			return e, err
+		}
+		if err := l.f.Sync(); err != nil {
+			return e, err
+		}
+	}
+	l.entries = append(l.entries, e)
+	return e, nil
+}
+
+// List 按记录顺序返回满足条件的记录
+func (l *Log) List(f Filter) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := []Entry{}
+	for _, e := range l.entries {
+		if f.match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (l *Log) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
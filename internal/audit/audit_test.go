@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogPersistsAndFilters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := l.Record(Entry{Actor: "system:retention", Action: ActionReportDeleted, OrgID: "default", ReportID: "rep_1", Rule: "drafts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == "" || first.Time == "" {
+		t.Fatalf("id and time not filled: %+v", first)
+	}
+	if _, err := l.Record(Entry{Actor: "alice", Action: ActionLegalHoldSet, OrgID: "fleet-a", ReportID: "rep_2", Reason: "court order"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if all := l.List(Filter{}); len(all) != 2 || all[0].ID != first.ID {
+		t.Fatalf("reopened log = %+v", all)
+	}
+	if got := l.List(Filter{OrgID: "fleet-a"}); len(got) != 1 || got[0].Reason != "court order" {
+		t.Fatalf("org filter = %+v", got)
+	}
+	if got := l.List(Filter{Action: ActionMediaPurged}); len(got) != 0 {
+		t.Fatalf("action filter = %+v", got)
+	}
+}
+
+func TestOpenRejectsCorruptLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	os.WriteFile(path, []byte("{\"id\":\"aud_1\"}\nnot json\n"), 0o600)
+	if _, err := Open(path); err == nil {
+		t.Fatal("expected error for corrupt line")
+	}
+}
@@ -0,0 +1,397 @@
+// Package auth 管理 API 用户、API Key 和设备归属。API Key 只以 SHA-256 哈希形式保存。
+// 用户和设备都属于某个组织，设备 ID 只需在组织内唯一。
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"SnapReport/internal/statefile"
+	"SnapReport/internal/tenant"
+)
+
+type Role string
+
+const (
+	// RoleSuperAdmin 是平台管理员，可以管理组织并访问所有组织的数据
+	RoleSuperAdmin Role = "superadmin"
+	// RoleAdmin 是组织管理员，可以访问本组织的全部数据
+	RoleAdmin Role = "admin"
+	RoleUser  Role = "user"
+)
+
+// KeyPrefix 是生成的 API Key 的前缀，便于在日志和代码仓库中识别泄露的密钥
+const KeyPrefix = "sr_"
+
+type User struct {
+	ID      string   `json:"id"`
+	OrgID   string   `json:"org_id"`
+	Name    string   `json:"name"`
+	Role    Role     `json:"role"`
+	Devices []string `json:"devices"`
+	KeyHash string   `json:"-"`
+}
+
+// IsAdmin 报告用户是否为组织管理员或平台管理员
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin || u.Role == RoleSuperAdmin
+}
+
+func (u *User) IsSuperAdmin() bool {
+	return u.Role == RoleSuperAdmin
+}
+
+// CanAccess 报告用户是否可以访问某组织中某设备的数据：平台管理员可访问全部，
+// 组织管理员可访问本组织全部设备，普通用户只能访问本组织中自己的设备。
+func (u *User) CanAccess(orgID, deviceID string) bool {
+	if u.IsSuperAdmin() {
+		return true
+	}
+	if orgID != u.OrgID {
+		return false
+	}
+	return u.OwnsDevice(deviceID)
+}
+
+// OwnsDevice 报告用户是否拥有本组织中的该设备，管理员视为拥有全部设备
+func (u *User) OwnsDevice(deviceID string) bool {
+	if u.IsAdmin() {
+		return true
+	}
+	for _, d := range u.Devices {
+		if d == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrUserExists    = errors.New("user already exists")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrDeviceOwned   = errors.New("device already owned by another user")
+	ErrInvalidRole   = errors.New("role must be superadmin, admin or user")
+	ErrInvalidUserID = errors.New("user id required")
+)
+
+// HashKey 返回 API Key 的 SHA-256 十六进制哈希
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateKey 生成一个新的随机 API Key
+func GenerateKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return KeyPrefix + hex.EncodeToString(b), nil
+}
+
+// Registry 保存用户和设备归属。Enabled 为 false 时 API 不做认证。
+// 用户 ID 全局唯一，设备按 (组织, 设备 ID) 登记。
+type Registry struct {
+	Enabled bool
+
+	mu     sync.RWMutex
+	users  map[string]*User
+	owners map[deviceKey]string // -> user ID
+
+	// path 为空时运行时的修改只保存在内存中，见 Persist
+	path     string
+	created  map[string]bool     // 通过 Create 添加的用户
+	assigned map[string][]string // 通过 AssignDevice 分配给配置中用户的设备
+}
+
+type deviceKey struct {
+	org, device string
+}
+
+func NewRegistry(enabled bool) *Registry {
+	return &Registry{
+		Enabled:  enabled,
+		users:    make(map[string]*User),
+		owners:   make(map[deviceKey]string),
+		created:  make(map[string]bool),
+		assigned: make(map[string][]string),
+	}
+}
+
+// Add 添加一个用户，u.KeyHash 为 HashKey 的结果，u.OrgID 为空时属于 tenant.DefaultOrg。
+// 用于配置文件中的用户，不写入 Persist 的文件。
+func (r *Registry) Add(u User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.add(u)
+	return err
+}
+
+// add 校验并添加用户，调用方持有 r.mu
+func (r *Registry) add(u User) (*User, error) {
+	if u.ID == "" {
+		return nil, ErrInvalidUserID
+	}
+	if u.OrgID == "" {
+		u.OrgID = tenant.DefaultOrg
+	}
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+	if u.Role != RoleSuperAdmin && u.Role != RoleAdmin && u.Role != RoleUser {
+		return nil, ErrInvalidRole
+	}
+	if _, ok := r.users[u.ID]; ok {
+		return nil, ErrUserExists
+	}
+	for _, d := range u.Devices {
+		if owner, ok := r.owners[deviceKey{u.OrgID, d}]; ok && owner != u.ID {
+			return nil, fmt.Errorf("%w: %s", ErrDeviceOwned, d)
+		}
+	}
+	u.Devices = append([]string(nil), u.Devices...)
+	u.KeyHash = strings.ToLower(u.KeyHash)
+	r.users[u.ID] = &u
+	for _, d := range u.Devices {
+		r.owners[deviceKey{u.OrgID, d}] = u.ID
+	}
+	return &u, nil
+}
+
+// remove 撤销 add，调用方持有 r.mu
+func (r *Registry) remove(u *User) {
+	delete(r.users, u.ID)
+	for _, d := range u.Devices {
+		delete(r.owners, deviceKey{u.OrgID, d})
+	}
+}
+
+// Create 在组织中添加一个用户并生成 API Key，明文 Key 只在此处返回一次。
+// 调用过 Persist 时用户写入文件，写入失败时不添加用户。
+func (r *Registry) Create(orgID, id, name string, role Role, devices []string) (User, string, error) {
+	key, err := GenerateKey()
+	if err != nil {
+		return User{}, "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, err := r.add(User{ID: id, OrgID: orgID, Name: name, Role: role, Devices: devices, KeyHash: HashKey(key)})
+	if err != nil {
+		return User{}, "", err
+	}
+	r.created[u.ID] = true
+	if err := r.save(); err != nil {
+		r.remove(u)
+		delete(r.created, u.ID)
+		return User{}, "", err
+	}
+	c := *u
+	c.Devices = append([]string(nil), u.Devices...)
+	return c, key, nil
+}
+
+// AssignDevice 将用户所在组织中的设备归属给该用户
+func (r *Registry) AssignDevice(userID, deviceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	key := deviceKey{u.OrgID, deviceID}
+	if owner, ok := r.owners[key]; ok {
+		if owner == userID {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrDeviceOwned, deviceID)
+	}
+	u.Devices = append(u.Devices, deviceID)
+	r.owners[key] = userID
+	if !r.created[userID] {
+		r.assigned[userID] = append(r.assigned[userID], deviceID)
+	}
+	if err := r.save(); err != nil {
+		u.Devices = u.Devices[:len(u.Devices)-1]
+		delete(r.owners, key)
+		if a := r.assigned[userID]; len(a) > 0 && !r.created[userID] {
+			r.assigned[userID] = a[:len(a)-1]
+		}
+		return err
+	}
+	return nil
+}
+
+// savedState 是 Persist 文件的内容
+type savedState struct {
+	Users   []savedUser         `json:"users"`
+	Devices map[string][]string `json:"devices,omitempty"` // 分配给配置中用户的设备
+}
+
+type savedUser struct {
+	User
+	KeyHash string `json:"api_key_sha256"`
+}
+
+// Persist 加载 path 中运行时创建的用户和设备归属，之后 Create 和 AssignDevice
+// 的结果写入该文件。文件只保存 API Key 的哈希。须在添加配置中的用户之后
+// 调用；与配置冲突的记录被跳过，以配置为准。
+func (r *Registry) Persist(path string) error {
+	var st savedState
+	if err := statefile.Load(path, &st); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, su := range st.Users {
+		su.User.KeyHash = su.KeyHash
+		if _, err := r.add(su.User); err != nil {
+			log.Printf("auth: skipping saved user %q: %v", su.ID, err)
+			continue
+		}
+		r.created[su.ID] = true
+	}
+	for id, devices := range st.Devices {
+		u, ok := r.users[id]
+		if !ok || r.created[id] {
+			log.Printf("auth: skipping saved devices of user %q: not a configured user", id)
+			continue
+		}
+		for _, d := range devices {
+			key := deviceKey{u.OrgID, d}
+			if owner, ok := r.owners[key]; ok {
+				if owner != id {
+					log.Printf("auth: skipping saved device %q of user %q: %v", d, id, ErrDeviceOwned)
+				}
+				continue
+			}
+			u.Devices = append(u.Devices, d)
+			r.owners[key] = id
+			r.assigned[id] = append(r.assigned[id], d)
+		}
+	}
+	r.path = path
+	return nil
+}
+
+// save 写入 Persist 的文件，调用方持有 r.mu
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	st := savedState{Users: []savedUser{}, Devices: r.assigned}
+	for id := range r.created {
+		u := r.users[id]
+		st.Users = append(st.Users, savedUser{User: *u, KeyHash: u.KeyHash})
+	}
+	sort.Slice(st.Users, func(a, b int) bool { return st.Users[a].ID < st.Users[b].ID })
+	return statefile.Save(r.path, st)
+}
+
+// Authenticate 根据 API Key 查找用户
+func (r *Registry) Authenticate(key string) (*User, bool) {
+	if key == "" {
+		return nil, false
+	}
+	h := HashKey(key)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, u := range r.users {
+		if subtle.ConstantTimeCompare([]byte(u.KeyHash), []byte(h)) == 1 {
+			c := *u
+			c.Devices = append([]string(nil), u.Devices...)
+			return &c, true
+		}
+	}
+	return nil, false
+}
+
+func (r *Registry) User(id string) (User, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[id]
+	if !ok {
+		return User{}, false
+	}
+	c := *u
+	c.Devices = append([]string(nil), u.Devices...)
+	return c, true
+}
+
+// Users 返回组织中的用户，orgID 为空时返回全部用户
+func (r *Registry) Users(orgID string) []User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]User, 0, len(r.users))
+	for _, u := range r.users {
+		if orgID != "" && u.OrgID != orgID {
+			continue
+		}
+		c := *u
+		c.Devices = append([]string(nil), u.Devices...)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out
+}
+
+// HasDevice 报告设备是否在任一组织中归属某个用户
+func (r *Registry) HasDevice(deviceID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for k := range r.owners {
+		if k.device == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceOwner 返回组织中设备所属的用户 ID
+func (r *Registry) DeviceOwner(orgID, deviceID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.owners[deviceKey{orgID, deviceID}]
+	return id, ok
+}
+
+type contextKey struct{}
+
+// WithUser 将认证后的用户放入 context
+func WithUser(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+// UserFromContext 取出认证后的用户。没有用户表示调用方是服务内部
+// （后台任务、命令行工具）或认证未启用，此时不做数据范围限制。
+func UserFromContext(ctx context.Context) (*User, bool) {
+	u, ok := ctx.Value(contextKey{}).(*User)
+	return u, ok && u != nil
+}
+
+// CanAccess 报告 ctx 中的调用方是否可以访问某组织中某设备的数据
+func CanAccess(ctx context.Context, orgID, deviceID string) bool {
+	u, ok := UserFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return u.CanAccess(orgID, deviceID)
+}
+
+// OrgFromContext 返回调用方所在的组织。ok 为 false 表示调用方不受组织限制
+// （服务内部调用或平台管理员），此时 orgID 为 tenant.DefaultOrg。
+func OrgFromContext(ctx context.Context) (orgID string, ok bool) {
+	u, found := UserFromContext(ctx)
+	if !found || u.IsSuperAdmin() {
+		return tenant.DefaultOrg, false
+	}
+	return u.OrgID, true
+}
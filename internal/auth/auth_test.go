@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"SnapReport/internal/tenant"
+)
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	r := NewRegistry(true)
+	u, key, err := r.Create("", "alice", "Alice", RoleUser, []string{"dev-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.KeyHash != HashKey(key) {
+		t.Fatalf("stored hash does not match key")
+	}
+	got, ok := r.Authenticate(key)
+	if !ok || got.ID != "alice" || !got.OwnsDevice("dev-a") || got.OwnsDevice("dev-b") {
+		t.Fatalf("unexpected user %+v", got)
+	}
+	if _, ok := r.Authenticate(key + "x"); ok {
+		t.Fatalf("authenticated with wrong key")
+	}
+	if _, ok := r.Authenticate(""); ok {
+		t.Fatalf("authenticated with empty key")
+	}
+}
+
+func TestDeviceOwnershipIsExclusive(t *testing.T) {
+	r := NewRegistry(true)
+	if _, _, err := r.Create("", "alice", "", RoleUser, []string{"dev-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Create("", "bob", "", RoleUser, []string{"dev-a"}); !errors.Is(err, ErrDeviceOwned) {
+		t.Fatalf("expected ErrDeviceOwned, got %v", err)
+	}
+	if _, _, err := r.Create("", "bob", "", RoleUser, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AssignDevice("bob", "dev-a"); !errors.Is(err, ErrDeviceOwned) {
+		t.Fatalf("expected ErrDeviceOwned, got %v", err)
+	}
+	if err := r.AssignDevice("bob", "dev-b"); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := r.DeviceOwner(tenant.DefaultOrg, "dev-b"); owner != "bob" {
+		t.Fatalf("dev-b owner %q", owner)
+	}
+}
+
+func TestAccessIsScopedToOrg(t *testing.T) {
+	admin := &User{ID: "a", OrgID: "fleet-a", Role: RoleAdmin}
+	user := &User{ID: "u", OrgID: "fleet-a", Role: RoleUser, Devices: []string{"dev1"}}
+	root := &User{ID: "root", OrgID: tenant.DefaultOrg, Role: RoleSuperAdmin}
+
+	if !admin.CanAccess("fleet-a", "anything") || admin.CanAccess("fleet-b", "anything") {
+		t.Fatalf("org admin should access every device in its own org only")
+	}
+	if !user.CanAccess("fleet-a", "dev1") || user.CanAccess("fleet-a", "dev2") || user.CanAccess("fleet-b", "dev1") {
+		t.Fatalf("user should access only its own devices in its own org")
+	}
+	if !root.CanAccess("fleet-b", "dev9") {
+		t.Fatalf("superadmin should access every org")
+	}
+}
+
+func TestSameDeviceIDInDifferentOrgs(t *testing.T) {
+	r := NewRegistry(true)
+	if _, _, err := r.Create("fleet-a", "alice", "", RoleUser, []string{"device_123"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Create("fleet-b", "bob", "", RoleUser, []string{"device_123"}); err != nil {
+		t.Fatalf("device ids should be unique per org only: %v", err)
+	}
+	if owner, _ := r.DeviceOwner("fleet-b", "device_123"); owner != "bob" {
+		t.Fatalf("fleet-b device_123 owner %q", owner)
+	}
+}
+
+func TestPersistRuntimeUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	open := func() *Registry {
+		r := NewRegistry(true)
+		if err := r.Add(User{ID: "ops", Role: RoleAdmin, KeyHash: HashKey("ops-key")}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Persist(path); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r := open()
+	_, key, err := r.Create("fleet-a", "alice", "Alice", RoleUser, []string{"dev-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AssignDevice("alice", "dev-b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AssignDevice("ops", "dev-c"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), key) || strings.Contains(string(b), HashKey("ops-key")) {
+		t.Fatalf("saved file contains the key or a configured user:\n%s", b)
+	}
+
+	r = open()
+	u, ok := r.Authenticate(key)
+	if !ok || u.OrgID != "fleet-a" || !u.OwnsDevice("dev-a") || !u.OwnsDevice("dev-b") {
+		t.Fatalf("user not restored: %+v", u)
+	}
+	if owner, _ := r.DeviceOwner(tenant.DefaultOrg, "dev-c"); owner != "ops" {
+		t.Fatalf("device assigned to configured user not restored")
+	}
+	if len(r.Users("")) != 2 {
+		t.Fatalf("users = %+v", r.Users(""))
+	}
+}
@@ -0,0 +1,55 @@
+// Package blob 定义媒体文件的存储接口，提供本地文件系统和 S3 兼容存储两种实现。
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Info 描述一个已保存的对象
+type Info struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Store 按 key 保存对象。key 使用 "/" 分隔，例如 "reports/rep_.../clip.mp4"。
+type Store interface {
+	// Put 保存 size 字节的 r，已存在的对象会被覆盖
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// List 按 key 顺序返回以 prefix 开头的对象
+	List(ctx context.Context, prefix string) ([]Info, error)
+	// URL 返回 expires 内有效的下载地址，持有地址即可下载，无需其它凭据
+	URL(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// ValidKey 检查 key 是否为安全的相对路径：非空，不以 "/" 开头，不含 ".."
+// 路径段、反斜杠或控制字符
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") || len(key) > 1024 {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	for _, r := range key {
+		if r < 0x20 || r == 0x7f || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
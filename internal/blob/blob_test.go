@@ -0,0 +1,171 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SnapReport/internal/blob/s3test"
+)
+
+func newS3(t *testing.T) (*S3, *s3test.Server) {
+	t.Helper()
+	srv := s3test.NewServer("media")
+	t.Cleanup(srv.Close)
+	s, err := NewS3(S3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "media",
+		AccessKeyID:     s3test.AccessKeyID,
+		SecretAccessKey: s3test.SecretAccessKey,
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	return s, srv
+}
+
+func newFS(t *testing.T) *FS {
+	t.Helper()
+	s := NewFS(t.TempDir(), "", nil)
+	srv := httptest.NewServer(http.StripPrefix("/blobs", s))
+	t.Cleanup(srv.Close)
+	s.BaseURL = srv.URL
+	return s
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"fs": func(t *testing.T) Store { return newFS(t) },
+		"s3": func(t *testing.T) Store { s, _ := newS3(t); return s },
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			ctx := context.Background()
+			put := func(key, data string) {
+				t.Helper()
+				if err := s.Put(ctx, key, strings.NewReader(data), int64(len(data)), "video/mp4"); err != nil {
+					t.Fatalf("put %s: %v", key, err)
+				}
+			}
+			put("reports/rep_1/clip.mp4", "clip data")
+			put("reports/rep_1/att 1.jpg", "photo")
+			put("reports/rep_2/clip.mp4", "other")
+			put("reports/rep_3/empty.jpg", "")
+
+			rc, err := s.Get(ctx, "reports/rep_1/clip.mp4")
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			if string(b) != "clip data" {
+				t.Fatalf("get = %q", b)
+			}
+			if info, err := s.Stat(ctx, "reports/rep_1/clip.mp4"); err != nil || info.Size != 9 || info.ModTime.IsZero() {
+				t.Fatalf("stat = %+v, %v", info, err)
+			}
+
+			list, err := s.List(ctx, "reports/rep_1/")
+			if err != nil || len(list) != 2 || list[0].Key != "reports/rep_1/att 1.jpg" || list[1].Key != "reports/rep_1/clip.mp4" {
+				t.Fatalf("list = %+v, %v", list, err)
+			}
+			if all, _ := s.List(ctx, ""); len(all) != 4 {
+				t.Fatalf("list all returned %d objects", len(all))
+			}
+
+			// 下载地址无需其它凭据
+			u, err := s.URL(ctx, "reports/rep_1/att 1.jpg", time.Minute)
+			if err != nil {
+				t.Fatalf("url: %v", err)
+			}
+			resp, err := http.Get(u)
+			if err != nil {
+				t.Fatalf("download: %v", err)
+			}
+			b, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != 200 || string(b) != "photo" {
+				t.Fatalf("download = %d %q", resp.StatusCode, b)
+			}
+
+			if err := s.Delete(ctx, "reports/rep_1/clip.mp4"); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if err := s.Delete(ctx, "reports/rep_1/clip.mp4"); err != nil {
+				t.Fatalf("delete missing: %v", err)
+			}
+			if _, err := s.Get(ctx, "reports/rep_1/clip.mp4"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("get deleted = %v", err)
+			}
+			if _, err := s.Stat(ctx, "reports/rep_1/clip.mp4"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("stat deleted = %v", err)
+			}
+
+			for _, bad := range []string{"", "/abs", "a/../b", "a//b", "a\\b", "dir/"} {
+				if err := s.Put(ctx, bad, bytes.NewReader(nil), 0, ""); !errors.Is(err, ErrInvalidKey) {
+					t.Fatalf("put %q = %v", bad, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFSURLExpiresAndIsBoundToKey(t *testing.T) {
+	s := newFS(t)
+	ctx := context.Background()
+	s.Put(ctx, "a.jpg", strings.NewReader("a"), 1, "")
+	s.Put(ctx, "b.jpg", strings.NewReader("b"), 1, "")
+
+	u, _ := s.URL(ctx, "a.jpg", time.Minute)
+	for name, target := range map[string]string{
+		"other key": strings.Replace(u, "/a.jpg", "/b.jpg", 1),
+		"tampered":  strings.Replace(u, "expires=", "expires=9", 1),
+	} {
+		resp, err := http.Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("%s: status %d", name, resp.StatusCode)
+		}
+	}
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expired link: status %d", resp.StatusCode)
+	}
+}
+
+func TestS3ListPagesAndRejectsBadCredentials(t *testing.T) {
+	s, srv := newS3(t)
+	srv.PageSize = 2
+	ctx := context.Background()
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		if err := s.Put(ctx, "p/"+k, strings.NewReader(k), 1, ""); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+	list, err := s.List(ctx, "p/")
+	if err != nil || len(list) != 5 || list[4].Key != "p/e" {
+		t.Fatalf("list = %+v, %v", list, err)
+	}
+
+	s.cfg.SecretAccessKey = "wrong"
+	if err := s.Put(ctx, "p/f", strings.NewReader("f"), 1, ""); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+}
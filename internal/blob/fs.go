@@ -0,0 +1,205 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// partSuffix 是写入中的临时文件后缀，List 会跳过这些文件
+const partSuffix = ".part"
+
+// FS 将对象保存为本地目录下的文件。下载地址指向本服务的 /blobs/ 路由，
+// 使用 HMAC 签名和过期时间保护，FS 本身实现了该路由的 http.Handler。
+type FS struct {
+	Dir string
+	// BaseURL 是下载地址的前缀，如 "https://reports.example.com"；为空时返回相对地址
+	BaseURL string
+
+	secret []byte
+	now    func() time.Time
+}
+
+// NewFS 返回以 dir 为根目录的存储。secret 为空时生成随机密钥，重启后
+// 之前签发的下载地址失效。
+func NewFS(dir, baseURL string, secret []byte) *FS {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic("blob: crypto/rand unavailable: " + err.Error())
+		}
+	}
+	return &FS{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/"), secret: secret, now: time.Now}
+}
+
+func (s *FS) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+func (s *FS) Put(ctx context.Context, key string, r io.Reader, size int64, _ string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp := p + partSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("blob: wrote %d bytes, expected %d", n, size)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *FS) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *FS) Stat(_ context.Context, key string) (Info, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Key: key, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (s *FS) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FS) List(ctx context.Context, prefix string) ([]Info, error) {
+	var out []Info
+	err := filepath.WalkDir(s.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, partSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, Info{Key: key, Size: fi.Size(), ModTime: fi.ModTime()})
+		return nil
+	})
+	sort.Slice(out, func(a, b int) bool { return out[a].Key < out[b].Key })
+	return out, err
+}
+
+// URL 返回 BaseURL/blobs/<key>?expires=<unix>&sig=<hmac>
+func (s *FS) URL(_ context.Context, key string, expires time.Duration) (string, error) {
+	if !ValidKey(key) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	exp := strconv.FormatInt(s.now().Add(expires).Unix(), 10)
+	q := url.Values{"expires": {exp}, "sig": {s.sign(key, exp)}}
+	return s.BaseURL + "/blobs/" + (&url.URL{Path: key}).EscapedPath() + "?" + q.Encode(), nil
+}
+
+func (s *FS) sign(key, expires string) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// ServeHTTP 提供 URL 签发的下载地址，r.URL.Path 为去掉 "/blobs" 前缀后的 "/<key>"
+func (s *FS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	exp := r.URL.Query().Get("expires")
+	sig := r.URL.Query().Get("sig")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(s.sign(key, exp))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	if s.now().Unix() > unix {
+		http.Error(w, "link expired", http.StatusForbidden)
+		return
+	}
+	p, err := s.path(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, filepath.Base(p), fi.ModTime(), f)
+}
@@ -0,0 +1,240 @@
+package blob
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"SnapReport/internal/blob/sigv4"
+)
+
+// S3Config 是 S3 兼容存储的连接参数
+type S3Config struct {
+	Endpoint        string // 如 "https://s3.ap-east-1.amazonaws.com" 或 "http://minio:9000"
+	Region          string // 默认为 "us-east-1"，MinIO 通常使用该值
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle 使用 endpoint/bucket/key 形式的地址，MinIO 需要；为 false 时
+	// 使用 bucket.endpoint/key 的虚拟主机形式
+	PathStyle bool
+}
+
+// S3 使用 S3 REST API 和 Signature V4 保存对象，兼容 AWS S3、MinIO 等服务
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	Client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("blob: invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("blob: s3 bucket required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &S3{cfg: cfg, endpoint: u, Client: &http.Client{}, now: time.Now}, nil
+}
+
+func (s *S3) creds() sigv4.Credentials {
+	return sigv4.Credentials{AccessKeyID: s.cfg.AccessKeyID, SecretAccessKey: s.cfg.SecretAccessKey}
+}
+
+// objectURL 返回对象的地址，key 为空时返回 bucket 的地址
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	return &u
+}
+
+func (s *S3) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		// 长度为 0 时必须使用 NoBody，否则会以 chunked 方式发送，S3 不接受
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	payload := sigv4.EmptyPayload
+	if body != nil {
+		payload = sigv4.UnsignedPayload
+	}
+	sigv4.Sign(req, s.creds(), s.cfg.Region, "s3", payload, s.now())
+	return s.Client.Do(req)
+}
+
+// s3Error 是 S3 返回的错误响应
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func responseError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	var e s3Error
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("s3: %s: %s (status %d)", e.Code, e.Message, resp.StatusCode)
+	}
+	return fmt.Errorf("s3: unexpected status %d", resp.StatusCode)
+}
+
+// Put 上传对象。S3 要求预先知道长度，size 必须准确。
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	if size < 0 {
+		return errors.New("blob: s3 upload requires the object size")
+	}
+	h := http.Header{}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(key), io.NopCloser(r), size, h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !ValidKey(key) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Info, error) {
+	if !ValidKey(key) {
+		return Info{}, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(key), nil, 0, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return Info{}, responseError(resp)
+	}
+	info := Info{Key: key, Size: resp.ContentLength}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(key), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// listResult 是 ListObjectsV2 的响应
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List 使用 ListObjectsV2 分页读取所有以 prefix 开头的对象
+func (s *S3) List(ctx context.Context, prefix string) ([]Info, error) {
+	var out []Info
+	token := ""
+	for {
+		u := s.objectURL("")
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+		resp, err := s.do(ctx, http.MethodGet, u, nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode/100 != 2 {
+			err := responseError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: decode list: %w", err)
+		}
+		for _, c := range page.Contents {
+			out = append(out, Info{Key: c.Key, Size: c.Size, ModTime: c.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return out, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// URL 返回预签名的 GET 地址。SigV4 预签名地址最长有效 7 天。
+func (s *S3) URL(_ context.Context, key string, expires time.Duration) (string, error) {
+	if !ValidKey(key) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	if expires > 7*24*time.Hour {
+		expires = 7 * 24 * time.Hour
+	}
+	return sigv4.Presign(http.MethodGet, s.objectURL(key), s.creds(), s.cfg.Region, "s3", s.now(), expires), nil
+}
+
+// String 用于日志，不包含密钥
+func (s *S3) String() string {
+	return "s3://" + s.cfg.Bucket + " at " + s.endpoint.String() + " (path style " + strconv.FormatBool(s.cfg.PathStyle) + ")"
+}
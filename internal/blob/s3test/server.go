@@ -0,0 +1,190 @@
+// Package s3test 提供内存中的 S3 兼容服务，支持测试 blob.S3 所需的对象
+// 读写、ListObjectsV2 分页和 Signature V4 校验（含预签名地址）。
+package s3test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"SnapReport/internal/blob/sigv4"
+)
+
+// 测试用的访问密钥
+const (
+	AccessKeyID     = "s3test-access-key"
+	SecretAccessKey = "s3test-secret-key"
+	Region          = "us-east-1"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// Server 是只有一个 bucket 的路径形式（endpoint/bucket/key）S3 服务
+type Server struct {
+	*httptest.Server
+	Bucket string
+	// PageSize 是 ListObjectsV2 每页返回的对象数，默认为 1000
+	PageSize int
+
+	mu      sync.Mutex
+	objects map[string]object
+	now     func() time.Time
+}
+
+func NewServer(bucket string) *Server {
+	s := &Server{Bucket: bucket, PageSize: 1000, objects: map[string]object{}, now: time.Now}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// SetModTime 修改对象的最后修改时间，用于测试按时间判断的逻辑
+func (s *Server) SetModTime(key string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o, ok := s.objects[key]; ok {
+		o.modTime = t
+		s.objects[key] = o
+	}
+}
+
+// Keys 返回所有对象的 key
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := sigv4.Verify(r, func(id string) (string, bool) {
+		return SecretAccessKey, id == AccessKeyID
+	}, s.now())
+	if err != nil {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "bucket "+bucket+" does not exist")
+		return
+	}
+	if key == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			s.list(w, r)
+			return
+		}
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "unsupported bucket operation")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			writeError(w, http.StatusLengthRequired, "MissingContentLength", "content length required")
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		s.mu.Lock()
+		s.objects[key] = object{data: data, contentType: r.Header.Get("Content-Type"), modTime: s.now().UTC()}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		s.mu.Lock()
+		o, ok := s.objects[key]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(o.data)))
+		w.Header().Set("Last-Modified", o.modTime.Format(http.TimeFormat))
+		if o.contentType != "" {
+			w.Header().Set("Content-Type", o.contentType)
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(o.data)
+		}
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+type listContents struct {
+	Key          string `xml:"Key"`
+	Size         int    `xml:"Size"`
+	LastModified string `xml:"LastModified"`
+}
+
+type listResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	Contents              []listContents `xml:"Contents"`
+}
+
+// list 实现 ListObjectsV2，continuation-token 为上一页最后一个 key
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, after := q.Get("prefix"), q.Get("continuation-token")
+	s.mu.Lock()
+	var keys []string
+	for k := range s.objects {
+		if strings.HasPrefix(k, prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	res := listResult{Name: s.Bucket, Prefix: prefix}
+	for i, k := range keys {
+		if i == s.PageSize {
+			res.IsTruncated = true
+			res.NextContinuationToken = keys[i-1]
+			break
+		}
+		o := s.objects[k]
+		res.Contents = append(res.Contents, listContents{Key: k, Size: len(o.data), LastModified: o.modTime.Format(time.RFC3339)})
+	}
+	s.mu.Unlock()
+	res.KeyCount = len(res.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(res)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: msg})
+}
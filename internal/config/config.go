@@ -1,8 +1,13 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"reflect"
+
+	"SnapReport/internal/violation"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,37 +15,236 @@ import (
 type Config struct {
 	Server struct {
 		Port int `yaml:"port"`
+		// Node 是多实例部署时本实例的节点号（0-65535），写入生成的 ID 以避免
+		// 实例之间冲突。不设置时 ID 只依靠随机数区分。
+		Node *uint16 `yaml:"node"`
+		// ReloadIntervalSeconds 是检查配置文件变化的间隔，0 表示只在收到 SIGHUP 时重新加载
+		ReloadIntervalSeconds int `yaml:"reload_interval_seconds"`
+		// ShutdownDelaySeconds 是收到 SIGTERM 后 /ready 返回 503、但仍正常处理请求的时间，
+		// 让负载均衡先摘除本实例
+		ShutdownDelaySeconds int `yaml:"shutdown_delay_seconds"`
+		// ShutdownTimeoutSeconds 是排空进行中的请求和异步任务的期限，超过后中断，至少为 1
+		ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"`
 	} `yaml:"server"`
 	DDPai struct {
-		BaseURL        string `yaml:"base_url"`
-		TimeoutSeconds int    `yaml:"timeout_seconds"`
-		MockMode       bool   `yaml:"mock_mode"`
+		BaseURL                string `yaml:"base_url"`
+		TimeoutSeconds         int    `yaml:"timeout_seconds"`          // 单次设备请求超时
+		CaptureTimeoutSeconds  int    `yaml:"capture_timeout_seconds"`  // 整个抓取阶段的期限
+		DownloadTimeoutSeconds int    `yaml:"download_timeout_seconds"` // 异步任务下载视频的期限
+		MockMode               bool   `yaml:"mock_mode"`
 	} `yaml:"ddpai"`
 	Geocoder struct {
-		Type      string `yaml:"type"`       // "nominatim" 或 "amap"
-		UserAgent string `yaml:"user_agent"` // 仅 Nominatim 使用
-		APIKey    string `yaml:"api_key"`    // 仅 AMap 使用
+		Type           string `yaml:"type"`                  // "nominatim" 或 "amap"
+		UserAgent      string `yaml:"user_agent"`            // 仅 Nominatim 使用
+		APIKey         string `yaml:"api_key" secret:"true"` // 仅 AMap 使用
+		TimeoutSeconds int    `yaml:"timeout_seconds"`       // 逆地理编码阶段的期限
 	} `yaml:"geocoder"`
+	Store struct {
+		Type string `yaml:"type"` // "file" 或 "memory"
+		Dir  string `yaml:"dir"`  // type 为 file 时每份报告保存为该目录下的一个 JSON 文件
+		// StateDir 保存通过 API 创建的用户、组织和 Webhook 订阅，为空时它们只保存在内存中
+		StateDir string `yaml:"state_dir"`
+	} `yaml:"store"`
+	Jobs struct {
+		Dir     string `yaml:"dir"`     // 任务持久化目录
+		Workers int    `yaml:"workers"` // 并发执行的任务数
+		// TTLHours 后删除已成功或失败的任务，0 表示保留全部任务
+		TTLHours int `yaml:"ttl_hours"`
+	} `yaml:"jobs"`
+	Media struct {
+		Dir        string `yaml:"dir"`          // 下载视频的保存目录
+		FFmpegPath string `yaml:"ffmpeg_path"`  // 为空时跳过裁剪阶段
+		MaxImageMB int    `yaml:"max_image_mb"` // 上传照片的大小上限
+		MaxVideoMB int    `yaml:"max_video_mb"` // 上传视频的大小上限
+	} `yaml:"media"`
+	Storage struct {
+		Type             string `yaml:"type"`               // "local" 或 "s3"
+		URLExpirySeconds int    `yaml:"url_expiry_seconds"` // 媒体下载地址的有效期
+		Local            struct {
+			Dir     string `yaml:"dir"`
+			BaseURL string `yaml:"base_url"`             // 生成下载地址时使用的外部地址，如 "https://snap.example.com"
+			Secret  string `yaml:"secret" secret:"true"` // 下载地址的签名密钥，为空时每次启动随机生成
+		} `yaml:"local"`
+		S3 struct {
+			Endpoint        string `yaml:"endpoint"` // 如 "https://s3.amazonaws.com" 或 MinIO 地址
+			Region          string `yaml:"region"`
+			Bucket          string `yaml:"bucket"`
+			AccessKeyID     string `yaml:"access_key_id" secret:"true"`
+			SecretAccessKey string `yaml:"secret_access_key" secret:"true"`
+			PathStyle       bool   `yaml:"path_style"` // MinIO 等通常需要开启
+		} `yaml:"s3"`
+		Reconcile struct {
+			IntervalMinutes int  `yaml:"interval_minutes"` // 0 表示不定期对账
+			GraceMinutes    int  `yaml:"grace_minutes"`    // 更新的未引用对象不算孤立
+			DeleteOrphans   bool `yaml:"delete_orphans"`
+		} `yaml:"reconcile"`
+	} `yaml:"storage"`
+	Retention struct {
+		IntervalMinutes int    `yaml:"interval_minutes"` // 0 表示不定期清理
+		DryRun          bool   `yaml:"dry_run"`          // 只记录将要清理的报告，不做修改
+		AuditFile       string `yaml:"audit_file"`       // 审计日志，为空时只保存在内存中
+		Rules           []struct {
+			Name      string `yaml:"name"`
+			Status    string `yaml:"status"`     // "prepared" 或 "submitted"
+			AfterDays int    `yaml:"after_days"` // 草稿从创建起算，已提交的报告从提交起算
+			Action    string `yaml:"action"`     // "delete" 或 "purge_media"
+		} `yaml:"rules"`
+	} `yaml:"retention"`
+	Dedup struct {
+		WindowSeconds  int     `yaml:"window_seconds"`  // 为 0 时关闭重复检测
+		DistanceMeters float64 `yaml:"distance_meters"` // 视为同一地点的最大距离
+	} `yaml:"dedup"`
+	Idempotency struct {
+		WindowSeconds int `yaml:"window_seconds"` // 保存首次响应的时长，0 表示不支持 Idempotency-Key
+	} `yaml:"idempotency"`
+	Dashboard struct {
+		Enabled     bool       `yaml:"enabled"`
+		TilesURL    string     `yaml:"tiles_url"` // 地图瓦片地址模板，为空时只显示坐标网格
+		Attribution string     `yaml:"attribution"`
+		Center      [2]float64 `yaml:"center"` // 没有报告时的地图中心 [lat, lng]
+		Zoom        int        `yaml:"zoom"`
+	} `yaml:"dashboard"`
+	Metrics struct {
+		Enabled bool `yaml:"enabled"` // 在 /metrics 以 Prometheus 文本格式导出指标，不需要认证，默认关闭
+	} `yaml:"metrics"`
+	Events struct {
+		LogSize int `yaml:"log_size"` // 保留用于 Last-Event-ID 补发的事件数
+	} `yaml:"events"`
+	Webhooks struct {
+		MaxAttempts    int `yaml:"max_attempts"`    // 超过后进入死信列表
+		BackoffSeconds int `yaml:"backoff_seconds"` // 第一次重试的等待时间，之后每次翻倍
+		// 允许订阅回环、内网和链路本地地址，默认拒绝
+		AllowPrivateNetworks bool `yaml:"allow_private_networks"`
+		Subscriptions        []struct {
+			OrgID  string   `yaml:"org_id"` // 为空表示接收所有组织的事件
+			URL    string   `yaml:"url"`
+			Events []string `yaml:"events"`               // 为空表示全部事件
+			Secret string   `yaml:"secret" secret:"true"` // 用于 HMAC-SHA256 签名
+		} `yaml:"subscriptions"`
+	} `yaml:"webhooks"`
+	Auth struct {
+		Enabled bool `yaml:"enabled"`
+		Users   []struct {
+			ID           string   `yaml:"id"`
+			OrgID        string   `yaml:"org_id"` // 为空表示 default 组织
+			Name         string   `yaml:"name"`
+			Role         string   `yaml:"role"`                         // "superadmin"、"admin" 或 "user"
+			APIKeySHA256 string   `yaml:"api_key_sha256" secret:"true"` // API Key 的 SHA-256 哈希，不保存明文
+			Devices      []string `yaml:"devices"`                      // 该用户拥有的设备
+		} `yaml:"users"`
+	} `yaml:"auth"`
+	// Orgs 是除 default 组织以外的组织（租户）
+	Orgs []struct {
+		ID       string `yaml:"id"`
+		Name     string `yaml:"name"`
+		Geocoder struct {
+			Type      string `yaml:"type"` // 为空时使用全局 geocoder 配置
+			UserAgent string `yaml:"user_agent"`
+			APIKey    string `yaml:"api_key" secret:"true"`
+		} `yaml:"geocoder"`
+		Submitter struct {
+			Name  string `yaml:"name"`
+			Phone string `yaml:"phone"`
+			Email string `yaml:"email"`
+		} `yaml:"submitter"`
+	} `yaml:"orgs"`
+	// ViolationTypes 覆盖内置的违法/事件分类，为空时使用 violation.DefaultTypes
+	ViolationTypes []violation.Type `yaml:"violation_types"`
+
+	// origins 记录每个 YAML 路径的值来自哪里，如 "config.yaml:12" 或环境变量名
+	origins map[string]string
+	// problems 是加载时发现的未知键和类型错误，由 Validate 一并报告
+	problems []Problem
 }
 
+// Load 读取 path 并应用 SNAPREPORT_* 环境变量，path 不存在时使用默认值
 func Load(path string) (*Config, error) {
-	var cfg Config
+	return LoadFrom(Sources{Path: path, Env: os.Environ()})
+}
+
+// LoadFrom 依次应用默认值、配置文件、环境变量和 src.Overrides
+func LoadFrom(src Sources) (*Config, error) {
+	cfg := Config{origins: map[string]string{}}
 	// Defaults
 	cfg.Server.Port = 8080
+	cfg.Server.ReloadIntervalSeconds = 5
+	cfg.Server.ShutdownTimeoutSeconds = 30
 	cfg.DDPai.BaseURL = "http://193.168.0.1"
 	cfg.DDPai.TimeoutSeconds = 5
+	cfg.DDPai.CaptureTimeoutSeconds = 30
+	cfg.DDPai.DownloadTimeoutSeconds = 600
 	cfg.Geocoder.Type = "nominatim"
 	cfg.Geocoder.UserAgent = "SnapReport/1.0"
 	cfg.Geocoder.APIKey = ""
+	cfg.Geocoder.TimeoutSeconds = 5
+	cfg.Store.Type = "file"
+	cfg.Store.Dir = "data/reports"
+	cfg.Store.StateDir = "data/state"
+	cfg.Jobs.Dir = "data/jobs"
+	cfg.Jobs.Workers = 2
+	cfg.Jobs.TTLHours = 7 * 24
+	cfg.Media.Dir = "data/media"
+	cfg.Media.MaxImageMB = 20
+	cfg.Media.MaxVideoMB = 500
+	cfg.Storage.Type = "local"
+	cfg.Storage.URLExpirySeconds = 900
+	cfg.Storage.Local.Dir = "data/blobs"
+	cfg.Storage.S3.Region = "us-east-1"
+	cfg.Storage.Reconcile.IntervalMinutes = 60
+	cfg.Storage.Reconcile.GraceMinutes = 60
+	cfg.Retention.IntervalMinutes = 60
+	cfg.Retention.AuditFile = "data/audit.jsonl"
+	cfg.Dedup.WindowSeconds = 120
+	cfg.Dedup.DistanceMeters = 50
+	cfg.Idempotency.WindowSeconds = 86400
+	cfg.Dashboard.Enabled = true
+	cfg.Events.LogSize = 1000
+	cfg.Webhooks.MaxAttempts = 5
+	cfg.Webhooks.BackoffSeconds = 2
 
-	f, err := os.Open(path)
-	if err != nil {
-		log.Printf("Warning: config file %s not found, using defaults: %v", path, err)
-		return &cfg, nil
+	if err := decodeFile(&cfg, src.Path, src.MustExist); err != nil {
+		return nil, err
+	}
+	if err := applyEnv(&cfg, src.Env); err != nil {
+		return nil, err
 	}
-	defer f.Close()
-	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil {
+	if err := applyOverrides(&cfg, src.Overrides); err != nil {
 		return nil, err
 	}
 	return &cfg, nil
 }
+
+// decodeFile 解码配置文件。未知的键和类型错误不会中止加载，而是记录下来
+// 由 Validate 与其他问题一起报告；只有 YAML 语法错误立即返回。
+func decodeFile(cfg *Config, path string, mustExist bool) error {
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if mustExist {
+			return err
+		}
+		log.Printf("Warning: config file %s not found, using defaults: %v", path, err)
+		return nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	cfg.checkKeys(root, reflect.TypeOf(*cfg), nil, path)
+	if err := root.Decode(cfg); err != nil {
+		var te *yaml.TypeError
+		if !errors.As(err, &te) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, msg := range te.Errors {
+			cfg.problems = append(cfg.problems, cfg.typeProblem(path, msg))
+		}
+	}
+	return nil
+}
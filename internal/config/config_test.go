@@ -0,0 +1,243 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  port: 8081
+geocoder:
+  type: amap
+  api_key: from-file
+ddpai:
+  mock_mode: true
+orgs:
+  - id: acme
+    geocoder:
+      type: amap
+      api_key: acme-file
+`)
+	secret := writeFile(t, "s3-secret", "from-secret-file\n")
+	cfg, err := LoadFrom(Sources{
+		Path: path,
+		Env: []string{
+			"SNAPREPORT_SERVER_PORT=9000",
+			"SNAPREPORT_GEOCODER_API_KEY=from-env",
+			"SNAPREPORT_DDPAI_MOCK_MODE=false",
+			"SNAPREPORT_DDPAI_BASE_URL=http://10.0.0.1",
+			"SNAPREPORT_STORAGE_S3_SECRET_ACCESS_KEY_FILE=" + secret,
+			"SNAPREPORT_ORGS_0_GEOCODER_API_KEY=acme-env",
+			"SNAPREPORT_DASHBOARD_CENTER=[22.5, 114.1]",
+			"SNAPREPORT_API_KEY=client-only", // 客户端命令使用，不是配置项
+			"HOME=/root",
+		},
+		Overrides: []string{"server.port=9090"},
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Server.Port != 9090 {
+		t.Errorf("port = %d, --set should win over env and file", cfg.Server.Port)
+	}
+	if cfg.Geocoder.Type != "amap" || cfg.Geocoder.APIKey != "from-env" {
+		t.Errorf("geocoder = %+v", cfg.Geocoder)
+	}
+	if cfg.DDPai.MockMode || cfg.DDPai.BaseURL != "http://10.0.0.1" || cfg.DDPai.TimeoutSeconds != 5 {
+		t.Errorf("ddpai = %+v", cfg.DDPai)
+	}
+	if cfg.Storage.S3.SecretAccessKey != "from-secret-file" {
+		t.Errorf("s3 secret = %q", cfg.Storage.S3.SecretAccessKey)
+	}
+	if len(cfg.Orgs) != 1 || cfg.Orgs[0].Geocoder.APIKey != "acme-env" || cfg.Orgs[0].Geocoder.Type != "amap" {
+		t.Errorf("orgs = %+v", cfg.Orgs)
+	}
+	if cfg.Dashboard.Center != [2]float64{22.5, 114.1} {
+		t.Errorf("center = %v", cfg.Dashboard.Center)
+	}
+}
+
+func TestLoadEnvLists(t *testing.T) {
+	cfg, err := LoadFrom(Sources{Env: []string{
+		`SNAPREPORT_AUTH_USERS=[{id: ops, role: superadmin, api_key_sha256: abc}]`,
+		"SNAPREPORT_AUTH_USERS_0_DEVICES=[dev1, dev2]",
+		"SNAPREPORT_SERVER_NODE=7",
+	}})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.Auth.Users) != 1 || cfg.Auth.Users[0].ID != "ops" || len(cfg.Auth.Users[0].Devices) != 2 {
+		t.Errorf("users = %+v", cfg.Auth.Users)
+	}
+	if cfg.Server.Node == nil || *cfg.Server.Node != 7 {
+		t.Errorf("node = %v", cfg.Server.Node)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	secret := writeFile(t, "key", "k")
+	for _, tc := range []struct {
+		name string
+		src  Sources
+		want string
+	}{
+		{"missing explicit file", Sources{Path: "/nonexistent/config.yaml", MustExist: true}, "no such file"},
+		{"bad int", Sources{Env: []string{"SNAPREPORT_SERVER_PORT=http"}}, "SNAPREPORT_SERVER_PORT"},
+		{"value and file", Sources{Env: []string{"SNAPREPORT_GEOCODER_API_KEY=a", "SNAPREPORT_GEOCODER_API_KEY_FILE=" + secret}}, "both"},
+		{"missing secret file", Sources{Env: []string{"SNAPREPORT_GEOCODER_API_KEY_FILE=/nonexistent"}}, "SNAPREPORT_GEOCODER_API_KEY_FILE"},
+		{"unknown override", Sources{Overrides: []string{"server.prot=1"}}, "unknown config key server.prot"},
+		{"malformed override", Sources{Overrides: []string{"server.port"}}, "key=value"},
+	} {
+		if _, err := LoadFrom(tc.src); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	// 非 secret 字段不接受 _FILE
+	cfg, err := LoadFrom(Sources{Env: []string{"SNAPREPORT_SERVER_PORT_FILE=" + secret}})
+	if err != nil || cfg.Server.Port != 8080 {
+		t.Errorf("port = %v, %v", cfg, err)
+	}
+}
+
+func TestValidateReportsUnknownEnv(t *testing.T) {
+	cfg, err := LoadFrom(Sources{Env: []string{
+		"SNAPREPORT_SERVR_PORT=9090",
+		"SNAPREPORT_ORGS_3_GEOCODER_API_KEY=k",
+		"SNAPREPORT_SERVER_PORT_FILE=/run/secrets/port",
+		"SNAPREPORT_GEOCODER_API_KEY_FILE=" + writeFile(t, "key", "k"),
+		"SNAPREPORT_CONFIG=config.yaml",
+		"SNAPREPORT_API_KEY=client-key",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ve *ValidationError
+	if !errors.As(cfg.Validate(), &ve) || len(ve.Problems) != 3 {
+		t.Fatalf("expected 3 problems, got %v", cfg.Validate())
+	}
+	for i, want := range []string{
+		"SNAPREPORT_ORGS_3_GEOCODER_API_KEY: environment variable does not match any config key or existing list element",
+		"SNAPREPORT_SERVER_PORT_FILE: only secret config keys accept _FILE",
+		"SNAPREPORT_SERVR_PORT: environment variable does not match any config key (did you mean SNAPREPORT_SERVER_PORT?)",
+	} {
+		if got := ve.Problems[i].String(); got != want {
+			t.Errorf("problem %d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if got := EnvName("storage.s3.access_key_id"); got != "SNAPREPORT_STORAGE_S3_ACCESS_KEY_ID" {
+		t.Errorf("EnvName = %s", got)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	path := writeFile(t, "config.yaml", `server:
+  port: 70000
+geocoder:
+  tpye: amap
+  type: amapp
+  timeout_seconds: soon
+storage:
+  type: s3
+  s3:
+    endpoint: "minio:9000"
+auth:
+  users:
+    - id: ops
+      role: admn
+      api_key_sha256: "abc"
+`)
+	cfg, err := LoadFrom(Sources{Path: path, Env: []string{"SNAPREPORT_JOBS_WORKERS=0", "SNAPREPORT_SERVER_SHUTDOWN_TIMEOUT_SECONDS=0"}})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	err = cfg.Validate()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Validate = %v, want *ValidationError", err)
+	}
+	got := map[string]Problem{}
+	for _, p := range invalid.Problems {
+		got[p.Path] = p
+	}
+	for _, want := range []struct {
+		path, source, message string
+	}{
+		{"server.port", path + ":2", "between 1 and 65535"},
+		{"geocoder.tpye", path + ":4", `did you mean "type"`},
+		{"geocoder.type", path + ":5", `did you mean "amap"`},
+		{"geocoder.timeout_seconds", path + ":6", "cannot unmarshal"},
+		{"jobs.workers", "SNAPREPORT_JOBS_WORKERS", "at least 1"},
+		{"server.shutdown_timeout_seconds", "SNAPREPORT_SERVER_SHUTDOWN_TIMEOUT_SECONDS", "at least 1"},
+		{"storage.s3.endpoint", path + ":10", "http or https URL"},
+		{"storage.s3.bucket", path + ":9", "required"},
+		{"storage.s3.secret_access_key", path + ":9", "SNAPREPORT_STORAGE_S3_SECRET_ACCESS_KEY_FILE"},
+		{"auth.users.0.role", path + ":14", `did you mean "admin"`},
+		{"auth.users.0.api_key_sha256", path + ":15", "SHA-256"},
+	} {
+		p, ok := got[want.path]
+		if !ok {
+			t.Errorf("no problem reported for %s", want.path)
+			continue
+		}
+		if p.Source != want.source || !strings.Contains(p.Message, want.message) {
+			t.Errorf("%s = %s, want source %s and message containing %q", want.path, p, want.source, want.message)
+		}
+	}
+}
+
+func TestDefaultsAndSampleConfigAreValid(t *testing.T) {
+	cfg, err := LoadFrom(Sources{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("defaults: %v", err)
+	}
+	// 示例配置使用高德地图，密钥需要部署时提供
+	cfg, err = LoadFrom(Sources{Path: "../../config.yaml", MustExist: true, Env: []string{"SNAPREPORT_GEOCODER_API_KEY=test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("config.yaml: %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old, _ := LoadFrom(Sources{Env: []string{"SNAPREPORT_GEOCODER_API_KEY=old", "SNAPREPORT_ORGS=[{id: a}]"}})
+	new, _ := LoadFrom(Sources{Env: []string{"SNAPREPORT_GEOCODER_API_KEY=new", "SNAPREPORT_ORGS=[{id: a, name: A}]"},
+		Overrides: []string{"ddpai.base_url=http://10.0.0.2"}})
+	var got []string
+	for _, c := range Diff(old, new) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`ddpai.base_url: "http://193.168.0.1" -> "http://10.0.0.2"`,
+		"geocoder.api_key: (set) -> (set)",
+		`orgs.0.name: "" -> "A"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Diff =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if d := Diff(old, old); len(d) != 0 {
+		t.Errorf("Diff(old, old) = %v", d)
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Change 是两份配置之间一个配置项的变化
+type Change struct {
+	Path     string // YAML 路径，如 "ddpai.base_url"
+	Old, New string // 用于日志的值，secret 字段只显示是否设置
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// Diff 按配置文件中的顺序返回从 old 到 new 变化的配置项。长度不同的列表
+// 作为一个整体报告，长度相同时报告变化的元素字段。
+func Diff(old, new *Config) []Change {
+	var out []Change
+	diffValue(reflect.ValueOf(*old), reflect.ValueOf(*new), nil, false, &out)
+	return out
+}
+
+func diffValue(a, b reflect.Value, path []string, secret bool, out *[]Change) {
+	switch {
+	case a.Kind() == reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if name == "" || name == "-" || !t.Field(i).IsExported() {
+				continue
+			}
+			p := append(append([]string(nil), path...), name)
+			diffValue(a.Field(i), b.Field(i), p, t.Field(i).Tag.Get("secret") == "true", out)
+		}
+		return
+	case a.Kind() == reflect.Slice && a.Type().Elem().Kind() == reflect.Struct && a.Len() == b.Len():
+		for i := 0; i < a.Len(); i++ {
+			p := append(append([]string(nil), path...), strconv.Itoa(i))
+			diffValue(a.Index(i), b.Index(i), p, false, out)
+		}
+		return
+	}
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+	*out = append(*out, Change{
+		Path: strings.Join(path, "."),
+		Old:  formatValue(a, secret),
+		New:  formatValue(b, secret),
+	})
+}
+
+// formatValue 格式化日志中显示的值，不泄露 secret 字段
+func formatValue(v reflect.Value, secret bool) string {
+	switch {
+	case v.Kind() == reflect.Pointer:
+		if v.IsNil() {
+			return "(unset)"
+		}
+		return formatValue(v.Elem(), secret)
+	case secret:
+		if v.IsZero() {
+			return "(unset)"
+		}
+		return "(set)"
+	case v.Kind() == reflect.String:
+		return strconv.Quote(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		return fmt.Sprintf("%d items", v.Len())
+	}
+	return fmt.Sprint(v.Interface())
+}
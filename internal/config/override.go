@@ -0,0 +1,207 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix 是覆盖配置的环境变量前缀
+const EnvPrefix = "SNAPREPORT_"
+
+// Sources 是配置的来源，优先级从低到高为：内置默认值、Path 指定的文件、
+// Env 中的 SNAPREPORT_* 环境变量、Overrides。
+type Sources struct {
+	Path string
+	// MustExist 为 true 时 Path 不存在是错误；否则只记录警告并使用默认值
+	MustExist bool
+	// Env 是 "KEY=value" 形式的环境变量，通常为 os.Environ()
+	Env []string
+	// Overrides 是 "yaml.path=value" 形式的覆盖，如 "server.port=9090"、
+	// "orgs.0.geocoder.api_key=..."，通常来自命令行的 -set 参数
+	Overrides []string
+}
+
+// field 是配置中的一个字段，path 为 YAML 键，切片元素的键是下标
+type field struct {
+	path   []string
+	value  reflect.Value
+	secret bool
+}
+
+// walk 按先序遍历 v 中带 yaml 标签的字段，切片先作为整体交给 fn，fn 可以
+// 替换它，之后再遍历替换后的元素
+func walk(v reflect.Value, path []string, secret bool, fn func(field) error) error {
+	if len(path) > 0 {
+		if err := fn(field{path: path, value: v, secret: secret}); err != nil {
+			return err
+		}
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if name == "" || name == "-" || !t.Field(i).IsExported() {
+				continue
+			}
+			p := append(append([]string(nil), path...), name)
+			if err := walk(v.Field(i), p, t.Field(i).Tag.Get("secret") == "true", fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			p := append(append([]string(nil), path...), strconv.Itoa(i))
+			if err := walk(v.Index(i), p, false, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EnvName 返回覆盖 YAML 路径 path（如 "storage.s3.bucket"）的环境变量名
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+}
+
+// envIgnored 是不属于配置项的 SNAPREPORT_* 环境变量
+var envIgnored = map[string]bool{
+	"SNAPREPORT_CONFIG":  true, // 配置文件路径，见 main.go
+	"SNAPREPORT_API_KEY": true, // 命令行客户端的 API Key
+}
+
+// envIndex 匹配变量名中的列表下标，如 SNAPREPORT_ORGS_3_ID 中的 _3_
+var envIndex = regexp.MustCompile(`_[0-9]+(_|$)`)
+
+// applyEnv 用环境变量覆盖配置。标记为 secret 的字段还接受 <NAME>_FILE，
+// 从文件读取值并去掉末尾的换行，两者同时设置是错误。没有对应配置项的变量
+// （拼写错误或列表下标不存在）记录为问题，由 Validate 报告。
+func applyEnv(cfg *Config, env []string) error {
+	vars := map[string]string{}
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, EnvPrefix) && !envIgnored[k] {
+			vars[k] = v
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+	used := map[string]bool{}
+	var names []string
+	err := walk(reflect.ValueOf(cfg).Elem(), nil, false, func(f field) error {
+		name := EnvName(strings.Join(f.path, "."))
+		names = append(names, strings.ToLower(name))
+		v, ok := vars[name]
+		used[name] = true
+		src := name
+		if f.secret {
+			names = append(names, strings.ToLower(name+"_FILE"))
+			used[name+"_FILE"] = true
+			if file, fok := vars[name+"_FILE"]; fok {
+				if ok {
+					return fmt.Errorf("both %s and %s_FILE are set", name, name)
+				}
+				b, err := os.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("%s_FILE: %w", name, err)
+				}
+				v, ok, src = strings.TrimRight(string(b), "\r\n"), true, name+"_FILE"
+			}
+		}
+		if !ok {
+			return nil
+		}
+		if err := setValue(f.value, v); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		cfg.setOrigin(strings.Join(f.path, "."), src)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	unknown := make([]string, 0, len(vars))
+	for k := range vars {
+		if !used[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		msg := "environment variable does not match any config key"
+		if base, ok := strings.CutSuffix(k, "_FILE"); ok && used[base] {
+			msg = "only secret config keys accept _FILE"
+		} else if envIndex.MatchString(k) {
+			msg = "environment variable does not match any config key or existing list element"
+		} else if near := closest(k, names); near != "" {
+			msg += fmt.Sprintf(" (did you mean %s?)", strings.ToUpper(near))
+		}
+		cfg.problems = append(cfg.problems, Problem{Source: k, Message: msg})
+	}
+	return nil
+}
+
+// applyOverrides 应用 "yaml.path=value" 形式的覆盖，未知的路径是错误
+func applyOverrides(cfg *Config, overrides []string) error {
+	pending := map[string]string{}
+	for _, o := range overrides {
+		k, v, ok := strings.Cut(o, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid override %q, want key=value", o)
+		}
+		pending[k] = v
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	err := walk(reflect.ValueOf(cfg).Elem(), nil, false, func(f field) error {
+		key := strings.Join(f.path, ".")
+		v, ok := pending[key]
+		if !ok {
+			return nil
+		}
+		delete(pending, key)
+		if err := setValue(f.value, v); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		cfg.setOrigin(key, "--set "+key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		keys := make([]string, 0, len(pending))
+		for k := range pending {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("unknown config key %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// setValue 将字符串 s 写入 v。字符串原样使用，其他类型（数字、布尔、列表、
+// 结构体列表）按 YAML 解析，如 "true"、"[22.5, 114.0]"、"[{id: a}]"；空值表示零值。
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(s)
+		return nil
+	}
+	v.Set(reflect.Zero(v.Type()))
+	if s == "" {
+		return nil
+	}
+	return yaml.Unmarshal([]byte(s), v.Addr().Interface())
+}
@@ -0,0 +1,443 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"SnapReport/internal/violation"
+	"SnapReport/internal/webhook"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem 是配置中的一个错误
+type Problem struct {
+	Path    string // YAML 路径，列表元素用下标，如 "auth.users.0.role"
+	Source  string // 值的来源，如 "config.yaml:12"、"SNAPREPORT_SERVER_PORT"；默认值为空
+	Message string
+}
+
+func (p Problem) String() string {
+	s := p.Message
+	if p.Path != "" {
+		s = p.Path + ": " + s
+	}
+	if p.Source != "" {
+		s = p.Source + ": " + s
+	}
+	return s
+}
+
+// ValidationError 包含配置中的全部错误
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	if len(e.Problems) == 1 {
+		lines = append(lines, "invalid config: 1 problem")
+	} else {
+		lines = append(lines, fmt.Sprintf("invalid config: %d problems", len(e.Problems)))
+	}
+	for _, p := range e.Problems {
+		lines = append(lines, "  "+p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 与 tenant 包的组织 ID 规则一致
+var orgIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// s3MaxURLExpiry 是 SigV4 预签名地址的最长有效期（秒）
+const s3MaxURLExpiry = 7 * 24 * 3600
+
+// Validate 检查配置并一次返回全部问题（*ValidationError），包括加载时发现的
+// 未知键和类型错误、枚举值、地址格式、取值范围以及各服务商必需的密钥。
+func (c *Config) Validate() error {
+	v := &validator{cfg: c, problems: append([]Problem(nil), c.problems...)}
+
+	v.intRange("server.port", c.Server.Port, 1, 65535)
+	v.intMin("server.reload_interval_seconds", c.Server.ReloadIntervalSeconds, 0)
+	v.intMin("server.shutdown_delay_seconds", c.Server.ShutdownDelaySeconds, 0)
+	v.intMin("server.shutdown_timeout_seconds", c.Server.ShutdownTimeoutSeconds, 1)
+
+	v.url("ddpai.base_url", c.DDPai.BaseURL, true)
+	v.intMin("ddpai.timeout_seconds", c.DDPai.TimeoutSeconds, 0)
+	v.intMin("ddpai.capture_timeout_seconds", c.DDPai.CaptureTimeoutSeconds, 0)
+	v.intMin("ddpai.download_timeout_seconds", c.DDPai.DownloadTimeoutSeconds, 0)
+
+	v.geocoder("geocoder", c.Geocoder.Type, c.Geocoder.APIKey, false)
+	v.intMin("geocoder.timeout_seconds", c.Geocoder.TimeoutSeconds, 0)
+
+	if v.oneOf("store.type", c.Store.Type, "file", "memory") && c.Store.Type == "file" {
+		v.required("store.dir", c.Store.Dir)
+	}
+	v.required("jobs.dir", c.Jobs.Dir)
+	v.intMin("jobs.workers", c.Jobs.Workers, 1)
+	v.intMin("jobs.ttl_hours", c.Jobs.TTLHours, 0)
+	v.required("media.dir", c.Media.Dir)
+	v.intMin("media.max_image_mb", c.Media.MaxImageMB, 0)
+	v.intMin("media.max_video_mb", c.Media.MaxVideoMB, 0)
+
+	v.storage()
+	v.retention()
+
+	v.intMin("dedup.window_seconds", c.Dedup.WindowSeconds, 0)
+	if c.Dedup.DistanceMeters < 0 {
+		v.add("dedup.distance_meters", "must not be negative")
+	}
+	v.intMin("idempotency.window_seconds", c.Idempotency.WindowSeconds, 0)
+	v.dashboard()
+	v.intMin("events.log_size", c.Events.LogSize, 0)
+	v.webhooks()
+	v.orgsAndUsers()
+
+	if len(c.ViolationTypes) > 0 {
+		if _, err := violation.New(c.ViolationTypes); err != nil {
+			v.add("violation_types", "%v", err)
+		}
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+type validator struct {
+	cfg      *Config
+	problems []Problem
+}
+
+// add 记录一个问题，来源取路径本身或最近的上级路径的来源
+func (v *validator) add(path, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Path: path, Source: v.cfg.source(path), Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(path, s string) bool {
+	if strings.TrimSpace(s) == "" {
+		v.add(path, "required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) intMin(path string, n, min int) {
+	if n < min {
+		v.add(path, "must be at least %d, got %d", min, n)
+	}
+}
+
+func (v *validator) intRange(path string, n, min, max int) {
+	if n < min || n > max {
+		v.add(path, "must be between %d and %d, got %d", min, max, n)
+	}
+}
+
+// oneOf 检查 s 是允许的值之一，相近时给出建议
+func (v *validator) oneOf(path, s string, allowed ...string) bool {
+	if slices.Contains(allowed, s) {
+		return true
+	}
+	msg := fmt.Sprintf("unknown value %q, want %s", s, strings.Join(allowed, ", "))
+	if s == "" {
+		msg = "required, want " + strings.Join(allowed, ", ")
+	} else if near := closest(s, allowed); near != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", near)
+	}
+	v.add(path, "%s", msg)
+	return false
+}
+
+// url 检查 s 是 http 或 https 地址
+func (v *validator) url(path, s string, required bool) {
+	if s == "" {
+		if required {
+			v.add(path, "required")
+		}
+		return
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(path, "must be an http or https URL, got %q", s)
+	}
+}
+
+// geocoder 检查地理编码器类型及其所需的密钥。inherit 为 true 时类型可以
+// 为空，表示使用全局配置。
+func (v *validator) geocoder(path, typ, apiKey string, inherit bool) {
+	if inherit && typ == "" {
+		return
+	}
+	if v.oneOf(path+".type", typ, "nominatim", "amap") && typ == "amap" && apiKey == "" {
+		v.add(path+".api_key", "required for the amap geocoder (or set %s_FILE)", EnvName(path+".api_key"))
+	}
+}
+
+func (v *validator) storage() {
+	s := v.cfg.Storage
+	if !v.oneOf("storage.type", s.Type, "local", "s3") {
+		return
+	}
+	v.intMin("storage.url_expiry_seconds", s.URLExpirySeconds, 0)
+	switch s.Type {
+	case "local":
+		v.required("storage.local.dir", s.Local.Dir)
+		v.url("storage.local.base_url", s.Local.BaseURL, false)
+	case "s3":
+		v.url("storage.s3.endpoint", s.S3.Endpoint, true)
+		v.required("storage.s3.bucket", s.S3.Bucket)
+		if s.S3.AccessKeyID == "" {
+			v.add("storage.s3.access_key_id", "required for s3 storage (or set %s_FILE)", EnvName("storage.s3.access_key_id"))
+		}
+		if s.S3.SecretAccessKey == "" {
+			v.add("storage.s3.secret_access_key", "required for s3 storage (or set %s_FILE)", EnvName("storage.s3.secret_access_key"))
+		}
+		if s.URLExpirySeconds > s3MaxURLExpiry {
+			v.add("storage.url_expiry_seconds", "s3 presigned URLs are valid for at most %d seconds (7 days)", s3MaxURLExpiry)
+		}
+	}
+	v.intMin("storage.reconcile.interval_minutes", s.Reconcile.IntervalMinutes, 0)
+	v.intMin("storage.reconcile.grace_minutes", s.Reconcile.GraceMinutes, 0)
+}
+
+func (v *validator) retention() {
+	r := v.cfg.Retention
+	v.intMin("retention.interval_minutes", r.IntervalMinutes, 0)
+	seen := map[string]bool{}
+	for i, rule := range r.Rules {
+		p := "retention.rules." + strconv.Itoa(i)
+		if v.required(p+".name", rule.Name) {
+			if seen[rule.Name] {
+				v.add(p+".name", "duplicate rule %q", rule.Name)
+			}
+			seen[rule.Name] = true
+		}
+		v.oneOf(p+".status", rule.Status, "prepared", "submitted")
+		v.intMin(p+".after_days", rule.AfterDays, 1)
+		v.oneOf(p+".action", rule.Action, "delete", "purge_media")
+	}
+}
+
+func (v *validator) dashboard() {
+	d := v.cfg.Dashboard
+	if d.TilesURL != "" {
+		u, err := url.Parse(d.TilesURL)
+		switch {
+		case err != nil || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https"):
+			v.add("dashboard.tiles_url", "must be an http, https or relative URL template, got %q", d.TilesURL)
+		case !strings.Contains(d.TilesURL, "{z}") || !strings.Contains(d.TilesURL, "{x}") || !strings.Contains(d.TilesURL, "{y}"):
+			v.add("dashboard.tiles_url", "must contain {z}, {x} and {y}")
+		}
+	}
+	if d.Center[0] < -90 || d.Center[0] > 90 {
+		v.add("dashboard.center", "latitude must be between -90 and 90, got %v", d.Center[0])
+	}
+	if d.Center[1] < -180 || d.Center[1] > 180 {
+		v.add("dashboard.center", "longitude must be between -180 and 180, got %v", d.Center[1])
+	}
+	v.intRange("dashboard.zoom", d.Zoom, 0, 18)
+}
+
+func (v *validator) webhooks() {
+	w := v.cfg.Webhooks
+	v.intMin("webhooks.max_attempts", w.MaxAttempts, 0)
+	v.intMin("webhooks.backoff_seconds", w.BackoffSeconds, 0)
+	for i, s := range w.Subscriptions {
+		p := "webhooks.subscriptions." + strconv.Itoa(i)
+		v.url(p+".url", s.URL, true)
+		v.required(p+".secret", s.Secret)
+		for j, e := range s.Events {
+			if e != "*" {
+				v.oneOf(p+".events."+strconv.Itoa(j), e, webhook.EventTypes...)
+			}
+		}
+		if s.OrgID != "" && !v.orgExists(s.OrgID) {
+			v.add(p+".org_id", "unknown org %q", s.OrgID)
+		}
+	}
+}
+
+func (v *validator) orgExists(id string) bool {
+	if id == "default" {
+		return true
+	}
+	for _, o := range v.cfg.Orgs {
+		if o.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) orgsAndUsers() {
+	seen := map[string]bool{"default": true}
+	for i, o := range v.cfg.Orgs {
+		p := "orgs." + strconv.Itoa(i)
+		switch {
+		case !orgIDPattern.MatchString(o.ID):
+			v.add(p+".id", "must be 1-64 lowercase letters, digits, '-' or '_', got %q", o.ID)
+		case seen[o.ID]:
+			v.add(p+".id", "duplicate org %q", o.ID)
+		}
+		seen[o.ID] = true
+		v.geocoder(p+".geocoder", o.Geocoder.Type, o.Geocoder.APIKey, true)
+	}
+
+	a := v.cfg.Auth
+	users := map[string]bool{}
+	for i, u := range a.Users {
+		p := "auth.users." + strconv.Itoa(i)
+		if v.required(p+".id", u.ID) {
+			if users[u.ID] {
+				v.add(p+".id", "duplicate user %q", u.ID)
+			}
+			users[u.ID] = true
+		}
+		if u.Role != "" {
+			v.oneOf(p+".role", u.Role, "superadmin", "admin", "user")
+		}
+		if u.OrgID != "" && !v.orgExists(u.OrgID) {
+			v.add(p+".org_id", "unknown org %q", u.OrgID)
+		}
+		if b, err := hex.DecodeString(u.APIKeySHA256); err != nil || len(b) != 32 {
+			v.add(p+".api_key_sha256", "must be the 64-character hex SHA-256 of the API key")
+		}
+	}
+	if a.Enabled && len(a.Users) == 0 {
+		v.add("auth.users", "at least one user is required when auth is enabled")
+	}
+}
+
+// source 返回 path 或其最近的上级路径的来源
+func (c *Config) source(path string) string {
+	for p := path; p != ""; {
+		if s, ok := c.origins[p]; ok {
+			return s
+		}
+		i := strings.LastIndexByte(p, '.')
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	return ""
+}
+
+// setOrigin 记录 path 的值来自 src，并清除被整体替换的下级路径的来源
+func (c *Config) setOrigin(path, src string) {
+	if c.origins == nil {
+		c.origins = map[string]string{}
+	}
+	for p := range c.origins {
+		if strings.HasPrefix(p, path+".") {
+			delete(c.origins, p)
+		}
+	}
+	c.origins[path] = src
+}
+
+// checkKeys 对照 t 的 yaml 标签检查配置文件中的键，记录每个键所在的行，
+// 并将未知的键记为问题
+func (c *Config) checkKeys(n *yaml.Node, t reflect.Type, path []string, file string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		fields := map[string]reflect.StructField{}
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if name != "" && name != "-" && t.Field(i).IsExported() {
+				fields[name] = t.Field(i)
+			}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			p := append(append([]string(nil), path...), key.Value)
+			src := fmt.Sprintf("%s:%d", file, key.Line)
+			f, ok := fields[key.Value]
+			if !ok {
+				msg := "unknown key"
+				names := make([]string, 0, len(fields))
+				for name := range fields {
+					names = append(names, name)
+				}
+				if near := closest(key.Value, names); near != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", near)
+				}
+				c.problems = append(c.problems, Problem{Path: strings.Join(p, "."), Source: src, Message: msg})
+				continue
+			}
+			c.origins[strings.Join(p, ".")] = src
+			c.checkKeys(val, f.Type, p, file)
+		}
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && n.Kind == yaml.SequenceNode:
+		for i, el := range n.Content {
+			p := append(append([]string(nil), path...), strconv.Itoa(i))
+			c.origins[strings.Join(p, ".")] = fmt.Sprintf("%s:%d", file, el.Line)
+			c.checkKeys(el, t.Elem(), p, file)
+		}
+	}
+}
+
+// typeProblem 将 yaml.TypeError 中形如 "line 3: cannot unmarshal ..." 的消息
+// 转为问题，路径取该行上最深的键
+var typeErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+func (c *Config) typeProblem(file, msg string) Problem {
+	m := typeErrorLine.FindStringSubmatch(msg)
+	if m == nil {
+		return Problem{Source: file, Message: msg}
+	}
+	src := file + ":" + m[1]
+	path := ""
+	for p, s := range c.origins {
+		if s == src && len(p) > len(path) {
+			path = p
+		}
+	}
+	return Problem{Path: path, Source: src, Message: m[2]}
+}
+
+// closest 返回与 s 编辑距离不超过 2 的最接近的候选，没有时返回空
+func closest(s string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(s), c); d < bestDist || d == bestDist && c < best {
+			best, bestDist = c, d
+		}
+	}
+	if bestDist > 2 {
+		return ""
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,49 @@
+// Package dashboard 提供内嵌在二进制中的网页控制台。页面只使用本包中的
+// 静态文件，地图底图的瓦片地址可配置，不配置时只显示坐标网格，可离线使用。
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Config 是页面在加载时读取的配置
+type Config struct {
+	// TilesURL 是地图瓦片地址模板，如 "https://tile.openstreetmap.org/{z}/{x}/{y}.png"
+	// 或内网瓦片服务，支持 {s}（子域 a/b/c）。为空时不加载底图。
+	TilesURL    string `json:"tiles_url"`
+	Attribution string `json:"attribution"`
+	// Center 是没有报告时地图的中心 [lat, lng]
+	Center [2]float64 `json:"center"`
+	Zoom   int        `json:"zoom"`
+}
+
+// Handler 返回控制台的 http.Handler，r.URL.Path 为去掉挂载前缀后的路径
+func Handler(cfg Config) http.Handler {
+	if cfg.Center == ([2]float64{}) {
+		cfg.Center = [2]float64{22.5431, 114.0579} // 深圳
+	}
+	if cfg.Zoom == 0 {
+		cfg.Zoom = 11
+	}
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServer(http.FS(sub))
+	conf, _ := json.Marshal(cfg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/config.json" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(conf)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,34 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerServesAssetsAndConfig(t *testing.T) {
+	h := Handler(Config{TilesURL: "http://tiles.local/{z}/{x}/{y}.png"})
+	for path, want := range map[string]string{
+		"/":       "<title>SnapReport</title>",
+		"/app.js": "MiniMap",
+		"/map.js": "function project",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != 200 || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET %s = %d, missing %q", path, rec.Code, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config.json", nil))
+	var cfg Config
+	if err := json.Unmarshal(rec.Body.Bytes(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TilesURL != "http://tiles.local/{z}/{x}/{y}.png" || cfg.Zoom == 0 || cfg.Center[0] == 0 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
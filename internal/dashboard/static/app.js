@@ -0,0 +1,236 @@
+// SnapReport 控制台：只调用服务已有的 HTTP API，API Key 保存在 localStorage。
+(function () {
+  'use strict';
+
+  var STATUS = { prepared: '待发送', submitted: '已提交' };
+  var state = { reports: [], selected: null, map: null };
+
+  function $(sel) { return document.querySelector(sel); }
+
+  // el 创建元素，文本一律通过 textContent 写入，避免报告内容被当作 HTML
+  function el(tag, attrs, children) {
+    var e = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (k) {
+      if (k === 'text') e.textContent = attrs[k];
+      else if (k === 'class') e.className = attrs[k];
+      else if (k.slice(0, 2) === 'on') e.addEventListener(k.slice(2), attrs[k]);
+      else e.setAttribute(k, attrs[k]);
+    });
+    (children || []).forEach(function (c) { if (c) e.appendChild(c); });
+    return e;
+  }
+
+  function showError(msg) {
+    var box = $('#error');
+    box.textContent = msg;
+    box.hidden = false;
+    clearTimeout(showError.timer);
+    showError.timer = setTimeout(function () { box.hidden = true; }, 5000);
+  }
+
+  function api(method, path, body) {
+    var headers = {};
+    var key = localStorage.getItem('snapreport.apiKey');
+    if (key) headers['Authorization'] = 'Bearer ' + key;
+    if (body !== undefined) headers['Content-Type'] = 'application/json';
+    return fetch(path, { method: method, headers: headers, body: body === undefined ? undefined : JSON.stringify(body) })
+      .then(function (resp) {
+        return resp.json().catch(function () { return {}; }).then(function (data) {
+          if (resp.status === 401) {
+            askKey();
+          }
+          if (!resp.ok) throw new Error(data.error || resp.statusText);
+          return data;
+        });
+      });
+  }
+
+  function askKey() {
+    var key = prompt('API Key（未启用认证时留空）', localStorage.getItem('snapreport.apiKey') || '');
+    if (key === null) return;
+    if (key) localStorage.setItem('snapreport.apiKey', key.trim());
+    else localStorage.removeItem('snapreport.apiKey');
+    load();
+  }
+
+  // query 将筛选表单转换为列表查询参数，日期按北京时间的整天处理
+  function query() {
+    var form = new FormData($('#filters'));
+    var q = new URLSearchParams();
+    ['device_id', 'status', 'plate'].forEach(function (k) {
+      var v = (form.get(k) || '').trim();
+      if (v) q.set(k, v);
+    });
+    var from = form.get('from'), to = form.get('to');
+    if (from) q.set('from', from + 'T00:00:00+08:00');
+    if (to) {
+      var end = new Date(to + 'T00:00:00+08:00');
+      end.setUTCDate(end.getUTCDate() + 1);
+      q.set('to', end.toISOString().replace(/\.\d+Z$/, 'Z'));
+    }
+    return q.toString();
+  }
+
+  function load() {
+    api('GET', '/reports?' + query()).then(function (reports) {
+      state.reports = reports.slice().reverse(); // 最新的在前
+      render();
+    }).catch(function (e) { showError('加载报告失败：' + e.message); });
+  }
+
+  function fmtTime(s) {
+    if (!s) return '';
+    var d = new Date(s);
+    return isNaN(d) ? s : d.toLocaleString('zh-CN', { hour12: false });
+  }
+
+  function plate(r) { return r.vehicle && r.vehicle.plate || ''; }
+
+  function hasLocation(r) { return r.lat || r.lng; }
+
+  function markerClass(r) {
+    return r.status + (r.is_highway ? ' highway' : '') + (state.selected === r.id ? ' selected' : '');
+  }
+
+  function render() {
+    var rows = $('#rows');
+    rows.textContent = '';
+    var withLocation = 0;
+    state.reports.forEach(function (r) {
+      if (hasLocation(r)) withLocation++;
+      var status = el('span', { class: 'badge ' + r.status, text: STATUS[r.status] || r.status });
+      rows.appendChild(el('tr', { class: state.selected === r.id ? 'selected' : '', onclick: function () { select(r.id); } }, [
+        el('td', { text: fmtTime(r.occurred_at || r.timestamp) }),
+        el('td', { text: [r.city, r.road_name].filter(Boolean).join(' ') }),
+        el('td', { text: r.violation_type || '' }),
+        el('td', { text: plate(r) }),
+        el('td', {}, [status, r.legal_hold ? el('span', { class: 'badge hold', text: '保全' }) : null])
+      ]));
+    });
+    $('#summary').textContent = '共 ' + state.reports.length + ' 份报告，' + withLocation + ' 份有坐标';
+    renderMarkers();
+  }
+
+  function renderMarkers() {
+    state.map.setMarkers(state.reports.filter(hasLocation).map(function (r) {
+      return {
+        lat: r.lat, lng: r.lng, className: markerClass(r),
+        title: [fmtTime(r.timestamp), r.road_name, plate(r)].filter(Boolean).join(' · '),
+        onClick: function () { select(r.id); }
+      };
+    }));
+  }
+
+  function find(id) {
+    for (var i = 0; i < state.reports.length; i++) if (state.reports[i].id === id) return state.reports[i];
+    return null;
+  }
+
+  function select(id) {
+    state.selected = id;
+    render();
+    var r = find(id);
+    if (r) showDetail(r);
+  }
+
+  function replace(report) {
+    for (var i = 0; i < state.reports.length; i++) {
+      if (state.reports[i].id === report.id) state.reports[i] = report;
+    }
+    render();
+    showDetail(report);
+  }
+
+  function showDetail(r) {
+    var body = $('#detail-body');
+    body.textContent = '';
+    var fields = [
+      ['ID', r.id], ['状态', STATUS[r.status] || r.status], ['设备', r.device_id],
+      ['时间', fmtTime(r.occurred_at || r.timestamp)], ['提交时间', fmtTime(r.submitted_at)],
+      ['城市', r.city], ['道路', r.road_name], ['高速公路', r.is_highway ? '是' : '否'],
+      ['坐标', hasLocation(r) ? r.lat + ', ' + r.lng : ''],
+      ['违法类型', [r.violation_type, r.violation_code].filter(Boolean).join(' / ')],
+      ['号牌', plate(r)], ['描述', r.description], ['标签', (r.tags || []).join('、')],
+      ['疑似重复', r.duplicate_of], ['法律保全', r.legal_hold ? (r.legal_hold_reason || '是') : ''],
+      ['媒体已清除', fmtTime(r.media_purged_at)]
+    ];
+    var dl = el('dl');
+    fields.forEach(function (f) {
+      if (!f[1]) return;
+      dl.appendChild(el('dt', { text: f[0] }));
+      dl.appendChild(el('dd', { text: f[1] }));
+    });
+    body.appendChild(el('h3', { text: plate(r) || r.violation_type || '报告' }));
+    body.appendChild(actions(r));
+    body.appendChild(dl);
+    var media = el('div', { class: 'media' });
+    body.appendChild(media);
+    $('#detail').hidden = false;
+    loadMedia(r, media);
+  }
+
+  function actions(r) {
+    var box = el('div', { class: 'actions' });
+    if (r.status === 'prepared') {
+      box.appendChild(el('button', { type: 'button', text: '发送', onclick: function () {
+        if (!confirm('确定提交这份报告？')) return;
+        api('POST', '/reports/send', { id: r.id }).then(replace).catch(function (e) { showError('发送失败：' + e.message); });
+      } }));
+    }
+    box.appendChild(el('button', { type: 'button', text: r.legal_hold ? '解除保全' : '法律保全', onclick: function () {
+      var req;
+      if (r.legal_hold) {
+        if (!confirm('解除保全后，到期的报告会被保留策略清理。确定解除？')) return;
+        req = api('DELETE', '/reports/' + r.id + '/legal-hold');
+      } else {
+        var reason = prompt('保全原因');
+        if (!reason) return;
+        req = api('PUT', '/reports/' + r.id + '/legal-hold', { reason: reason });
+      }
+      req.then(replace).catch(function (e) { showError('操作失败：' + e.message); });
+    } }));
+    return box;
+  }
+
+  function loadMedia(r, box) {
+    api('GET', '/reports/' + r.id + '/media').then(function (list) {
+      if (state.selected !== r.id) return;
+      list.forEach(function (a) {
+        if (!a.url) return;
+        box.appendChild(a.kind === 'video'
+          ? el('video', { src: a.url, controls: '', preload: 'metadata' })
+          : el('img', { src: a.url, alt: a.filename || '' }));
+      });
+      // 没有转存的视频时尝试直接播放设备地址（模拟模式的 ddpai:// 地址无法播放）
+      if (!list.length && /^https?:/.test(r.video_url || '')) {
+        box.appendChild(el('video', { src: r.video_url, controls: '', preload: 'metadata' }));
+      }
+      if (!box.childNodes.length) box.appendChild(el('p', { text: r.media_purged_at ? '媒体已按保留策略清除' : '没有可播放的媒体' }));
+    }).catch(function (e) {
+      box.appendChild(el('p', { text: '无法加载媒体：' + e.message }));
+    });
+  }
+
+  function init(config) {
+    state.map = new window.MiniMap($('#map'), { tilesURL: config.tiles_url, center: config.center, zoom: config.zoom });
+    $('#map .attribution').textContent = config.attribution || '';
+    document.querySelectorAll('[data-zoom]').forEach(function (b) {
+      b.addEventListener('click', function () { state.map.setZoom(state.map.zoom + Number(b.dataset.zoom)); });
+    });
+    $('#filters').addEventListener('submit', function (e) { e.preventDefault(); load(); });
+    $('#key-button').addEventListener('click', askKey);
+    $('#detail .close').addEventListener('click', function () {
+      $('#detail').hidden = true;
+      state.selected = null;
+      render();
+    });
+    api('GET', '/reports?' + query()).then(function (reports) {
+      state.reports = reports.slice().reverse();
+      render();
+      state.map.fit(state.reports.filter(hasLocation).map(function (r) { return { lat: r.lat, lng: r.lng }; }));
+    }).catch(function (e) { showError('加载报告失败：' + e.message); });
+  }
+
+  fetch('config.json').then(function (r) { return r.json(); }).then(init)
+    .catch(function () { init({ center: [22.5431, 114.0579], zoom: 11 }); });
+})();
@@ -0,0 +1,143 @@
+// MiniMap 是一个最小的 Web Mercator 瓦片地图：拖动平移、滚轮和按钮缩放、
+// 显示标记。没有瓦片地址时只显示网格背景，标记仍按坐标定位。
+(function () {
+  'use strict';
+
+  var TILE = 256;
+  var MIN_ZOOM = 2;
+  var MAX_ZOOM = 18;
+
+  function project(lat, lng, zoom) {
+    var scale = TILE * Math.pow(2, zoom);
+    var s = Math.sin(Math.max(-85.05, Math.min(85.05, lat)) * Math.PI / 180);
+    return {
+      x: (lng + 180) / 360 * scale,
+      y: (0.5 - Math.log((1 + s) / (1 - s)) / (4 * Math.PI)) * scale
+    };
+  }
+
+  function unproject(x, y, zoom) {
+    var scale = TILE * Math.pow(2, zoom);
+    var n = Math.PI - 2 * Math.PI * y / scale;
+    return {
+      lat: 180 / Math.PI * Math.atan(Math.sinh(n)),
+      lng: x / scale * 360 - 180
+    };
+  }
+
+  function MiniMap(el, options) {
+    this.el = el;
+    this.tilesURL = options.tilesURL || '';
+    this.center = { lat: options.center[0], lng: options.center[1] };
+    this.zoom = options.zoom;
+    this.markers = [];
+    this.tiles = document.createElement('div');
+    this.tiles.className = 'tiles';
+    this.layer = document.createElement('div');
+    this.layer.className = 'markers';
+    el.appendChild(this.tiles);
+    el.appendChild(this.layer);
+    this._bind();
+    this.render();
+  }
+
+  MiniMap.prototype._bind = function () {
+    var self = this;
+    var start = null;
+    this.el.addEventListener('pointerdown', function (e) {
+      if (e.target.closest('.marker, button')) return;
+      start = { x: e.clientX, y: e.clientY, c: project(self.center.lat, self.center.lng, self.zoom) };
+      self.el.classList.add('dragging');
+      self.el.setPointerCapture(e.pointerId);
+    });
+    this.el.addEventListener('pointermove', function (e) {
+      if (!start) return;
+      var c = unproject(start.c.x - (e.clientX - start.x), start.c.y - (e.clientY - start.y), self.zoom);
+      self.center = c;
+      self.render();
+    });
+    var end = function () {
+      start = null;
+      self.el.classList.remove('dragging');
+    };
+    this.el.addEventListener('pointerup', end);
+    this.el.addEventListener('pointercancel', end);
+    this.el.addEventListener('wheel', function (e) {
+      e.preventDefault();
+      self.setZoom(self.zoom + (e.deltaY < 0 ? 1 : -1));
+    }, { passive: false });
+    window.addEventListener('resize', function () { self.render(); });
+  };
+
+  MiniMap.prototype.setZoom = function (zoom) {
+    this.zoom = Math.max(MIN_ZOOM, Math.min(MAX_ZOOM, zoom));
+    this.render();
+  };
+
+  // fit 调整中心和缩放级别，使所有点可见
+  MiniMap.prototype.fit = function (points) {
+    if (!points.length) return;
+    var minLat = 90, maxLat = -90, minLng = 180, maxLng = -180;
+    points.forEach(function (p) {
+      minLat = Math.min(minLat, p.lat); maxLat = Math.max(maxLat, p.lat);
+      minLng = Math.min(minLng, p.lng); maxLng = Math.max(maxLng, p.lng);
+    });
+    this.center = { lat: (minLat + maxLat) / 2, lng: (minLng + maxLng) / 2 };
+    var w = this.el.clientWidth - 60, h = this.el.clientHeight - 60;
+    var zoom = MAX_ZOOM;
+    for (; zoom > MIN_ZOOM; zoom--) {
+      var a = project(maxLat, minLng, zoom), b = project(minLat, maxLng, zoom);
+      if (b.x - a.x <= w && b.y - a.y <= h) break;
+    }
+    this.zoom = Math.min(zoom, 16);
+    this.render();
+  };
+
+  // setMarkers 替换全部标记。每个标记为 {lat, lng, className, title, onClick}。
+  MiniMap.prototype.setMarkers = function (markers) {
+    this.markers = markers;
+    this.render();
+  };
+
+  MiniMap.prototype.render = function () {
+    var w = this.el.clientWidth, h = this.el.clientHeight;
+    var c = project(this.center.lat, this.center.lng, this.zoom);
+    var ox = c.x - w / 2, oy = c.y - h / 2;
+    this.el.style.backgroundPosition = (-ox % 64) + 'px ' + (-oy % 64) + 'px';
+
+    this.tiles.textContent = '';
+    if (this.tilesURL) {
+      var n = Math.pow(2, this.zoom);
+      for (var tx = Math.floor(ox / TILE); tx <= Math.floor((ox + w) / TILE); tx++) {
+        for (var ty = Math.max(0, Math.floor(oy / TILE)); ty <= Math.min(n - 1, Math.floor((oy + h) / TILE)); ty++) {
+          var x = ((tx % n) + n) % n;
+          var img = document.createElement('img');
+          img.alt = '';
+          img.src = this.tilesURL
+            .replace('{z}', this.zoom).replace('{x}', x).replace('{y}', ty)
+            .replace('{s}', 'abc'[(x + ty) % 3]);
+          img.style.left = (tx * TILE - ox) + 'px';
+          img.style.top = (ty * TILE - oy) + 'px';
+          this.tiles.appendChild(img);
+        }
+      }
+    }
+
+    this.layer.textContent = '';
+    var self = this;
+    this.markers.forEach(function (m) {
+      var p = project(m.lat, m.lng, self.zoom);
+      var x = p.x - ox, y = p.y - oy;
+      if (x < -20 || y < -20 || x > w + 20 || y > h + 20) return;
+      var el = document.createElement('div');
+      el.className = 'marker ' + (m.className || '');
+      el.style.left = x + 'px';
+      el.style.top = y + 'px';
+      el.title = m.title || '';
+      if (m.onClick) el.addEventListener('click', m.onClick);
+      self.layer.appendChild(el);
+    });
+  };
+
+  window.MiniMap = MiniMap;
+})();
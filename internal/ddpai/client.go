@@ -1,16 +1,28 @@
 package ddpai
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"SnapReport/internal/metrics"
 )
 
+// ErrMockClip 表示视频地址由模拟模式生成，没有可下载的数据
+var ErrMockClip = errors.New("mock clip has no data")
+
 type Client struct {
 	BaseURL  string
 	Client   *http.Client
 	MockMode bool
+	// Metrics 记录每个设备各命令的耗时、失败次数和下载字节数，可为 nil
+	Metrics *metrics.Metrics
 }
 
 func NewClient(baseURL string, timeoutSeconds int, mockMode bool) *Client {
@@ -24,10 +36,14 @@ func NewClient(baseURL string, timeoutSeconds int, mockMode bool) *Client {
 	}
 }
 
-func (c *Client) CaptureRecentVideo(deviceID string, durationSec int) (string, error) {
-	session, err := c.getSession()
+// CaptureRecentVideo 获取设备上最新视频的下载地址。ctx 被取消时立即中止，
+// 并且不会回退到模拟模式。
+func (c *Client) CaptureRecentVideo(ctx context.Context, deviceID string, durationSec int) (string, error) {
+	start := time.Now()
+	session, err := c.getSession(ctx)
+	c.observe(deviceID, "session", start, err)
 	if err != nil {
-		if c.MockMode {
+		if c.MockMode && ctx.Err() == nil {
 			return c.mockURL(deviceID, durationSec), nil
 		}
 		// Try to proceed even if session fails, some firmwares might not need it?
@@ -36,10 +52,14 @@ func (c *Client) CaptureRecentVideo(deviceID string, durationSec int) (string, e
 		return "", err
 	}
 
-	_ = c.setSuperDownload(session, true)
-	list, err := c.getPlaybackList(session)
+	start = time.Now()
+	err = c.setSuperDownload(ctx, session, true)
+	c.observe(deviceID, "super_download", start, err)
+	start = time.Now()
+	list, err := c.getPlaybackList(ctx, session)
+	c.observe(deviceID, "playback_list", start, err)
 	if err != nil || len(list) == 0 {
-		if c.MockMode {
+		if c.MockMode && ctx.Err() == nil {
 			return c.mockURL(deviceID, durationSec), nil
 		}
 		if err != nil {
@@ -48,13 +68,7 @@ func (c *Client) CaptureRecentVideo(deviceID string, durationSec int) (string, e
 		return "", nil // Or error "no video found"
 	}
 
-	item := list[len(list)-1]
-	name := ""
-	if v, ok := item["name"].(string); ok && v != "" {
-		name = v
-	} else if v, ok := item["file"].(string); ok && v != "" {
-		name = v
-	}
+	name := clipName(list[len(list)-1])
 	if name == "" {
 		if c.MockMode {
 			return c.mockURL(deviceID, durationSec), nil
@@ -69,18 +83,131 @@ func (c *Client) CaptureRecentVideo(deviceID string, durationSec int) (string, e
 	return url, nil
 }
 
+// observe 记录一次设备命令的耗时和结果
+func (c *Client) observe(deviceID, command string, start time.Time, err error) {
+	c.Metrics.ObserveDevice(deviceID, command, time.Since(start), err)
+}
+
+// clipName 返回录像列表项中的文件名，不同固件使用 name 或 file 字段
+func clipName(item map[string]any) string {
+	if v, ok := item["name"].(string); ok && v != "" {
+		return v
+	}
+	v, _ := item["file"].(string)
+	return v
+}
+
+// Status 是设备的连接状态
+type Status struct {
+	BaseURL   string `json:"base_url"`
+	Reachable bool   `json:"reachable"`
+	Session   bool   `json:"session"` // 设备是否返回了会话，部分固件不需要会话
+	Clips     int    `json:"clips"`
+	Latest    string `json:"latest,omitempty"` // 最新录像的文件名
+	LatencyMS int64  `json:"latency_ms"`       // 会话请求的耗时
+	Error     string `json:"error,omitempty"`
+}
+
+// Status 请求会话并读取录像列表，用于检查设备是否可用。与 CaptureRecentVideo
+// 不同，失败时不会回退到模拟模式。
+func (c *Client) Status(ctx context.Context) Status {
+	st := Status{BaseURL: c.BaseURL}
+	start := time.Now()
+	session, err := c.getSession(ctx)
+	st.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	st.Reachable = true
+	st.Session = session != ""
+	list, err := c.getPlaybackList(ctx, session)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	st.Clips = len(list)
+	if len(list) > 0 {
+		st.Latest = clipName(list[len(list)-1])
+	}
+	return st
+}
+
+// Download 将 CaptureRecentVideo 返回的视频下载到 w，progress 可为 nil。
+// 与其它命令不同，下载不受 Client.Timeout 限制，只受 ctx 约束，因为
+// 通过行车记录仪 Wi-Fi 下载视频可能需要数分钟。
+func (c *Client) Download(ctx context.Context, deviceID, url string, w io.Writer, progress func(done, total int64)) (int64, error) {
+	if strings.HasPrefix(url, "ddpai://") {
+		return 0, ErrMockClip
+	}
+	start := time.Now()
+	n, err := c.download(ctx, url, w, progress)
+	c.observe(deviceID, "download", start, err)
+	c.Metrics.AddDownloadBytes(deviceID, n)
+	return n, err
+}
+
+func (c *Client) download(ctx context.Context, url string, w io.Writer, progress func(done, total int64)) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	hc := *c.Client
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("download failed: status %d", resp.StatusCode)
+	}
+
+	total := resp.ContentLength
+	var done int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return done, err
+			}
+			done += int64(n)
+			if progress != nil {
+				progress(done, total)
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return done, rerr
+		}
+	}
+	if total > 0 && done != total {
+		return done, fmt.Errorf("download truncated: got %d of %d bytes", done, total)
+	}
+	return done, nil
+}
+
 func (c *Client) mockURL(deviceID string, durationSec int) string {
 	return "ddpai://device/" + deviceID + "/clip?duration=" + strconv.Itoa(durationSec)
 }
 
-func (c *Client) getSession() (string, error) {
+func (c *Client) getSession(ctx context.Context) (string, error) {
 	u := c.BaseURL + "/cmd.cgi?cmd=API_SessionReq"
-	req, _ := http.NewRequest(http.MethodGet, u, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
 	resp, err := c.Client.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("session request failed: status %d", resp.StatusCode)
+	}
 	var m map[string]any
 	_ = json.NewDecoder(resp.Body).Decode(&m)
 	if v, ok := m["session"].(string); ok {
@@ -92,7 +219,7 @@ func (c *Client) getSession() (string, error) {
 	return "", nil
 }
 
-func (c *Client) setSuperDownload(session string, enable bool) error {
+func (c *Client) setSuperDownload(ctx context.Context, session string, enable bool) error {
 	val := "0"
 	if enable {
 		val = "1"
@@ -101,7 +228,10 @@ func (c *Client) setSuperDownload(session string, enable bool) error {
 	if session != "" {
 		u += "&session=" + session
 	}
-	req, _ := http.NewRequest(http.MethodGet, u, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
 	resp, err := c.Client.Do(req)
 	if err != nil {
 		return err
@@ -110,17 +240,23 @@ func (c *Client) setSuperDownload(session string, enable bool) error {
 	return nil
 }
 
-func (c *Client) getPlaybackList(session string) ([]map[string]any, error) {
+func (c *Client) getPlaybackList(ctx context.Context, session string) ([]map[string]any, error) {
 	u := c.BaseURL + "/cmd.cgi?cmd=API_PlaybackListReq"
 	if session != "" {
 		u += "&session=" + session
 	}
-	req, _ := http.NewRequest(http.MethodGet, u, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("playback list request failed: status %d", resp.StatusCode)
+	}
 
 	// Decode into interface{} to handle both array and object
 	var raw any
@@ -0,0 +1,263 @@
+// Package ddpaitest 提供一个模拟盯盯拍行车记录仪 HTTP 接口的假设备，
+// 用于测试和在没有实车的情况下演示完整的抓取流程。
+package ddpaitest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// 设备支持的命令
+const (
+	CmdSession       = "API_SessionReq"
+	CmdSuperDownload = "API_SuperDownloadReq"
+	CmdPlaybackList  = "API_PlaybackListReq"
+	CmdFileDownload  = "API_FileDownloadReq"
+)
+
+// ListShape 控制 API_PlaybackListReq 的返回格式，不同固件返回的结构不同。
+type ListShape int
+
+const (
+	// ListArray 直接返回数组: [{"name": ...}]
+	ListArray ListShape = iota
+	// ListObject 返回包裹对象: {"list": [{"name": ...}]}
+	ListObject
+)
+
+// File 是设备上的一个视频文件
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Failure 描述对某个命令注入的故障
+type Failure struct {
+	Status int           // 返回的 HTTP 状态码，0 表示 500
+	Body   string        // 原样返回的响应体，可用于构造非法 JSON
+	Delay  time.Duration // 响应前的延迟，可用于模拟超时
+	Times  int           // 生效次数，<= 0 表示一直生效
+}
+
+// Device 实现了盯盯拍 /cmd.cgi 接口的 http.Handler，可直接挂载到任意 HTTP 服务上做演示。
+type Device struct {
+	mu        sync.Mutex
+	session   string
+	shape     ListShape
+	nameKey   string
+	files     []File
+	failures  map[string]*Failure
+	calls     map[string]int
+	superDown bool
+}
+
+// NewDevice 创建一个带有一个样例视频文件的假设备
+func NewDevice() *Device {
+	return &Device{
+		session:  "fake-session",
+		nameKey:  "name",
+		failures: make(map[string]*Failure),
+		calls:    make(map[string]int),
+		files: []File{
+			{Name: "20240101120000_0010.mp4", Data: SampleClip()},
+		},
+	}
+}
+
+// SetSession 设置 API_SessionReq 返回的会话 ID，空字符串表示固件不返回会话
+func (d *Device) SetSession(session string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.session = session
+}
+
+// SetListShape 设置回放列表的返回格式
+func (d *Device) SetListShape(shape ListShape) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.shape = shape
+}
+
+// SetNameKey 设置回放列表中文件名字段的键名（"name" 或 "file"）
+func (d *Device) SetNameKey(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nameKey = key
+}
+
+// SetFiles 替换设备上的全部文件，按录制先后排序，最后一个为最新
+func (d *Device) SetFiles(files ...File) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.files = append([]File(nil), files...)
+}
+
+// Fail 为指定命令注入故障
+func (d *Device) Fail(cmd string, f Failure) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures[cmd] = &f
+}
+
+// Reset 清除全部注入的故障
+func (d *Device) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures = make(map[string]*Failure)
+}
+
+// Calls 返回指定命令被调用的次数
+func (d *Device) Calls(cmd string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls[cmd]
+}
+
+// SuperDownload 返回超级下载模式是否被打开
+func (d *Device) SuperDownload() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.superDown
+}
+
+func (d *Device) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/cmd.cgi" {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	cmd := q.Get("cmd")
+
+	d.mu.Lock()
+	d.calls[cmd]++
+	f := d.takeFailure(cmd)
+	session := d.session
+	d.mu.Unlock()
+
+	if f != nil {
+		if f.Delay > 0 {
+			select {
+			case <-time.After(f.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if f.Status != 0 || f.Body != "" {
+			status := f.Status
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(f.Body))
+			return
+		}
+	}
+
+	if cmd != CmdSession && session != "" && q.Get("session") != session {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"errcode": -1, "msg": "invalid session"})
+		return
+	}
+
+	switch cmd {
+	case CmdSession:
+		writeJSON(w, http.StatusOK, map[string]any{"errcode": 0, "session": session})
+	case CmdSuperDownload:
+		d.mu.Lock()
+		d.superDown = q.Get("enable") == "1"
+		d.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"errcode": 0})
+	case CmdPlaybackList:
+		d.servePlaybackList(w)
+	case CmdFileDownload:
+		d.serveFile(w, q.Get("file"))
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"errcode": -1, "msg": "unknown cmd"})
+	}
+}
+
+// takeFailure 取出当前命令的故障并消耗一次计数，调用方需持有锁
+func (d *Device) takeFailure(cmd string) *Failure {
+	f, ok := d.failures[cmd]
+	if !ok {
+		return nil
+	}
+	out := *f
+	if f.Times > 0 {
+		f.Times--
+		if f.Times == 0 {
+			delete(d.failures, cmd)
+		}
+	}
+	return &out
+}
+
+func (d *Device) servePlaybackList(w http.ResponseWriter) {
+	d.mu.Lock()
+	items := make([]map[string]any, 0, len(d.files))
+	for _, f := range d.files {
+		items = append(items, map[string]any{d.nameKey: f.Name, "size": len(f.Data)})
+	}
+	shape := d.shape
+	d.mu.Unlock()
+
+	if shape == ListObject {
+		writeJSON(w, http.StatusOK, map[string]any{"errcode": 0, "list": items})
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (d *Device) serveFile(w http.ResponseWriter, name string) {
+	d.mu.Lock()
+	var data []byte
+	for _, f := range d.files {
+		if f.Name == name {
+			data = f.Data
+			break
+		}
+	}
+	d.mu.Unlock()
+
+	if data == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"errcode": -1, "msg": "file not found"})
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp4")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// Server 是运行在本地回环地址上的假设备
+type Server struct {
+	*Device
+	*httptest.Server
+}
+
+// NewServer 启动一个假设备，调用方负责 Close
+func NewServer() *Server {
+	d := NewDevice()
+	return &Server{Device: d, Server: httptest.NewServer(d)}
+}
+
+// SampleClip 返回一段最小的 MP4 数据（ftyp + mdat），足以被识别为视频文件
+func SampleClip() []byte {
+	box := func(typ string, payload []byte) []byte {
+		b := make([]byte, 8, 8+len(payload))
+		binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+		copy(b[4:], typ)
+		return append(b, payload...)
+	}
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2avc1mp41"))
+	mdat := box("mdat", []byte("snapreport sample clip"))
+	return append(ftyp, mdat...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,152 @@
+// Package events 在进程内发布报告和任务的变更事件，并保留一段有限的历史，
+// 供断线重连的客户端按 Last-Event-ID 补发。事件 ID 从启动时刻（Unix 微秒）
+// 起递增，因此重启后的 ID 大于之前的所有 ID。
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	ReportCreated       = "report.created"
+	ReportUpdated       = "report.updated"
+	ReportStatusChanged = "report.status_changed"
+	ReportDeleted       = "report.deleted"
+	JobProgress         = "job.progress"
+
+	// StreamReset 表示请求的事件已不在历史中（被挤出或来自上一次启动），
+	// 客户端应重新获取当前状态
+	StreamReset = "stream.reset"
+)
+
+type Event struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	OrgID    string `json:"org_id,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+	Time     string `json:"time"`
+	Data     any    `json:"data"`
+}
+
+// Reset 是 StreamReset 事件的数据
+type Reset struct {
+	LastEventID int64 `json:"last_event_id"` // 客户端请求的位置
+	OldestID    int64 `json:"oldest_id"`     // 仍可补发的最早事件
+}
+
+// subscriberBuffer 是每个订阅者的缓冲区大小，写满时断开该订阅者，由客户端重连补发
+const subscriberBuffer = 64
+
+type subscriber struct {
+	ch     chan Event
+	filter func(Event) bool
+}
+
+// Bus 是一个带有环形历史的发布订阅总线
+type Bus struct {
+	mu     sync.Mutex
+	log    []Event
+	size   int
+	nextID int64
+	subs   map[*subscriber]struct{}
+}
+
+// NewBus 创建一个最多保留 size 条历史事件的总线
+func NewBus(size int) *Bus {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Bus{
+		size:   size,
+		nextID: time.Now().UnixMicro(),
+		subs:   make(map[*subscriber]struct{}),
+	}
+}
+
+// Publish 记录并广播一个事件。对 nil Bus 调用是安全的。
+func (b *Bus) Publish(typ, orgID, deviceID string, data any) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := Event{
+		ID:       b.nextID,
+		Type:     typ,
+		OrgID:    orgID,
+		DeviceID: deviceID,
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		Data:     data,
+	}
+	b.nextID++
+	b.log = append(b.log, e)
+	if len(b.log) > b.size {
+		b.log = b.log[len(b.log)-b.size:]
+	}
+	for s := range b.subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			delete(b.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// LastID 返回最近一个事件的 ID，没有事件时比第一个事件的 ID 小 1
+func (b *Bus) LastID() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nextID - 1
+}
+
+// Subscribe 返回历史中 ID 大于 lastID 且满足 filter 的事件，以及后续事件的通道。
+// lastID 为 0 时返回全部历史。lastID 之后的事件已不在历史中时，replay 以一个
+// StreamReset 事件开头，它不经过 filter。通道被关闭表示订阅者跟不上，需要
+// 重新订阅。调用方用完后必须调用 cancel。
+func (b *Bus) Subscribe(lastID int64, filter func(Event) bool) (replay []Event, ch <-chan Event, cancel func()) {
+	s := &subscriber{ch: make(chan Event, subscriberBuffer), filter: filter}
+	b.mu.Lock()
+	oldest := b.nextID
+	if len(b.log) > 0 {
+		oldest = b.log[0].ID
+	}
+	if lastID != 0 && (lastID < oldest-1 || lastID >= b.nextID) {
+		replay = append(replay, Event{
+			ID:   oldest - 1,
+			Type: StreamReset,
+			Time: time.Now().UTC().Format(time.RFC3339),
+			Data: Reset{LastEventID: lastID, OldestID: oldest},
+		})
+	}
+	for _, e := range b.log {
+		if e.ID > lastID && (filter == nil || filter(e)) {
+			replay = append(replay, e)
+		}
+	}
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[s]; ok {
+			delete(b.subs, s)
+			close(s.ch)
+		}
+	}
+	return replay, s.ch, cancel
+}
+
+// ForDevice 返回只匹配指定设备事件的过滤器，deviceID 为空时不过滤
+func ForDevice(deviceID string) func(Event) bool {
+	if deviceID == "" {
+		return nil
+	}
+	return func(e Event) bool { return e.DeviceID == deviceID }
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribeReplaysAfterLastID(t *testing.T) {
+	b := NewBus(3)
+	first := b.LastID() + 1
+	for i := 0; i < 5; i++ {
+		b.Publish(ReportCreated, "org", "dev1", i)
+	}
+	// 历史只保留最后 3 条
+	replay, _, cancel := b.Subscribe(first+2, nil)
+	defer cancel()
+	if len(replay) != 2 || replay[0].ID != first+3 || replay[1].ID != first+4 {
+		t.Fatalf("unexpected replay %+v", replay)
+	}
+	replay, _, cancel2 := b.Subscribe(0, nil)
+	defer cancel2()
+	if len(replay) != 3 || replay[0].ID != first+2 {
+		t.Fatalf("unexpected replay from start %+v", replay)
+	}
+}
+
+func TestSubscribeResetsWhenHistoryIsMissing(t *testing.T) {
+	old := NewBus(3)
+	old.Publish(ReportCreated, "org", "dev1", nil)
+	before := old.LastID()
+	time.Sleep(time.Millisecond) // 重启
+
+	b := NewBus(3)
+	if b.LastID() <= before {
+		t.Fatalf("IDs restart at %d after %d", b.LastID(), before)
+	}
+	first := b.LastID() + 1
+	for i := 0; i < 5; i++ {
+		b.Publish(ReportCreated, "org", "dev1", i)
+	}
+	for _, lastID := range []int64{before, first, first + 100} {
+		replay, _, cancel := b.Subscribe(lastID, ForDevice("other"))
+		cancel()
+		if len(replay) != 1 || replay[0].Type != StreamReset || replay[0].ID != first+1 {
+			t.Fatalf("lastID %d: unexpected replay %+v", lastID, replay)
+		}
+		if r := replay[0].Data.(Reset); r.LastEventID != lastID || r.OldestID != first+2 {
+			t.Fatalf("lastID %d: unexpected reset %+v", lastID, r)
+		}
+	}
+	// 恰好在历史开头之前时可以完整补发
+	replay, _, cancel := b.Subscribe(first+1, nil)
+	cancel()
+	if len(replay) != 3 || replay[0].Type == StreamReset {
+		t.Fatalf("unexpected replay %+v", replay)
+	}
+}
+func TestSubscribeFiltersByDevice(t *testing.T) {
+	b := NewBus(10)
+	b.Publish(ReportCreated, "org", "dev1", nil)
+	b.Publish(ReportCreated, "org", "dev2", nil)
+
+	replay, ch, cancel := b.Subscribe(0, ForDevice("dev2"))
+	defer cancel()
+	if len(replay) != 1 || replay[0].DeviceID != "dev2" {
+		t.Fatalf("unexpected replay %+v", replay)
+	}
+
+	b.Publish(JobProgress, "org", "dev1", nil)
+	b.Publish(JobProgress, "org", "dev2", nil)
+	e := <-ch
+	if e.DeviceID != "dev2" || e.ID != b.LastID() {
+		t.Fatalf("unexpected live event %+v", e)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBus(10)
+	_, ch, cancel := b.Subscribe(0, nil)
+	defer cancel()
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.Publish(JobProgress, "org", "dev1", i)
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("received %d events before close, want %d", n, subscriberBuffer)
+	}
+}
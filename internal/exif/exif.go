@@ -0,0 +1,242 @@
+// Package exif 从 JPEG 照片的 EXIF 中读取拍摄时间和 GPS 坐标，只实现
+// 附件入库所需的少数几个标签。
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNoExif 表示文件不是 JPEG 或不包含 EXIF
+var ErrNoExif = errors.New("no exif data")
+
+// Info 是从 EXIF 中读取的信息，缺失的字段为零值
+type Info struct {
+	Time      time.Time // 拍摄时间（DateTimeOriginal）
+	Latitude  float64   // WGS-84，南纬为负
+	Longitude float64   // WGS-84，西经为负
+	HasGPS    bool
+}
+
+const (
+	tagDateTime          = 0x0132
+	tagExifIFD           = 0x8769
+	tagGPSIFD            = 0x8825
+	tagDateTimeOriginal  = 0x9003
+	tagOffsetTimeOrig    = 0x9011
+	tagGPSLatitudeRef    = 0x0001
+	tagGPSLatitude       = 0x0002
+	tagGPSLongitudeRef   = 0x0003
+	tagGPSLongitude      = 0x0004
+	typeASCII            = 2
+	typeShort            = 3
+	typeLong             = 4
+	typeRational         = 5
+	maxSegment           = 64 << 10
+	exifTimeLayout       = "2006:01:02 15:04:05"
+	exifTimeOffsetLayout = "2006:01:02 15:04:05-07:00"
+)
+
+// Decode 读取 JPEG 的 EXIF。照片未记录时区（OffsetTimeOriginal）时，
+// 拍摄时间按 loc 解释。
+func Decode(r io.Reader, loc *time.Location) (Info, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return Info{}, ErrNoExif
+	}
+	for {
+		var m [4]byte
+		if _, err := io.ReadFull(br, m[:2]); err != nil || m[0] != 0xff {
+			return Info{}, ErrNoExif
+		}
+		// SOS 之后是图像数据，EXIF 一定在它之前
+		if m[1] == 0xda || m[1] == 0xd9 {
+			return Info{}, ErrNoExif
+		}
+		if _, err := io.ReadFull(br, m[2:]); err != nil {
+			return Info{}, ErrNoExif
+		}
+		n := int(binary.BigEndian.Uint16(m[2:])) - 2
+		if n < 0 {
+			return Info{}, ErrNoExif
+		}
+		if m[1] != 0xe1 || n > maxSegment {
+			if _, err := br.Discard(n); err != nil {
+				return Info{}, ErrNoExif
+			}
+			continue
+		}
+		seg := make([]byte, n)
+		if _, err := io.ReadFull(br, seg); err != nil {
+			return Info{}, ErrNoExif
+		}
+		if !bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			continue // 例如 XMP
+		}
+		return parseTIFF(seg[6:], loc)
+	}
+}
+
+type tiff struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+type entry struct {
+	typ   uint16
+	count uint32
+	value []byte // 值本身，已按偏移取出
+}
+
+func parseTIFF(b []byte, loc *time.Location) (Info, error) {
+	if len(b) < 8 {
+		return Info{}, ErrNoExif
+	}
+	t := tiff{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return Info{}, ErrNoExif
+	}
+	if t.order.Uint16(b[2:]) != 42 {
+		return Info{}, ErrNoExif
+	}
+
+	var info Info
+	ifd0 := t.ifd(t.order.Uint32(b[4:]))
+	taken := ifd0[tagDateTime].ascii()
+	offset := ""
+	if e, ok := ifd0[tagExifIFD]; ok {
+		exif := t.ifd(e.uint())
+		if v := exif[tagDateTimeOriginal].ascii(); v != "" {
+			taken = v
+		}
+		offset = exif[tagOffsetTimeOrig].ascii()
+	}
+	info.Time = parseTime(taken, offset, loc)
+
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		gps := t.ifd(e.uint())
+		lat, okLat := gps[tagGPSLatitude].degrees(t.order)
+		lng, okLng := gps[tagGPSLongitude].degrees(t.order)
+		if okLat && okLng {
+			if gps[tagGPSLatitudeRef].ascii() == "S" {
+				lat = -lat
+			}
+			if gps[tagGPSLongitudeRef].ascii() == "W" {
+				lng = -lng
+			}
+			info.Latitude, info.Longitude, info.HasGPS = lat, lng, true
+		}
+	}
+	return info, nil
+}
+
+// ifd 读取 offset 处的目录，越界的目录或条目被忽略。SHORT 和 LONG
+// 类型的值统一转换为大端 uint32，便于 entry.uint 读取。
+func (t tiff) ifd(offset uint32) map[uint16]entry {
+	out := map[uint16]entry{}
+	if uint64(offset)+2 > uint64(len(t.b)) {
+		return out
+	}
+	n := int(t.order.Uint16(t.b[offset:]))
+	p := int(offset) + 2
+	for i := 0; i < n && p+12 <= len(t.b); i, p = i+1, p+12 {
+		tag := t.order.Uint16(t.b[p:])
+		e := entry{typ: t.order.Uint16(t.b[p+2:]), count: t.order.Uint32(t.b[p+4:])}
+		size := uint64(e.count) * typeSize(e.typ)
+		switch {
+		case size == 0:
+			continue
+		case size <= 4:
+			e.value = t.b[p+8 : p+8+int(size)]
+		default:
+			off := uint64(t.order.Uint32(t.b[p+8:]))
+			if off+size > uint64(len(t.b)) {
+				continue
+			}
+			e.value = t.b[off : off+size]
+		}
+		switch e.typ {
+		case typeShort:
+			e.value = binary.BigEndian.AppendUint32(nil, uint32(t.order.Uint16(e.value)))
+		case typeLong:
+			e.value = binary.BigEndian.AppendUint32(nil, t.order.Uint32(e.value))
+		}
+		out[tag] = e
+	}
+	return out
+}
+
+func typeSize(typ uint16) uint64 {
+	switch typ {
+	case typeASCII:
+		return 1
+	case typeShort:
+		return 2
+	case typeLong:
+		return 4
+	case typeRational:
+		return 8
+	}
+	return 0
+}
+
+func (e entry) uint() uint32 {
+	if len(e.value) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(e.value)
+}
+
+func (e entry) ascii() string {
+	if e.typ != typeASCII {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+// degrees 将度、分、秒三个有理数换算为十进制度数
+func (e entry) degrees(order binary.ByteOrder) (float64, bool) {
+	if e.typ != typeRational || e.count < 3 {
+		return 0, false
+	}
+	var d [3]float64
+	for i := range d {
+		num := order.Uint32(e.value[i*8:])
+		den := order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		d[i] = float64(num) / float64(den)
+	}
+	return d[0] + d[1]/60 + d[2]/3600, true
+}
+
+func parseTime(v, offset string, loc *time.Location) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	if offset != "" {
+		if t, err := time.Parse(exifTimeOffsetLayout, v+offset); err == nil {
+			return t
+		}
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(exifTimeLayout, v, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,57 @@
+package exif_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"SnapReport/internal/exif"
+	"SnapReport/internal/exif/exiftest"
+)
+
+var cst = time.FixedZone("CST", 8*3600)
+
+func TestDecode(t *testing.T) {
+	for _, le := range []bool{false, true} {
+		img := exiftest.JPEG(exiftest.Photo{LittleEndian: le, Taken: "2024:05:01 08:30:00", Lat: 22.543096, Lng: -113.934528})
+		info, err := exif.Decode(bytes.NewReader(img), cst)
+		if err != nil {
+			t.Fatalf("little endian %v: decode: %v", le, err)
+		}
+		if want := time.Date(2024, 5, 1, 8, 30, 0, 0, cst); !info.Time.Equal(want) {
+			t.Fatalf("little endian %v: time = %v, want %v", le, info.Time, want)
+		}
+		if !info.HasGPS || math.Abs(info.Latitude-22.543096) > 1e-6 || math.Abs(info.Longitude+113.934528) > 1e-6 {
+			t.Fatalf("little endian %v: gps = %v %v %v", le, info.HasGPS, info.Latitude, info.Longitude)
+		}
+	}
+}
+
+func TestDecodeOffsetTime(t *testing.T) {
+	img := exiftest.JPEG(exiftest.Photo{Taken: "2024:05:01 08:30:00", Offset: "+02:00"})
+	info, err := exif.Decode(bytes.NewReader(img), cst)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := time.Date(2024, 5, 1, 6, 30, 0, 0, time.UTC); !info.Time.Equal(want) {
+		t.Fatalf("time = %v, want %v", info.Time, want)
+	}
+	if info.HasGPS {
+		t.Fatalf("unexpected gps")
+	}
+}
+
+func TestDecodeWithoutExif(t *testing.T) {
+	for _, b := range [][]byte{
+		nil,
+		[]byte("\x89PNG\r\n\x1a\n"),
+		{0xff, 0xd8, 0xff, 0xd9},
+		{0xff, 0xd8, 0xff, 0xe1, 0xff}, // 截断的段
+	} {
+		if _, err := exif.Decode(bytes.NewReader(b), cst); !errors.Is(err, exif.ErrNoExif) {
+			t.Fatalf("Decode(%x) = %v", b, err)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Package export 将报告逐条写出为 CSV、GeoJSON 或 KML，不在内存中缓存整个结果。
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"SnapReport/internal/model"
+)
+
+// 支持的导出格式
+const (
+	CSV     = "csv"
+	XLSXCSV = "xlsx" // 供 Excel 直接打开的 CSV：UTF-8 BOM、CRLF，并转义公式
+	GeoJSON = "geojson"
+	KML     = "kml"
+)
+
+// Formats 是支持的格式名称
+var Formats = []string{CSV, XLSXCSV, GeoJSON, KML}
+
+var ErrUnknownFormat = errors.New("format must be csv, xlsx, geojson or kml")
+
+// Writer 逐条写出报告，Close 写出结尾但不关闭底层 io.Writer
+type Writer interface {
+	Write(r model.Report) error
+	Close() error
+}
+
+// New 返回 format 格式的 Writer
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSV(w, false)
+	case XLSXCSV:
+		return newCSV(w, true)
+	case GeoJSON:
+		return &geoJSONWriter{w: w}, nil
+	case KML:
+		return newKML(w)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType 返回 format 的 MIME 类型和文件扩展名
+func ContentType(format string) (contentType, ext string) {
+	switch format {
+	case GeoJSON:
+		return "application/geo+json", ".geojson"
+	case KML:
+		return "application/vnd.google-earth.kml+xml", ".kml"
+	default:
+		return "text/csv; charset=utf-8", ".csv"
+	}
+}
+
+// columns 是 CSV 的列，各格式的属性使用相同的名称
+var columns = []string{
+	"id", "org_id", "device_id", "status", "timestamp", "occurred_at", "submitted_at",
+	"lat", "lng", "city", "road_name", "is_highway",
+	"violation_type", "violation_code", "description", "plate", "plate_color", "tags",
+	"video_url", "legal_hold",
+}
+
+// fields 返回与 columns 对应的值。标签用分号连接。
+func fields(r model.Report) []string {
+	var plate, plateColor string
+	if r.Vehicle != nil {
+		plate, plateColor = r.Vehicle.Plate, r.Vehicle.PlateColor
+	}
+	return []string{
+		r.ID, r.OrgID, r.DeviceID, r.Status, r.Timestamp, r.OccurredAt, r.SubmittedAt,
+		strconv.FormatFloat(r.Latitude, 'f', -1, 64), strconv.FormatFloat(r.Longitude, 'f', -1, 64),
+		r.City, r.RoadName, strconv.FormatBool(r.IsHighway),
+		r.ViolationType, r.ViolationCode, r.Description, plate, plateColor, strings.Join(r.Tags, ";"),
+		r.VideoURL, strconv.FormatBool(r.LegalHold),
+	}
+}
+
+// hasLocation 报告是否有坐标。(0, 0) 视为缺失。
+func hasLocation(r model.Report) bool {
+	return r.Latitude != 0 || r.Longitude != 0
+}
+
+type csvWriter struct {
+	w     *csv.Writer
+	excel bool
+}
+
+func newCSV(w io.Writer, excel bool) (*csvWriter, error) {
+	if excel {
+		// 没有 BOM 时 Excel 按本地编码解析，中文会乱码
+		if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+			return nil, err
+		}
+	}
+	c := &csvWriter{w: csv.NewWriter(w), excel: excel}
+	c.w.UseCRLF = excel
+	if err := c.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvWriter) Write(r model.Report) error {
+	row := fields(r)
+	if c.excel {
+		for i, v := range row {
+			row[i] = escapeFormula(v)
+		}
+	}
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	// 每行刷新，底层 Writer 是 HTTP 响应时逐行发送
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// escapeFormula 防止以 = + - @ 开头的文本被 Excel 当作公式执行。
+// 数字（如负的经度）不受影响。
+func escapeFormula(v string) string {
+	if v == "" || !strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return v
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return v
+	}
+	return "'" + v
+}
+
+type geoJSONWriter struct {
+	w io.Writer
+	n int
+}
+
+type feature struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Geometry   *point         `json:"geometry"` // 没有坐标时为 null
+	Properties map[string]any `json:"properties"`
+}
+
+type point struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"` // 经度在前
+}
+
+func (g *geoJSONWriter) Write(r model.Report) error {
+	prefix := ","
+	if g.n == 0 {
+		prefix = `{"type":"FeatureCollection","features":[`
+	}
+	f := feature{Type: "Feature", ID: r.ID, Properties: properties(r)}
+	if hasLocation(r) {
+		f.Geometry = &point{Type: "Point", Coordinates: [2]float64{r.Longitude, r.Latitude}}
+	}
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	g.n++
+	_, err = io.WriteString(g.w, prefix+string(b)+"\n")
+	return err
+}
+
+func (g *geoJSONWriter) Close() error {
+	if g.n == 0 {
+		_, err := io.WriteString(g.w, `{"type":"FeatureCollection","features":[]}`+"\n")
+		return err
+	}
+	_, err := io.WriteString(g.w, "]}\n")
+	return err
+}
+
+// properties 返回 GeoJSON 的属性，与 CSV 列相同，布尔值和标签保留 JSON 类型
+func properties(r model.Report) map[string]any {
+	p := make(map[string]any, len(columns))
+	for i, v := range fields(r) {
+		p[columns[i]] = v
+	}
+	delete(p, "lat")
+	delete(p, "lng")
+	p["is_highway"] = r.IsHighway
+	p["legal_hold"] = r.LegalHold
+	tags := r.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	p["tags"] = tags
+	return p
+}
+
+type kmlWriter struct {
+	w   io.Writer
+	enc *xml.Encoder
+}
+
+type placemark struct {
+	XMLName     xml.Name  `xml:"Placemark"`
+	ID          string    `xml:"id,attr"`
+	Name        string    `xml:"name"`
+	Description string    `xml:"description,omitempty"`
+	TimeStamp   string    `xml:"TimeStamp>when,omitempty"`
+	Data        []kmlData `xml:"ExtendedData>Data"`
+	Point       *kmlPoint `xml:"Point,omitempty"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+func newKML(w io.Writer) (*kmlWriter, error) {
+	_, err := io.WriteString(w, xml.Header+`<kml xmlns="http://www.opengis.net/kml/2.2"><Document><name>SnapReport</name>`+"\n")
+	if err != nil {
+		return nil, err
+	}
+	return &kmlWriter{w: w, enc: xml.NewEncoder(w)}, nil
+}
+
+func (k *kmlWriter) Write(r model.Report) error {
+	p := placemark{ID: r.ID, Name: placemarkName(r), Description: r.Description, TimeStamp: r.OccurredAt}
+	if p.TimeStamp == "" {
+		p.TimeStamp = r.Timestamp
+	}
+	for i, v := range fields(r) {
+		if v != "" {
+			p.Data = append(p.Data, kmlData{Name: columns[i], Value: v})
+		}
+	}
+	if hasLocation(r) {
+		p.Point = &kmlPoint{Coordinates: fmt.Sprintf("%s,%s",
+			strconv.FormatFloat(r.Longitude, 'f', -1, 64), strconv.FormatFloat(r.Latitude, 'f', -1, 64))}
+	}
+	if err := k.enc.Encode(p); err != nil {
+		return err
+	}
+	_, err := io.WriteString(k.w, "\n")
+	return err
+}
+
+func (k *kmlWriter) Close() error {
+	_, err := io.WriteString(k.w, "</Document></kml>\n")
+	return err
+}
+
+// placemarkName 是地图上显示的名称：违法类型和号牌，没有时使用道路或报告 ID
+func placemarkName(r model.Report) string {
+	var parts []string
+	if r.ViolationType != "" {
+		parts = append(parts, r.ViolationType)
+	}
+	if r.Vehicle != nil && r.Vehicle.Plate != "" {
+		parts = append(parts, r.Vehicle.Plate)
+	}
+	if len(parts) == 0 && r.RoadName != "" {
+		parts = append(parts, r.RoadName)
+	}
+	if len(parts) == 0 {
+		return r.ID
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,147 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"SnapReport/internal/model"
+)
+
+var reports = []model.Report{
+	{
+		ID: "rep_1", OrgID: "default", DeviceID: "dev1", Status: "submitted", Timestamp: "2024-05-01T08:00:00Z",
+		Latitude: 22.5431, Longitude: 113.9345, City: "深圳市", RoadName: "深南大道", IsHighway: false,
+		ViolationType: "running_red_light", Description: `闯红灯 "左转" <灯>`, Tags: []string{"red", "night"},
+		Vehicle: &model.Vehicle{Plate: "粤B12345", PlateColor: "blue"},
+	},
+	{ID: "rep_2", Status: "prepared", Timestamp: "2024-05-02T08:00:00Z", Description: "=HYPERLINK(\"x\")", Latitude: -33.5, Longitude: 0},
+	{ID: "rep_3", Status: "prepared", Timestamp: "2024-05-03T08:00:00Z", IsHighway: true},
+}
+
+func export(t *testing.T, format string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := New(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reports {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCSV(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(export(t, CSV))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || strings.Join(rows[0], ",") != strings.Join(columns, ",") {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+	got := map[string]string{}
+	for i, c := range columns {
+		got[c] = rows[1][i]
+	}
+	if got["city"] != "深圳市" || got["road_name"] != "深南大道" || got["is_highway"] != "false" ||
+		got["tags"] != "red;night" || got["status"] != "submitted" || got["plate"] != "粤B12345" || got["lat"] != "22.5431" {
+		t.Fatalf("unexpected fields: %v", got)
+	}
+	if rows[2][14] != `=HYPERLINK("x")` {
+		t.Fatalf("plain CSV should not alter values: %q", rows[2][14])
+	}
+}
+
+func TestXLSXCompatibleCSV(t *testing.T) {
+	out := export(t, XLSXCSV)
+	if !strings.HasPrefix(out, "\uFEFF") || !strings.Contains(out, "\r\n") {
+		t.Fatal("missing BOM or CRLF")
+	}
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(out, "\uFEFF"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[2][14] != `'=HYPERLINK("x")` || rows[2][7] != "-33.5" {
+		t.Fatalf("formula not escaped or number altered: %q %q", rows[2][14], rows[2][7])
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	var fc struct {
+		Type     string
+		Features []struct {
+			ID       string
+			Geometry *struct {
+				Type        string
+				Coordinates []float64
+			}
+			Properties map[string]any
+		}
+	}
+	if err := json.Unmarshal([]byte(export(t, GeoJSON)), &fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 3 {
+		t.Fatalf("unexpected collection: %+v", fc)
+	}
+	f := fc.Features[0]
+	if f.Geometry == nil || f.Geometry.Coordinates[0] != 113.9345 || f.Geometry.Coordinates[1] != 22.5431 {
+		t.Fatalf("coordinates must be [lng, lat]: %+v", f.Geometry)
+	}
+	if f.Properties["city"] != "深圳市" || f.Properties["is_highway"] != false || len(f.Properties["tags"].([]any)) != 2 {
+		t.Fatalf("unexpected properties: %v", f.Properties)
+	}
+	if fc.Features[2].Geometry != nil {
+		t.Fatal("report without location should have null geometry")
+	}
+
+	var buf bytes.Buffer
+	w, _ := New(GeoJSON, &buf)
+	w.Close()
+	if err := json.Unmarshal(buf.Bytes(), &fc); err != nil || len(fc.Features) != 0 {
+		t.Fatalf("empty export = %q", buf.String())
+	}
+}
+
+func TestKML(t *testing.T) {
+	var doc struct {
+		Placemarks []struct {
+			ID          string `xml:"id,attr"`
+			Name        string `xml:"name"`
+			Description string `xml:"description"`
+			Coordinates string `xml:"Point>coordinates"`
+			Data        []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:"value"`
+			} `xml:"ExtendedData>Data"`
+		} `xml:"Document>Placemark"`
+	}
+	if err := xml.Unmarshal([]byte(export(t, KML)), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Placemarks) != 3 {
+		t.Fatalf("got %d placemarks", len(doc.Placemarks))
+	}
+	p := doc.Placemarks[0]
+	if p.Name != "running_red_light 粤B12345" || p.Description != reports[0].Description || p.Coordinates != "113.9345,22.5431" {
+		t.Fatalf("unexpected placemark: %+v", p)
+	}
+	if doc.Placemarks[2].Name != "rep_3" || doc.Placemarks[2].Coordinates != "" {
+		t.Fatalf("unexpected placemark without location: %+v", doc.Placemarks[2])
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New("pdf", &bytes.Buffer{}); err != ErrUnknownFormat {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
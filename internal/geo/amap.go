@@ -1,6 +1,7 @@
 package geo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -17,7 +18,7 @@ type AMapGeocoder struct {
 func NewAMapGeocoder(apiKey string) *AMapGeocoder {
 	return &AMapGeocoder{
 		APIKey: apiKey,
-		Client: &http.Client{},
+		Client: &http.Client{Timeout: DefaultTimeout},
 	}
 }
 
@@ -86,7 +87,7 @@ type AMapReverseGeocodeResponse struct {
 }
 
 // ReverseGeocode 实现 Geocoder 接口
-func (g *AMapGeocoder) ReverseGeocode(lat, lng float64) (string, string, string, error) {
+func (g *AMapGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, string, string, error) {
 	// 构造请求URL
 	baseURL := "https://restapi.amap.com/v3/geocode/regeo"
 	params := url.Values{}
@@ -97,7 +98,11 @@ func (g *AMapGeocoder) ReverseGeocode(lat, lng float64) (string, string, string,
 	params.Set("roadlevel", "1") // 返回道路信息
 
 	reqURL := baseURL + "?" + params.Encode()
-	resp, err := g.Client.Get(reqURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return "", "", "", fmt.Errorf("build request failed: %w", err)
+	}
+	resp, err := g.Client.Do(req)
 	if err != nil {
 		return "", "", "", fmt.Errorf("request failed: %w", err)
 	}
@@ -0,0 +1,14 @@
+package geo
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	// 纬度相差 0.001 度约 111 米
+	d := Distance(22.5000, 113.9500, 22.5010, 113.9500)
+	if d < 110 || d > 112 {
+		t.Fatalf("Distance = %.1f, want ~111m", d)
+	}
+	if Distance(22.5, 113.95, 22.5, 113.95) != 0 {
+		t.Fatalf("distance to self is not zero")
+	}
+}
@@ -0,0 +1,21 @@
+package geo
+
+import "fmt"
+
+// New 按类型创建地理编码器："amap" 需要 apiKey，"nominatim" 或空字符串使用 userAgent
+func New(typ, apiKey, userAgent string) (Geocoder, error) {
+	switch typ {
+	case "amap":
+		if apiKey == "" {
+			return nil, fmt.Errorf("amap geocoder requires api key")
+		}
+		return NewAMapGeocoder(apiKey), nil
+	case "", "nominatim":
+		if userAgent == "" {
+			userAgent = "SnapReport/1.0"
+		}
+		return NewNominatimGeocoder(userAgent), nil
+	default:
+		return nil, fmt.Errorf("unknown geocoder type %q", typ)
+	}
+}
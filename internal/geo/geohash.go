@@ -0,0 +1,78 @@
+package geo
+
+import (
+	"errors"
+	"strings"
+)
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// MaxGeohashPrecision 是 Geohash 支持的最大长度，12 位约为 3.7cm × 1.9cm
+const MaxGeohashPrecision = 12
+
+var ErrInvalidGeohash = errors.New("invalid geohash")
+
+// Geohash 返回坐标的 geohash，precision 为字符数（1-12）。
+// 6 位的格子约为 1.2km × 0.6km，7 位约为 150m × 150m。
+func Geohash(lat, lng float64, precision int) string {
+	if precision < 1 {
+		precision = 1
+	}
+	if precision > MaxGeohashPrecision {
+		precision = MaxGeohashPrecision
+	}
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	var b strings.Builder
+	bit, ch, even := 0, 0, true
+	for b.Len() < precision {
+		r, v := &latRange, lat
+		if even {
+			r, v = &lngRange, lng
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if v >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+		if bit++; bit == 5 {
+			b.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return b.String()
+}
+
+// GeohashBounds 返回 geohash 格子的范围
+func GeohashBounds(hash string) (minLat, minLng, maxLat, maxLng float64, err error) {
+	if hash == "" || len(hash) > MaxGeohashPrecision {
+		return 0, 0, 0, 0, ErrInvalidGeohash
+	}
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	even := true
+	for i := 0; i < len(hash); i++ {
+		v := strings.IndexByte(geohashAlphabet, hash[i])
+		if v < 0 {
+			return 0, 0, 0, 0, ErrInvalidGeohash
+		}
+		for shift := 4; shift >= 0; shift-- {
+			r := &latRange
+			if even {
+				r = &lngRange
+			}
+			mid := (r[0] + r[1]) / 2
+			if v>>shift&1 == 1 {
+				r[0] = mid
+			} else {
+				r[1] = mid
+			}
+			even = !even
+		}
+	}
+	return latRange[0], lngRange[0], latRange[1], lngRange[1], nil
+}
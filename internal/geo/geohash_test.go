@@ -0,0 +1,37 @@
+package geo
+
+import "testing"
+
+func TestGeohash(t *testing.T) {
+	for _, tc := range []struct {
+		lat, lng  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"}, // Wikipedia 中的示例
+		{22.5431, 113.9345, 6, "ws100x"},
+		{-33.8688, 151.2093, 5, "r3gx2"},
+		{0, 0, 1, "s"},
+	} {
+		if got := Geohash(tc.lat, tc.lng, tc.precision); got != tc.want {
+			t.Errorf("Geohash(%v, %v, %d) = %s, want %s", tc.lat, tc.lng, tc.precision, got, tc.want)
+		}
+	}
+}
+
+func TestGeohashBounds(t *testing.T) {
+	hash := Geohash(22.5431, 113.9345, 7)
+	minLat, minLng, maxLat, maxLng, err := GeohashBounds(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minLat > 22.5431 || maxLat < 22.5431 || minLng > 113.9345 || maxLng < 113.9345 {
+		t.Fatalf("bounds of %s do not contain the point: %v %v %v %v", hash, minLat, minLng, maxLat, maxLng)
+	}
+	if d := Distance(minLat, minLng, minLat, maxLng); d < 100 || d > 200 {
+		t.Fatalf("7-character cell is %.0fm wide, want ~140m", d)
+	}
+	if _, _, _, _, err := GeohashBounds("ws10a"); err != ErrInvalidGeohash {
+		t.Fatalf("expected ErrInvalidGeohash for 'a', got %v", err)
+	}
+}
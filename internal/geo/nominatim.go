@@ -1,14 +1,19 @@
 package geo
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 )
 
+// DefaultTimeout 是地理编码 HTTP 客户端的兜底超时，调用方可通过 context 设置更短的期限
+const DefaultTimeout = 10 * time.Second
+
 type Geocoder interface {
-	ReverseGeocode(lat, lng float64) (city, road, category string, err error)
+	ReverseGeocode(ctx context.Context, lat, lng float64) (city, road, category string, err error)
 	Provider() string
 }
 
@@ -28,6 +33,7 @@ func NewNominatimGeocoder(userAgent string) *NominatimGeocoder {
 	}
 	client := &http.Client{
 		Transport: transport,
+		Timeout:   DefaultTimeout,
 		// 防止自动重定向到HTTP，保持HTTPS连接
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// 如果重定向到HTTP，返回错误以保持HTTPS
@@ -43,7 +49,7 @@ func NewNominatimGeocoder(userAgent string) *NominatimGeocoder {
 	}
 }
 
-func (g *NominatimGeocoder) ReverseGeocode(lat, lng float64) (string, string, string, error) {
+func (g *NominatimGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, string, string, error) {
 	type nominatimResp struct {
 		Address struct {
 			City          string `json:"city"`
@@ -59,7 +65,10 @@ func (g *NominatimGeocoder) ReverseGeocode(lat, lng float64) (string, string, st
 	}
 	url := "https://nominatim.openstreetmap.org/reverse?format=jsonv2&lat=" +
 		strconv.FormatFloat(lat, 'f', 6, 64) + "&lon=" + strconv.FormatFloat(lng, 'f', 6, 64)
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", "", err
+	}
 	req.Header.Set("User-Agent", g.UserAgent)
 	resp, err := g.Client.Do(req)
 	if err != nil {
@@ -0,0 +1,121 @@
+// Package idempotency 记录带 Idempotency-Key 的请求的首次响应，使客户端
+// 在网络不稳定时可以安全地重试非幂等请求。
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInProgress 表示同一个 key 的请求仍在处理中
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+	// ErrMismatch 表示同一个 key 被用于内容不同的请求
+	ErrMismatch = errors.New("idempotency key reused with a different request")
+)
+
+// Response 是保存下来用于重放的响应
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	fingerprint string
+	created     time.Time
+	done        bool
+	resp        Response
+}
+
+// Cache 在 Window 内保存每个 key 的首次响应
+type Cache struct {
+	Window time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func New(window time.Duration) *Cache {
+	return &Cache{
+		Window:  window,
+		entries: make(map[string]*entry),
+		now:     time.Now,
+	}
+}
+
+// Begin 登记一个请求。key 已有完成的响应时返回该响应供重放；返回
+// (nil, nil) 时调用方获得该 key，处理完成后必须调用 Complete 或 Release。
+func (c *Cache) Begin(key, fingerprint string) (*Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.sweep(now)
+
+	e, ok := c.entries[key]
+	if ok && now.Sub(e.created) >= c.Window {
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.entries[key] = &entry{fingerprint: fingerprint, created: now}
+		return nil, nil
+	}
+	if e.fingerprint != fingerprint {
+		return nil, ErrMismatch
+	}
+	if !e.done {
+		return nil, ErrInProgress
+	}
+	resp := e.resp
+	resp.Header = e.resp.Header.Clone()
+	return &resp, nil
+}
+
+// Complete 保存 key 的响应，之后的重试将重放该响应
+func (c *Cache) Complete(key string, resp Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.done = true
+		e.resp = resp
+	}
+}
+
+// Release 放弃 key 而不保存响应，例如请求因临时错误失败，允许客户端重试
+func (c *Cache) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok && !e.done {
+		delete(c.entries, key)
+	}
+}
+
+// sweep 定期清理过期的 key，调用方须持有锁
+func (c *Cache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.Window/10 {
+		return
+	}
+	c.lastSweep = now
+	for k, e := range c.entries {
+		if e.done && now.Sub(e.created) >= c.Window {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Fingerprint 计算请求内容的摘要，用于识别同一个 key 下不同的请求
+func Fingerprint(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
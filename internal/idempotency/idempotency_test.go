@@ -0,0 +1,50 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReplayAndMismatch(t *testing.T) {
+	c := New(time.Hour)
+	fp := Fingerprint([]byte(`{"id":"rep_1"}`))
+
+	if resp, err := c.Begin("k1", fp); resp != nil || err != nil {
+		t.Fatalf("first Begin = %v, %v", resp, err)
+	}
+	if _, err := c.Begin("k1", fp); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("expected ErrInProgress, got %v", err)
+	}
+	c.Complete("k1", Response{Status: 200, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{}`)})
+
+	resp, err := c.Begin("k1", fp)
+	if err != nil || resp == nil || resp.Status != 200 || string(resp.Body) != "{}" {
+		t.Fatalf("replay = %+v, %v", resp, err)
+	}
+	if _, err := c.Begin("k1", Fingerprint([]byte(`{"id":"rep_2"}`))); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+}
+
+func TestReleaseAndExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := New(time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Begin("k", "a")
+	c.Release("k")
+	if resp, err := c.Begin("k", "b"); resp != nil || err != nil {
+		t.Fatalf("released key not reusable: %v, %v", resp, err)
+	}
+	c.Complete("k", Response{Status: 201})
+
+	now = now.Add(time.Minute)
+	if resp, err := c.Begin("k", "c"); resp != nil || err != nil {
+		t.Fatalf("expired key not reusable: %v, %v", resp, err)
+	}
+	if len(c.entries) != 1 {
+		t.Fatalf("expired entries not swept: %d", len(c.entries))
+	}
+}
@@ -0,0 +1,209 @@
+// Package ids 生成带前缀、按时间排序且不会冲突的 ID，例如
+// "rep_01j0c8y7k2m6v3q9x4t5w8z1ab"。
+//
+// 前缀之后是 26 个 Crockford base32 字符（小写），编码 128 位：高 48 位是
+// 毫秒时间戳，其余 80 位随机。同一毫秒内生成的 ID 在上一个 ID 的随机部分
+// 上加一，因此同一个生成器产生的 ID 严格递增。多实例部署时可以为每个实例
+// 分配节点号，节点号占用随机部分的高 16 位，不同节点的 ID 一定不同。
+//
+// 旧版本使用前缀加 base36 纳秒时间戳作为 ID，Valid 和 Time 仍然接受这种格式。
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Len 是前缀之后的 ID 长度
+const Len = 26
+
+const alphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+var decoding [256]byte
+
+func init() {
+	for i := range decoding {
+		decoding[i] = 0xff
+	}
+	for i, c := range alphabet {
+		decoding[c] = byte(i)
+		decoding[strings.ToUpper(string(c))[0]] = byte(i)
+	}
+}
+
+// Generator 生成单调递增的 ID，可以并发使用
+type Generator struct {
+	mu     sync.Mutex
+	node   uint16
+	scoped bool
+	lastMs uint64
+	last   [10]byte // 上一个 ID 的随机部分
+	now    func() time.Time
+}
+
+// NewGenerator 返回不区分节点的生成器
+func NewGenerator() *Generator {
+	return &Generator{now: time.Now}
+}
+
+// NewNodeGenerator 返回节点号为 node 的生成器，多实例部署时每个实例使用不同的节点号
+func NewNodeGenerator(node uint16) *Generator {
+	return &Generator{node: node, scoped: true, now: time.Now}
+}
+
+var defaultGenerator atomic.Pointer[Generator]
+
+func init() {
+	defaultGenerator.Store(NewGenerator())
+}
+
+// SetNode 为包级 New 设置节点号，应在生成任何 ID 之前调用。
+// 与 New 并发调用是安全的。
+func SetNode(node uint16) {
+	defaultGenerator.Store(NewNodeGenerator(node))
+}
+
+// New 使用包级生成器生成带前缀的 ID
+func New(prefix string) string {
+	return defaultGenerator.Load().New(prefix)
+}
+
+// New 生成带前缀的 ID
+func (g *Generator) New(prefix string) string {
+	var b [16]byte
+	g.mu.Lock()
+	ms := uint64(g.now().UnixMilli())
+	if ms <= g.lastMs {
+		// 同一毫秒或时钟回拨：沿用上一个时间戳并递增随机部分
+		ms = g.lastMs
+		tail := g.last[:]
+		if g.scoped {
+			tail = g.last[2:] // 节点号不参与进位
+		}
+		if !increment(tail) {
+			ms++
+			g.fill()
+		}
+	} else {
+		g.fill()
+	}
+	g.lastMs = ms
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+	copy(b[6:], g.last[:])
+	g.mu.Unlock()
+	return prefix + encode(b)
+}
+
+// fill 重新生成随机部分。节点号占用高 16 位；随机数的最高位置零，
+// 为同一毫秒内的递增留出空间。
+func (g *Generator) fill() {
+	if _, err := rand.Read(g.last[:]); err != nil {
+		panic("ids: crypto/rand unavailable: " + err.Error())
+	}
+	if g.scoped {
+		binary.BigEndian.PutUint16(g.last[:2], g.node)
+		g.last[2] &= 0x7f
+	} else {
+		g.last[0] &= 0x7f
+	}
+}
+
+// increment 将 b 作为大端整数加一，溢出时返回 false
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func encode(b [16]byte) string {
+	var out [Len]byte
+	// 128 位按 5 位一组编码，最高的一组只有 3 位
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	for i := Len - 1; i >= 0; i-- {
+		out[i] = alphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+func decode(s string) (b [16]byte, ok bool) {
+	if len(s) != Len || decoding[s[0]] > 7 {
+		return b, false
+	}
+	var hi, lo uint64
+	for i := 0; i < Len; i++ {
+		v := decoding[s[i]]
+		if v == 0xff {
+			return b, false
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	binary.BigEndian.PutUint64(b[:8], hi)
+	binary.BigEndian.PutUint64(b[8:], lo)
+	return b, true
+}
+
+// Valid 判断 s 是否为带 prefix 的 ID，包括旧版本的 base36 时间戳 ID
+func Valid(prefix, s string) bool {
+	rest, ok := strings.CutPrefix(s, prefix)
+	if !ok {
+		return false
+	}
+	if _, ok := decode(rest); ok {
+		return true
+	}
+	return legacy(rest) > 0
+}
+
+// Time 返回 ID 中的时间，s 可以带 "rep_" 这样的前缀。旧版本 ID 返回其纳秒时间戳。
+func Time(s string) (time.Time, bool) {
+	if i := strings.LastIndexByte(s, '_'); i >= 0 {
+		s = s[i+1:]
+	}
+	if b, ok := decode(s); ok {
+		ms := uint64(b[0])<<40 | uint64(b[1])<<32 | uint64(binary.BigEndian.Uint32(b[2:6]))
+		return time.UnixMilli(int64(ms)).UTC(), true
+	}
+	if n := legacy(s); n > 0 {
+		return time.Unix(0, n).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// legacyLen 是旧版本 ID 的长度：1974 年到 2119 年之间的纳秒时间戳用 base36
+// 表示都是 12 个字符
+const legacyLen = 12
+
+// legacyEpoch 之前不可能生成过旧版本 ID
+var legacyEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// legacy 解析旧版本的 base36 纳秒时间戳，无法解析时返回 0。只接受长度正好
+// 为 legacyLen、时间在 legacyEpoch 与当前时间之后一天之间的小写字符串，
+// 避免把任意短字符串当作旧 ID。
+func legacy(s string) int64 {
+	if len(s) != legacyLen || s != strings.ToLower(s) {
+		return 0
+	}
+	n, err := strconv.ParseInt(s, 36, 64)
+	if err != nil {
+		return 0
+	}
+	if n < legacyEpoch.UnixNano() || n > time.Now().Add(24*time.Hour).UnixNano() {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,138 @@
+package ids
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+func TestUniqueUnderConcurrency(t *testing.T) {
+	const workers, perWorker = 64, 2000
+	g := NewGenerator()
+	out := make([][]string, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				out[w] = append(out[w], g.New("rep_"))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, workers*perWorker)
+	for _, list := range out {
+		for i, id := range list {
+			if seen[id] {
+				t.Fatalf("duplicate id %s", id)
+			}
+			seen[id] = true
+			// 每个 goroutine 看到的 ID 严格递增
+			if i > 0 && id <= list[i-1] {
+				t.Fatalf("ids not increasing: %s after %s", id, list[i-1])
+			}
+			if !Valid("rep_", id) {
+				t.Fatalf("generated id %s not valid", id)
+			}
+		}
+	}
+}
+
+func TestNodesNeverCollide(t *testing.T) {
+	// 两个节点使用同一个停止的时钟，所有 ID 都落在同一毫秒
+	fixed := func() time.Time { return time.UnixMilli(1700000000000) }
+	a, b := NewNodeGenerator(1), NewNodeGenerator(2)
+	a.now, b.now = fixed, fixed
+	seen := map[string]bool{}
+	for i := 0; i < 10000; i++ {
+		for _, g := range []*Generator{a, b} {
+			id := g.New("")
+			if seen[id] {
+				t.Fatalf("duplicate id %s", id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestSortableByTime(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	g := NewGenerator()
+	g.now = func() time.Time { return now }
+	var list []string
+	for i := 0; i < 1000; i++ {
+		if i%10 == 0 {
+			now = now.Add(time.Millisecond)
+		}
+		list = append(list, g.New("job_"))
+	}
+	if !sort.StringsAreSorted(list) {
+		t.Fatalf("ids not sorted by creation time")
+	}
+
+	// 时钟回拨后仍然递增
+	last := list[len(list)-1]
+	now = now.Add(-time.Second)
+	if id := g.New("job_"); id <= last {
+		t.Fatalf("id %s not after %s after clock moved backwards", id, last)
+	}
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	f := func(ms uint32) bool {
+		at := time.UnixMilli(int64(ms) * 1000)
+		g := NewGenerator()
+		g.now = func() time.Time { return at }
+		got, ok := Time(g.New("rep_"))
+		return ok && got.Equal(at)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyIDs(t *testing.T) {
+	at := time.Date(2024, 5, 1, 8, 30, 0, 123456789, time.UTC)
+	old := "rep_" + strconv.FormatInt(at.UnixNano(), 36)
+	if !Valid("rep_", old) {
+		t.Fatalf("legacy id %s rejected", old)
+	}
+	if got, ok := Time(old); !ok || !got.Equal(at) {
+		t.Fatalf("Time(%s) = %v, %v", old, got, ok)
+	}
+	for _, bad := range []string{"", "rep_", "job_01j0c8y7k2m6v3q9x4t5w8z1ab", "rep_81j0c8y7k2m6v3q9x4t5w8z1ab", "rep_not-an-id", "rep_ABC",
+		"rep_abc", "rep_report", // 长度不对
+		"rep_" + strconv.FormatInt(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(), 36), // 早于旧格式
+		"rep_" + strconv.FormatInt(time.Now().Add(48*time.Hour).UnixNano(), 36),                // 未来时间
+		"rep_zzzzzzzzzzzz"} {
+		if Valid("rep_", bad) {
+			t.Fatalf("Valid accepted %q", bad)
+		}
+	}
+}
+
+func TestSetNodeWhileGenerating(t *testing.T) {
+	defer defaultGenerator.Store(NewGenerator())
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if id := New("rep_"); !Valid("rep_", id) {
+					t.Errorf("invalid id %s", id)
+					return
+				}
+			}
+		}()
+	}
+	for n := uint16(1); n <= 100; n++ {
+		SetNode(n)
+	}
+	wg.Wait()
+}
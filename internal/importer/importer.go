@@ -0,0 +1,230 @@
+// Package importer 解析批量导入的报告文件：带表头的 CSV（列名与导出相同）
+// 和每行一个报告 JSON 的 JSON Lines。这里只做格式层面的解析和规范化，
+// 字段校验由 service 完成。
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"SnapReport/internal/model"
+)
+
+// 支持的导入格式
+const (
+	CSV   = "csv"
+	JSONL = "jsonl"
+)
+
+var ErrUnknownFormat = errors.New("format must be csv or jsonl")
+
+// Record 是文件中的一份报告。Err 不为 nil 时该行无法解析，Report 不完整。
+type Record struct {
+	Line   int // 从 1 开始，CSV 的表头为第 1 行
+	Report model.Report
+	Err    error
+}
+
+// maxLine 是 JSON Lines 单行的最大长度
+const maxLine = 1 << 20
+
+// localTime 是表格中不带时区的时间所在的时区（北京时间）
+var localTime = time.FixedZone("UTC+8", 8*3600)
+
+// Decode 逐行解析 r 并对每份报告调用 fn，fn 返回错误时停止。
+// 单行解析失败不会中断，而是以 Record.Err 交给 fn；只有读取失败或表头
+// 无效时返回错误。
+func Decode(format string, r io.Reader, fn func(Record) error) error {
+	switch format {
+	case CSV:
+		return decodeCSV(r, fn)
+	case JSONL:
+		return decodeJSONL(r, fn)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// aliases 将表格中常见的列名映射为导出使用的列名
+var aliases = map[string]string{
+	"latitude":  "lat",
+	"longitude": "lng",
+	"lon":       "lng",
+	"road":      "road_name",
+	"highway":   "is_highway",
+	"time":      "timestamp",
+}
+
+func decodeCSV(r io.Reader, fn func(Record) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\uFEFF")))
+		if a, ok := aliases[h]; ok {
+			h = a
+		}
+		cols[h] = i
+	}
+	if _, ok := cols["device_id"]; !ok {
+		return errors.New("header: device_id column required")
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			if err := fn(Record{Line: perr.StartLine, Err: perr.Err}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		get := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		line, _ := cr.FieldPos(0)
+		rec := Record{Line: line}
+		rec.Report, rec.Err = reportFromCSV(get)
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func reportFromCSV(get func(string) string) (model.Report, error) {
+	r := model.Report{
+		ID:            get("id"),
+		OrgID:         get("org_id"),
+		DeviceID:      get("device_id"),
+		Status:        get("status"),
+		City:          get("city"),
+		RoadName:      get("road_name"),
+		ViolationType: get("violation_type"),
+		Description:   get("description"),
+		VideoURL:      get("video_url"),
+	}
+	var err error
+	for _, f := range []struct {
+		name string
+		dst  *string
+	}{{"timestamp", &r.Timestamp}, {"occurred_at", &r.OccurredAt}, {"submitted_at", &r.SubmittedAt}} {
+		if *f.dst, err = ParseTime(get(f.name)); err != nil {
+			return r, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	for _, f := range []struct {
+		name string
+		dst  *float64
+	}{{"lat", &r.Latitude}, {"lng", &r.Longitude}} {
+		if v := get(f.name); v != "" {
+			if *f.dst, err = strconv.ParseFloat(v, 64); err != nil {
+				return r, fmt.Errorf("%s: invalid number %q", f.name, v)
+			}
+		}
+	}
+	if r.IsHighway, err = parseBool(get("is_highway")); err != nil {
+		return r, fmt.Errorf("is_highway: %w", err)
+	}
+	if v := get("tags"); v != "" {
+		for _, t := range strings.FieldsFunc(v, func(c rune) bool { return c == ';' || c == ',' }) {
+			if t = strings.TrimSpace(t); t != "" {
+				r.Tags = append(r.Tags, t)
+			}
+		}
+	}
+	if plate, color := get("plate"), get("plate_color"); plate != "" || color != "" {
+		r.Vehicle = &model.Vehicle{Plate: plate, PlateColor: color}
+	}
+	return r, nil
+}
+
+func decodeJSONL(r io.Reader, fn func(Record) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), maxLine)
+	for line := 1; sc.Scan(); line++ {
+		b := sc.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		rec := Record{Line: line}
+		if err := json.Unmarshal(b, &rec.Report); err != nil {
+			rec.Err = err
+		} else {
+			rec.Err = normalizeTimes(&rec.Report)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func normalizeTimes(r *model.Report) error {
+	var err error
+	for _, f := range []struct {
+		name string
+		dst  *string
+	}{{"timestamp", &r.Timestamp}, {"occurred_at", &r.OccurredAt}, {"submitted_at", &r.SubmittedAt}} {
+		if *f.dst, err = ParseTime(*f.dst); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// timeLayouts 是表格中常见的不带时区的时间格式，按北京时间解释
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"2006/1/2 15:04",
+	"2006-01-02T15:04:05",
+}
+
+// ParseTime 将 RFC3339 或常见的表格时间格式规范化为 UTC RFC3339，空字符串保持不变
+func ParseTime(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC().Format(time.RFC3339), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, localTime); err == nil {
+			return t.UTC().Format(time.RFC3339), nil
+		}
+	}
+	return "", fmt.Errorf("invalid time %q", s)
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "", "0", "false", "no", "n", "否":
+		return false, nil
+	case "1", "true", "yes", "y", "是":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
@@ -0,0 +1,78 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func decodeAll(t *testing.T, format, input string) []Record {
+	t.Helper()
+	var out []Record
+	if err := Decode(format, strings.NewReader(input), func(r Record) error {
+		out = append(out, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestDecodeCSV(t *testing.T) {
+	input := "\uFEFFDevice_ID,Latitude,Longitude,time,city,road,highway,tags,plate,notes\n" +
+		"dev1,22.5431,113.9345,2024-05-01 08:30,深圳市,深南大道,是,\"red; night\",粤b12345,ignored\n" +
+		"dev2,not-a-number,113,2024-05-01T00:00:00Z,,,,,,\n" +
+		"dev3,22,113,yesterday,,,,,,\n" +
+		"dev4,22,113,2024-05-01T08:00:00+08:00,,,no,,,\n"
+	recs := decodeAll(t, CSV, input)
+	if len(recs) != 4 {
+		t.Fatalf("got %d records", len(recs))
+	}
+	r := recs[0].Report
+	if recs[0].Err != nil || recs[0].Line != 2 || r.DeviceID != "dev1" || r.Latitude != 22.5431 || r.Longitude != 113.9345 ||
+		r.Timestamp != "2024-05-01T00:30:00Z" || r.City != "深圳市" || r.RoadName != "深南大道" || !r.IsHighway ||
+		len(r.Tags) != 2 || r.Tags[1] != "night" || r.Vehicle == nil || r.Vehicle.Plate != "粤b12345" {
+		t.Fatalf("unexpected first record: %+v %v", recs[0], recs[0].Err)
+	}
+	if recs[1].Err == nil || !strings.Contains(recs[1].Err.Error(), "lat") || recs[1].Line != 3 {
+		t.Fatalf("expected lat error on line 3: %+v", recs[1])
+	}
+	if recs[2].Err == nil || !strings.Contains(recs[2].Err.Error(), "timestamp") {
+		t.Fatalf("expected timestamp error: %+v", recs[2])
+	}
+	if recs[3].Err != nil || recs[3].Report.Timestamp != "2024-05-01T00:00:00Z" || recs[3].Report.IsHighway {
+		t.Fatalf("unexpected last record: %+v", recs[3])
+	}
+}
+
+func TestDecodeCSVRequiresDeviceColumn(t *testing.T) {
+	err := Decode(CSV, strings.NewReader("lat,lng\n1,2\n"), func(Record) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "device_id") {
+		t.Fatalf("expected header error, got %v", err)
+	}
+}
+
+func TestDecodeCSVContinuesAfterBadQuote(t *testing.T) {
+	recs := decodeAll(t, CSV, "device_id,description\ndev1,\"unterminated \"quote\ndev2,ok\n")
+	if len(recs) == 0 || recs[0].Err == nil {
+		t.Fatalf("expected parse error, got %+v", recs)
+	}
+}
+
+func TestDecodeJSONL(t *testing.T) {
+	input := `{"id":"rep_old","device_id":"dev1","lat":22.5,"lng":113.9,"timestamp":"2024-05-01 08:00:00","extra":"ignored"}` + "\n\n" +
+		`{"device_id":` + "\n" +
+		`{"device_id":"dev2","timestamp":"2024-05-01T00:00:00Z","occurred_at":"bad"}` + "\n"
+	recs := decodeAll(t, JSONL, input)
+	if len(recs) != 3 {
+		t.Fatalf("got %d records", len(recs))
+	}
+	if recs[0].Err != nil || recs[0].Report.ID != "rep_old" || recs[0].Report.Timestamp != "2024-05-01T00:00:00Z" {
+		t.Fatalf("unexpected first record: %+v", recs[0])
+	}
+	if recs[1].Err == nil || recs[1].Line != 3 {
+		t.Fatalf("expected syntax error on line 3: %+v", recs[1])
+	}
+	if recs[2].Err == nil || !strings.Contains(recs[2].Err.Error(), "occurred_at") {
+		t.Fatalf("expected occurred_at error: %+v", recs[2])
+	}
+}
@@ -0,0 +1,83 @@
+// Package job 实现异步准备报告的任务：任务按阶段执行，每个阶段结束后持久化，
+// 进程重启后从第一个未完成的阶段继续。
+package job
+
+import (
+	"errors"
+	"time"
+
+	"SnapReport/internal/ids"
+	"SnapReport/internal/model"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+type StageStatus string
+
+const (
+	StagePending StageStatus = "pending"
+	StageRunning StageStatus = "running"
+	StageDone    StageStatus = "done"
+	StageFailed  StageStatus = "failed"
+	StageSkipped StageStatus = "skipped"
+)
+
+// ErrSkipped 由阶段返回，表示该阶段无事可做（例如模拟模式下没有可下载的文件）
+var ErrSkipped = errors.New("stage skipped")
+
+type StageState struct {
+	Name       string      `json:"name"`
+	Status     StageStatus `json:"status"`
+	Progress   float64     `json:"progress"`
+	Error      string      `json:"error,omitempty"`
+	StartedAt  string      `json:"started_at,omitempty"`
+	FinishedAt string      `json:"finished_at,omitempty"`
+}
+
+type Job struct {
+	ID          string       `json:"id"`
+	Status      Status       `json:"status"`
+	DurationSec int          `json:"duration_sec"`
+	Draft       model.Report `json:"draft"`
+	Stages      []StageState `json:"stages"`
+	Error       string       `json:"error,omitempty"`
+	ReportID    string       `json:"report_id,omitempty"`
+	CreatedAt   string       `json:"created_at"`
+	UpdatedAt   string       `json:"updated_at"`
+}
+
+// New 创建一个排队中的任务，stages 为各阶段名称，按执行顺序排列
+func New(draft model.Report, durationSec int, stages []string) *Job {
+	now := time.Now().UTC().Format(time.RFC3339)
+	j := &Job{
+		ID:          ids.New("job_"),
+		Status:      StatusQueued,
+		DurationSec: durationSec,
+		Draft:       draft,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, name := range stages {
+		j.Stages = append(j.Stages, StageState{Name: name, Status: StagePending})
+	}
+	return j
+}
+
+// Finished 表示任务已经结束（成功或失败）
+func (j *Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+func (j *Job) clone() *Job {
+	c := *j
+	c.Stages = append([]StageState(nil), j.Stages...)
+	c.Draft.Tags = append([]string(nil), j.Draft.Tags...)
+	return &c
+}
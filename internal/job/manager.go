@@ -0,0 +1,301 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stage 是任务流水线中的一个阶段。Run 可以修改 j.Draft，并通过 progress
+// 报告 0~1 之间的进度。
+type Stage struct {
+	Name string
+	Run  func(ctx context.Context, j *Job, progress func(float64)) error
+}
+
+// FinishFunc 在所有阶段完成后调用，负责保存报告并返回报告 ID
+type FinishFunc func(ctx context.Context, j *Job) (string, error)
+
+// Manager 用固定数量的 worker 执行任务
+type Manager struct {
+	Store   Store
+	Stages  []Stage
+	Finish  FinishFunc
+	Workers int
+	// OnUpdate 在任务每次持久化后调用，可为 nil
+	OnUpdate func(j *Job)
+
+	queue    chan string
+	mu       sync.Mutex
+	pending  map[string]bool // 已排队或正在执行的任务
+	overflow atomic.Bool     // 有任务因队列已满未能排队
+	wg       sync.WaitGroup
+	cancel   context.CancelFunc
+	stop     chan struct{} // 关闭后 worker 不再领取新任务
+	stopOnce sync.Once
+}
+
+func NewManager(s Store, stages []Stage, finish FinishFunc, workers int) *Manager {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Manager{
+		Store:   s,
+		Stages:  stages,
+		Finish:  finish,
+		Workers: workers,
+		queue:   make(chan string, 1024),
+		pending: make(map[string]bool),
+		stop:    make(chan struct{}),
+		cancel:  func() {},
+	}
+}
+
+// StageNames 返回流水线各阶段的名称
+func (m *Manager) StageNames() []string {
+	names := make([]string, 0, len(m.Stages))
+	for _, st := range m.Stages {
+		names = append(names, st.Name)
+	}
+	return names
+}
+
+// Start 启动 worker，并重新排队上次进程退出时未完成的任务。ctx 取消后 worker 退出，
+// 正在执行的阶段被中断，任务保持未完成状态以便下次启动时继续。
+func (m *Manager) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+	for i := 0; i < m.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker(ctx)
+	}
+	for _, j := range m.Store.List() {
+		if !j.Finished() {
+			log.Printf("Resuming job %s", j.ID)
+			m.enqueue(j.ID)
+		}
+	}
+}
+
+// Wait 等待所有 worker 退出
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Drain 停止领取新任务，等待正在执行的任务完成。ctx 结束时中断剩余的任务并返回
+// ctx.Err()，它们保持未完成状态，下次启动时继续；已排队的任务同样留到下次启动。
+func (m *Manager) Drain(ctx context.Context) error {
+	m.stopOnce.Do(func() { close(m.stop) })
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		m.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Submit 保存并排队一个新任务
+func (m *Manager) Submit(j *Job) error {
+	if err := m.Store.Save(j); err != nil {
+		return fmt.Errorf("save job: %w", err)
+	}
+	m.enqueue(j.ID)
+	return nil
+}
+
+func (m *Manager) enqueue(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending[id] {
+		return
+	}
+	select {
+	case m.queue <- id:
+		m.pending[id] = true
+	default:
+		// 队列已满时不阻塞请求，任务已持久化，队列有空位后由 refill 重新排队
+		m.overflow.Store(true)
+		log.Printf("Warning: job queue full, job %s deferred", id)
+	}
+}
+
+// refill 在 worker 领取任务、队列有空位后，从存储中重新排队因队列已满而
+// 未能排队的任务
+func (m *Manager) refill() {
+	if !m.overflow.Swap(false) {
+		return
+	}
+	for _, j := range m.Store.List() {
+		if !j.Finished() {
+			m.enqueue(j.ID)
+		}
+	}
+}
+
+func (m *Manager) worker(ctx context.Context) {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stop:
+			return
+		case id := <-m.queue:
+			select {
+			case <-m.stop:
+				return
+			default:
+			}
+			m.refill()
+			if j, ok := m.Store.Get(id); ok && !j.Finished() {
+				m.run(ctx, j)
+			}
+			m.mu.Lock()
+			delete(m.pending, id)
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (m *Manager) run(ctx context.Context, j *Job) {
+	j.Status = StatusRunning
+	m.save(j)
+
+	for i := range j.Stages {
+		st := &j.Stages[i]
+		if st.Status == StageDone || st.Status == StageSkipped {
+			continue
+		}
+		stage, ok := m.stage(st.Name)
+		if !ok {
+			m.fail(j, st, fmt.Errorf("unknown stage %q", st.Name))
+			return
+		}
+
+		st.Status = StageRunning
+		st.Progress = 0
+		st.Error = ""
+		st.StartedAt = now()
+		m.save(j)
+
+		err := stage.Run(ctx, j, func(p float64) {
+			st.Progress = p
+			m.save(j)
+		})
+		if ctx.Err() != nil {
+			// 进程退出，保持阶段未完成，下次启动时重新执行
+			st.Status = StagePending
+			j.Status = StatusQueued
+			m.save(j)
+			return
+		}
+		switch {
+		case errors.Is(err, ErrSkipped):
+			st.Status = StageSkipped
+		case err != nil:
+			m.fail(j, st, err)
+			return
+		default:
+			st.Status = StageDone
+			st.Progress = 1
+		}
+		st.FinishedAt = now()
+		m.save(j)
+	}
+
+	reportID, err := m.Finish(ctx, j)
+	if err != nil && ctx.Err() != nil {
+		// 进程退出时中断的保存留到下次启动时重试
+		j.Status = StatusQueued
+		m.save(j)
+		return
+	}
+	if err != nil {
+		j.Status = StatusFailed
+		j.Error = err.Error()
+		m.save(j)
+		return
+	}
+	j.ReportID = reportID
+	j.Status = StatusSucceeded
+	m.save(j)
+}
+
+// Prune 删除结束时间早于 ttl 之前的成功和失败任务，返回删除的数量
+func (m *Manager) Prune(ttl time.Duration) int {
+	cutoff := time.Now().Add(-ttl)
+	n := 0
+	for _, j := range m.Store.List() {
+		if !j.Finished() {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, j.UpdatedAt)
+		if err != nil || !t.Before(cutoff) {
+			continue
+		}
+		if err := m.Store.Delete(j.ID); err != nil {
+			log.Printf("Warning: prune job %s failed: %v", j.ID, err)
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// RunPruner 立即并随后每隔 interval 删除结束超过 ttl 的任务，直到 ctx 结束
+func (m *Manager) RunPruner(ctx context.Context, interval, ttl time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if n := m.Prune(ttl); n > 0 {
+			log.Printf("Pruned %d finished jobs older than %s", n, ttl)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (m *Manager) stage(name string) (Stage, bool) {
+	for _, st := range m.Stages {
+		if st.Name == name {
+			return st, true
+		}
+	}
+	return Stage{}, false
+}
+
+func (m *Manager) fail(j *Job, st *StageState, err error) {
+	st.Status = StageFailed
+	st.Error = err.Error()
+	st.FinishedAt = now()
+	j.Status = StatusFailed
+	j.Error = fmt.Sprintf("%s: %v", st.Name, err)
+	m.save(j)
+}
+
+func (m *Manager) save(j *Job) {
+	j.UpdatedAt = now()
+	if err := m.Store.Save(j); err != nil {
+		log.Printf("Warning: persist job %s failed: %v", j.ID, err)
+	}
+	if m.OnUpdate != nil {
+		m.OnUpdate(j.clone())
+	}
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,292 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"SnapReport/internal/model"
+)
+
+func waitFinished(t *testing.T, s Store, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if j, ok := s.Get(id); ok && j.Finished() {
+			return j
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func finishWithID(_ context.Context, j *Job) (string, error) {
+	return j.Draft.ID, nil
+}
+
+func TestManagerRunsStagesInOrder(t *testing.T) {
+	st, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	stages := []Stage{
+		{Name: "a", Run: func(ctx context.Context, j *Job, progress func(float64)) error {
+			order = append(order, "a")
+			j.Draft.City = "深圳市"
+			progress(0.5)
+			return nil
+		}},
+		{Name: "b", Run: func(ctx context.Context, j *Job, _ func(float64)) error {
+			order = append(order, "b")
+			return ErrSkipped
+		}},
+	}
+	m := NewManager(st, stages, finishWithID, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Start(ctx)
+
+	j := New(model.Report{ID: "rep_1"}, 20, m.StageNames())
+	if err := m.Submit(j); err != nil {
+		t.Fatal(err)
+	}
+	got := waitFinished(t, st, j.ID)
+	if got.Status != StatusSucceeded || got.ReportID != "rep_1" || got.Draft.City != "深圳市" {
+		t.Fatalf("unexpected job %+v", got)
+	}
+	if got.Stages[0].Status != StageDone || got.Stages[1].Status != StageSkipped {
+		t.Fatalf("unexpected stages %+v", got.Stages)
+	}
+	if len(order) != 2 || order[0] != "a" || order[1] != "b" {
+		t.Fatalf("stages ran in order %v", order)
+	}
+}
+
+func TestManagerStageFailure(t *testing.T) {
+	st, _ := NewFileStore(t.TempDir())
+	stages := []Stage{
+		{Name: "a", Run: func(context.Context, *Job, func(float64)) error { return errors.New("device offline") }},
+		{Name: "b", Run: func(context.Context, *Job, func(float64)) error {
+			t.Error("stage b should not run")
+			return nil
+		}},
+	}
+	m := NewManager(st, stages, finishWithID, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Start(ctx)
+
+	j := New(model.Report{ID: "rep_1"}, 20, m.StageNames())
+	_ = m.Submit(j)
+	got := waitFinished(t, st, j.ID)
+	if got.Status != StatusFailed || got.Error != "a: device offline" || got.ReportID != "" {
+		t.Fatalf("unexpected job %+v", got)
+	}
+	if got.Stages[0].Status != StageFailed || got.Stages[1].Status != StagePending {
+		t.Fatalf("unexpected stages %+v", got.Stages)
+	}
+}
+
+func TestManagerResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	st, _ := NewFileStore(dir)
+
+	started := make(chan struct{})
+	blocking := []Stage{
+		{Name: "a", Run: func(context.Context, *Job, func(float64)) error { return nil }},
+		{Name: "b", Run: func(ctx context.Context, _ *Job, _ func(float64)) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	}
+	m := NewManager(st, blocking, finishWithID, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	m.Start(ctx)
+	j := New(model.Report{ID: "rep_1"}, 20, m.StageNames())
+	_ = m.Submit(j)
+	<-started
+	cancel()
+	m.Wait()
+
+	// 模拟重启：重新从磁盘加载
+	st2, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := st2.Get(j.ID)
+	if saved.Status != StatusQueued || saved.Stages[0].Status != StageDone || saved.Stages[1].Status != StagePending {
+		t.Fatalf("unexpected persisted job %+v", saved)
+	}
+
+	ranA := false
+	resumed := []Stage{
+		{Name: "a", Run: func(context.Context, *Job, func(float64)) error { ranA = true; return nil }},
+		{Name: "b", Run: func(context.Context, *Job, func(float64)) error { return nil }},
+	}
+	m2 := NewManager(st2, resumed, finishWithID, 1)
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	m2.Start(ctx2)
+	got := waitFinished(t, st2, j.ID)
+	if got.Status != StatusSucceeded {
+		t.Fatalf("resumed job status %s", got.Status)
+	}
+	if ranA {
+		t.Fatalf("completed stage re-ran after restart")
+	}
+}
+
+func TestManagerDrain(t *testing.T) {
+	st, _ := NewFileStore(t.TempDir())
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	stages := []Stage{
+		{Name: "a", Run: func(ctx context.Context, j *Job, _ func(float64)) error {
+			started <- j.ID
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}},
+	}
+	m := NewManager(st, stages, finishWithID, 1)
+	m.Start(context.Background())
+	j1 := New(model.Report{ID: "rep_1"}, 20, m.StageNames())
+	j2 := New(model.Report{ID: "rep_2"}, 20, m.StageNames())
+	_ = m.Submit(j1)
+	<-started
+	_ = m.Submit(j2)
+
+	// 正在执行的任务在期限内完成，排队的任务留到下次启动
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	if err := m.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain = %v", err)
+	}
+	if got, _ := st.Get(j1.ID); got.Status != StatusSucceeded {
+		t.Fatalf("running job status %s", got.Status)
+	}
+	if got, _ := st.Get(j2.ID); got.Status != StatusQueued {
+		t.Fatalf("queued job status %s", got.Status)
+	}
+
+	// 超过期限时中断任务，保持未完成
+	m2 := NewManager(st, []Stage{{Name: "a", Run: func(ctx context.Context, _ *Job, _ func(float64)) error {
+		started <- ""
+		<-ctx.Done()
+		return ctx.Err()
+	}}}, finishWithID, 1)
+	m2.Start(context.Background())
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m2.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain = %v, want deadline exceeded", err)
+	}
+	if got, _ := st.Get(j2.ID); got.Status != StatusQueued || got.Stages[0].Status != StagePending {
+		t.Fatalf("interrupted job %+v", got)
+	}
+}
+
+func TestManagerRequeuesWhenQueueWasFull(t *testing.T) {
+	st, _ := NewFileStore(t.TempDir())
+	release := make(chan struct{})
+	stages := []Stage{
+		{Name: "a", Run: func(ctx context.Context, _ *Job, _ func(float64)) error {
+			<-release
+			return nil
+		}},
+	}
+	m := NewManager(st, stages, finishWithID, 1)
+	m.queue = make(chan string, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Start(ctx)
+
+	// 一个执行中、一个排队，其余因队列已满只保存在存储中
+	var jobs []*Job
+	for i := 0; i < 5; i++ {
+		j := New(model.Report{ID: "rep_" + string(rune('a'+i))}, 20, m.StageNames())
+		if err := m.Submit(j); err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, j)
+	}
+	close(release)
+	for _, j := range jobs {
+		if got := waitFinished(t, st, j.ID); got.Status != StatusSucceeded {
+			t.Fatalf("job %s status %s", j.ID, got.Status)
+		}
+	}
+}
+
+func TestManagerLeavesJobQueuedWhenFinishIsInterrupted(t *testing.T) {
+	st, _ := NewFileStore(t.TempDir())
+	finishing := make(chan struct{})
+	finish := func(ctx context.Context, j *Job) (string, error) {
+		close(finishing)
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	m := NewManager(st, nil, finish, 1)
+	m.Start(context.Background())
+	j := New(model.Report{ID: "rep_1"}, 20, nil)
+	_ = m.Submit(j)
+	<-finishing
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain = %v, want deadline exceeded", err)
+	}
+	if got, _ := st.Get(j.ID); got.Status != StatusQueued || got.Error != "" {
+		t.Fatalf("interrupted job %+v", got)
+	}
+}
+
+func TestPruneRemovesOnlyOldFinishedJobs(t *testing.T) {
+	dir := t.TempDir()
+	st, _ := NewFileStore(dir)
+	m := NewManager(st, nil, finishWithID, 1)
+	old := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	jobs := map[string]*Job{}
+	for _, c := range []struct {
+		name    string
+		status  Status
+		updated string
+	}{
+		{"old-succeeded", StatusSucceeded, old},
+		{"old-failed", StatusFailed, old},
+		{"old-queued", StatusQueued, old},
+		{"new-succeeded", StatusSucceeded, time.Now().UTC().Format(time.RFC3339)},
+	} {
+		j := New(model.Report{}, 20, nil)
+		j.Status, j.UpdatedAt = c.status, c.updated
+		if err := st.Save(j); err != nil {
+			t.Fatal(err)
+		}
+		jobs[c.name] = j
+	}
+
+	if n := m.Prune(24 * time.Hour); n != 2 {
+		t.Fatalf("pruned %d jobs, want 2", n)
+	}
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, j := range jobs {
+		_, ok := reopened.Get(j.ID)
+		if want := !strings.HasPrefix(name, "old-") || name == "old-queued"; ok != want {
+			t.Errorf("%s: present = %v, want %v", name, ok, want)
+		}
+	}
+}
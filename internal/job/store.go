@@ -0,0 +1,110 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Store interface {
+	Save(j *Job) error
+	Get(id string) (*Job, bool)
+	List() []*Job
+	// Delete 删除任务，任务不存在时不返回错误
+	Delete(id string) error
+}
+
+// FileStore 将每个任务保存为目录下的一个 JSON 文件，并在内存中保留一份副本
+type FileStore struct {
+	mu   sync.RWMutex
+	dir  string
+	jobs map[string]*Job
+}
+
+// NewFileStore 打开 dir 并加载其中已有的任务
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{dir: dir, jobs: make(map[string]*Job)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var j Job
+		if err := json.Unmarshal(b, &j); err != nil {
+			return nil, fmt.Errorf("load job %s: %w", e.Name(), err)
+		}
+		s.jobs[j.ID] = &j
+	}
+	return s, nil
+}
+
+func (s *FileStore) Save(j *Job) error {
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 先写临时文件再重命名，避免进程中途退出留下半个文件
+	path := filepath.Join(s.dir, j.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	s.jobs[j.ID] = j.clone()
+	return nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(filepath.Join(s.dir, filepath.Base(id)+".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *FileStore) Get(id string) (*Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return j.clone(), true
+}
+
+// List 按创建时间返回所有任务
+func (s *FileStore) List() []*Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, j.clone())
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].CreatedAt != out[b].CreatedAt {
+			return out[a].CreatedAt < out[b].CreatedAt
+		}
+		return out[a].ID < out[b].ID
+	})
+	return out
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// DurationBuckets 是耗时直方图的上界（秒），覆盖从毫秒级的接口到
+// 数分钟的视频下载
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// Metrics 是 SnapReport 导出的指标。对 nil *Metrics 调用任何方法都是安全的，
+// 未启用监控时不记录。
+type Metrics struct {
+	*Registry
+
+	requests        *CounterVec
+	requestDuration *HistogramVec
+	stageDuration   *HistogramVec
+	geocodes        *CounterVec
+	geocodeErrors   *CounterVec
+	geocodeDuration *HistogramVec
+	deviceDuration  *HistogramVec
+	deviceFailures  *CounterVec
+	downloadBytes   *CounterVec
+
+	knownDevice func(deviceID string) bool
+}
+
+// OtherDevice 是未登记设备的 device 标签值
+const OtherDevice = "other"
+
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		Registry: r,
+		requests: r.NewCounterVec("snapreport_http_requests_total",
+			"HTTP requests by method, route and status code.", "method", "route", "status"),
+		requestDuration: r.NewHistogramVec("snapreport_http_request_duration_seconds",
+			"HTTP request latency by method and route.", DurationBuckets, "method", "route"),
+		stageDuration: r.NewHistogramVec("snapreport_prepare_stage_duration_seconds",
+			"Duration of report preparation stages; skipped stages are not observed.", DurationBuckets, "stage", "result"),
+		geocodes: r.NewCounterVec("snapreport_geocoder_requests_total",
+			"Reverse geocoding calls by provider.", "provider"),
+		geocodeErrors: r.NewCounterVec("snapreport_geocoder_errors_total",
+			"Failed reverse geocoding calls by provider, including timeouts.", "provider"),
+		geocodeDuration: r.NewHistogramVec("snapreport_geocoder_request_duration_seconds",
+			"Reverse geocoding latency by provider.", DurationBuckets, "provider"),
+		deviceDuration: r.NewHistogramVec("snapreport_ddpai_command_duration_seconds",
+			"Dashcam command latency by device and command.", DurationBuckets, "device", "command"),
+		deviceFailures: r.NewCounterVec("snapreport_ddpai_command_failures_total",
+			"Failed dashcam commands by device and command.", "device", "command"),
+		downloadBytes: r.NewCounterVec("snapreport_ddpai_download_bytes_total",
+			"Bytes of video downloaded from dashcams by device.", "device"),
+	}
+}
+
+// ReportsByStatus 导出每种状态的报告数量，count 在每次抓取时调用
+func (m *Metrics) ReportsByStatus(count func() map[string]int) {
+	if m == nil {
+		return
+	}
+	m.NewGaugeFunc("snapreport_reports", "Stored reports by status.", []string{"status"},
+		func(set func(float64, ...string)) {
+			for status, n := range count() {
+				set(float64(n), status)
+			}
+		})
+}
+
+// KnownDevices 设置判断设备是否已登记（配置或分配给用户）的函数，须在开始
+// 记录之前调用。设备 ID 来自请求，未登记的设备都记为 OtherDevice，避免任意
+// ID 产生无限多的序列；未设置时所有设备都记为 OtherDevice。
+func (m *Metrics) KnownDevices(known func(deviceID string) bool) {
+	if m == nil {
+		return
+	}
+	m.knownDevice = known
+}
+
+func (m *Metrics) device(id string) string {
+	if m.knownDevice != nil && m.knownDevice(id) {
+		return id
+	}
+	return OtherDevice
+}
+
+// ObserveRequest 记录一次 HTTP 请求，route 是路由模板而不是实际路径
+func (m *Metrics) ObserveRequest(method, route string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.Inc(method, route, strconv.Itoa(status))
+	m.requestDuration.Observe(d.Seconds(), method, route)
+}
+
+// ObserveStage 记录 Prepare 的一个阶段，err 非 nil 时结果为 error
+func (m *Metrics) ObserveStage(stage string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.stageDuration.Observe(d.Seconds(), stage, result(err))
+}
+
+// ObserveGeocode 记录一次逆地理编码。地理编码器不缓存结果，每次调用都是
+// 发往服务商的请求，因此没有缓存命中计数。
+func (m *Metrics) ObserveGeocode(provider string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.geocodes.Inc(provider)
+	if err != nil {
+		m.geocodeErrors.Inc(provider)
+	}
+	m.geocodeDuration.Observe(d.Seconds(), provider)
+}
+
+// ObserveDevice 记录一次行车记录仪命令
+func (m *Metrics) ObserveDevice(device, command string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	device = m.device(device)
+	m.deviceDuration.Observe(d.Seconds(), device, command)
+	if err != nil {
+		m.deviceFailures.Inc(device, command)
+	}
+}
+
+// AddDownloadBytes 累计从设备下载的字节数，包括失败前已下载的部分
+func (m *Metrics) AddDownloadBytes(device string, n int64) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.downloadBytes.Add(float64(n), m.device(device))
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
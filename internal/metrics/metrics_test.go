@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextFormat(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "A counter\nwith two lines.", "path")
+	h := r.NewHistogramVec("test_seconds", "A histogram.", []float64{1, 0.1}, "op")
+	r.NewGaugeFunc("test_gauge", "A gauge.", nil, func(set func(float64, ...string)) { set(3) })
+
+	c.Inc(`/a"b`)
+	c.Add(2, "/c")
+	h.Observe(0.05, "x")
+	h.Observe(0.5, "x")
+	h.Observe(5, "x")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_total A counter\nwith two lines.
+# TYPE test_total counter
+test_total{path="/a\"b"} 1
+test_total{path="/c"} 2
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{op="x",le="0.1"} 1
+test_seconds_bucket{op="x",le="1"} 2
+test_seconds_bucket{op="x",le="+Inf"} 3
+test_seconds_sum{op="x"} 5.55
+test_seconds_count{op="x"} 3
+# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge 3
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var none *Metrics
+	none.ObserveRequest("GET", "/health", 200, time.Millisecond) // nil 时不记录
+
+	m := New()
+	m.ReportsByStatus(func() map[string]int { return map[string]int{"prepared": 2, "submitted": 1} })
+	m.ObserveRequest("GET", "/reports/:id", 404, 20*time.Millisecond)
+	m.ObserveGeocode("amap", time.Second, errors.New("timeout"))
+	m.KnownDevices(func(id string) bool { return id == "dev1" })
+	m.ObserveDevice("dev1", "session", 30*time.Millisecond, nil)
+	m.AddDownloadBytes("dev1", 1<<20)
+	m.ObserveDevice("random-1", "session", time.Millisecond, errors.New("unreachable"))
+	m.ObserveDevice("random-2", "session", time.Millisecond, errors.New("unreachable"))
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "random-") {
+		t.Errorf("unknown device labelled:\n%s", rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		`snapreport_http_requests_total{method="GET",route="/reports/:id",status="404"} 1`,
+		`snapreport_http_request_duration_seconds_bucket{method="GET",route="/reports/:id",le="0.025"} 1`,
+		`snapreport_geocoder_requests_total{provider="amap"} 1`,
+		`snapreport_geocoder_errors_total{provider="amap"} 1`,
+		`snapreport_ddpai_command_duration_seconds_count{device="dev1",command="session"} 1`,
+		`snapreport_ddpai_download_bytes_total{device="dev1"} 1.048576e+06`,
+		`snapreport_ddpai_command_failures_total{device="other",command="session"} 2`,
+		`snapreport_reports{status="prepared"} 2`,
+		`# TYPE snapreport_ddpai_command_failures_total counter`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Package metrics 以 Prometheus 文本格式（0.0.4）导出进程内的计数器、直方图和
+// 仪表，不依赖 Prometheus 客户端库。
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType 是文本格式的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry 按注册顺序导出其中的指标
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText 以文本格式写出全部指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP 供 Prometheus 抓取
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = r.WriteText(w)
+}
+
+// desc 是指标的名称、说明、类型和标签名
+type desc struct {
+	name, help, typ string
+	labels          []string
+}
+
+func (d desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.typ)
+}
+
+// key 将标签值拼成序列的键，标签数量与定义不符是编程错误
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series 写出一行样本，extra 是附加的标签，如直方图的 le
+func (d desc) series(w *bufio.Writer, name string, values []string, extra string, v float64) {
+	w.WriteString(name)
+	if len(d.labels) > 0 || extra != "" {
+		w.WriteByte('{')
+		for i, l := range d.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l, escapeLabel(values[i]))
+		}
+		if extra != "" {
+			if len(d.labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extra)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+// CounterVec 是带标签的单调递增计数器
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*counter
+}
+
+type counter struct {
+	labels []string
+	v      float64
+}
+
+// NewCounterVec 注册一个计数器，name 按惯例以 _total 结尾
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, "counter", labels}, values: map[string]*counter{}}
+	r.register(c)
+	return c
+}
+
+// Add 增加 v，v 不能为负
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	k := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[k]
+	if !ok {
+		s = &counter{labels: append([]string(nil), labelValues...)}
+		c.values[k] = s
+	}
+	s.v += v
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.header(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.values) {
+		s := c.values[k]
+		c.series(w, c.name, s.labels, "", s.v)
+	}
+}
+
+// HistogramVec 是带标签的直方图
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64 // 每个桶自身的计数，导出时累加
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec 注册一个直方图，buckets 是升序的上界，+Inf 自动添加
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{name, help, "histogram", labels},
+		buckets: append([]float64(nil), buckets...),
+		values:  map[string]*histogram{},
+	}
+	sort.Float64s(h.buckets)
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[k]
+	if !ok {
+		s = &histogram{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[k] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.header(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.values) {
+		s := h.values[k]
+		var cum uint64
+		for i, b := range h.buckets {
+			cum += s.counts[i]
+			h.series(w, h.name+"_bucket", s.labels, `le="`+formatFloat(b)+`"`, float64(cum))
+		}
+		h.series(w, h.name+"_bucket", s.labels, `le="+Inf"`, float64(s.count))
+		h.series(w, h.name+"_sum", s.labels, "", s.sum)
+		h.series(w, h.name+"_count", s.labels, "", float64(s.count))
+	}
+}
+
+// gaugeFunc 在每次导出时调用 fn 取值
+type gaugeFunc struct {
+	desc
+	fn func(set func(v float64, labelValues ...string))
+}
+
+// NewGaugeFunc 注册一个仪表，每次导出时调用 fn，fn 对每个序列调用一次 set
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, fn func(set func(v float64, labelValues ...string))) {
+	r.register(&gaugeFunc{desc: desc{name, help, "gauge", labels}, fn: fn})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+	type sample struct {
+		labels []string
+		v      float64
+	}
+	samples := map[string]sample{}
+	g.fn(func(v float64, labelValues ...string) {
+		samples[g.key(labelValues)] = sample{append([]string(nil), labelValues...), v}
+	})
+	for _, k := range sortedKeys(samples) {
+		g.series(w, g.name, samples[k].labels, "", samples[k].v)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
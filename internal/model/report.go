@@ -1,16 +1,67 @@
 package model
 
 type Report struct {
-	ID        string   `json:"id"`
-	Timestamp string   `json:"timestamp"`
-	Latitude  float64  `json:"lat"`
-	Longitude float64  `json:"lng"`
-	City      string   `json:"city"`
-	RoadName  string   `json:"road_name"`
-	IsHighway bool     `json:"is_highway"`
-	Provider  string   `json:"provider"`
-	VideoURL  string   `json:"video_url"`
-	Status    string   `json:"status"`
-	DeviceID  string   `json:"device_id"`
-	Tags      []string `json:"tags"`
+	ID          string   `json:"id"`
+	OrgID       string   `json:"org_id"`
+	Timestamp   string   `json:"timestamp"`
+	Latitude    float64  `json:"lat"`
+	Longitude   float64  `json:"lng"`
+	City        string   `json:"city"`
+	RoadName    string   `json:"road_name"`
+	IsHighway   bool     `json:"is_highway"`
+	Provider    string   `json:"provider"`
+	VideoURL    string   `json:"video_url"`
+	VideoPath   string   `json:"video_path,omitempty"`   // 异步任务下载到本地、尚未转存的文件
+	VideoKey    string   `json:"video_key,omitempty"`    // 视频在媒体存储中的 key
+	VideoSize   int64    `json:"video_size,omitempty"`   // 字节数
+	VideoSHA256 string   `json:"video_sha256,omitempty"` // 本地文件的 SHA-256，十六进制
+	Status      string   `json:"status"`
+	DeviceID    string   `json:"device_id"`
+	Tags        []string `json:"tags"`
+
+	// 结构化的违法/事件信息，ViolationType 为 violation 分类中的 ID
+	ViolationType string `json:"violation_type,omitempty"`
+	ViolationCode string `json:"violation_code,omitempty"` // 交管部门违法代码
+	Description   string `json:"description,omitempty"`
+	OccurredAt    string `json:"occurred_at,omitempty"` // 事件发生时间，RFC3339
+
+	Vehicle *Vehicle `json:"vehicle,omitempty"` // 违法车辆
+
+	// DuplicateOf 是疑似重复的已有报告 ID，例如车队中另一辆车报告的同一事件
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"` // 上传的照片和视频
+
+	SubmittedAt string `json:"submitted_at,omitempty"` // 首次提交时间，RFC3339
+	// LegalHold 的报告不受保留策略影响，直到解除保全
+	LegalHold       bool   `json:"legal_hold,omitempty"`
+	LegalHoldReason string `json:"legal_hold_reason,omitempty"`
+	// MediaPurgedAt 是按保留策略删除视频和照片的时间，之后只保留元数据
+	MediaPurgedAt string `json:"media_purged_at,omitempty"`
+}
+
+// Attachment 是报告的一个媒体文件：行车记录仪抓取的视频或用户上传的照片和视频
+type Attachment struct {
+	ID          string   `json:"id"`
+	Source      string   `json:"source"`             // "dashcam" 或 "upload"
+	Kind        string   `json:"kind"`               // "image" 或 "video"
+	ContentType string   `json:"content_type"`       // 根据文件内容检测，不信任客户端声明
+	Filename    string   `json:"filename,omitempty"` // 客户端提供的原始文件名
+	Key         string   `json:"key,omitempty"`      // 媒体存储中的 key，媒体被清除后为空
+	URL         string   `json:"url,omitempty"`      // 有时效的下载地址，只在列出附件时填写
+	Size        int64    `json:"size"`
+	SHA256      string   `json:"sha256"`
+	TakenAt     string   `json:"taken_at,omitempty"` // EXIF 拍摄时间，RFC3339
+	Latitude    *float64 `json:"lat,omitempty"`      // EXIF GPS 坐标
+	Longitude   *float64 `json:"lng,omitempty"`
+	UploadedAt  string   `json:"uploaded_at,omitempty"`
+}
+
+// Vehicle 是违法车辆的信息
+type Vehicle struct {
+	Plate       string `json:"plate,omitempty"`       // 规范化后的号牌，如 "粤B12345"
+	PlateColor  string `json:"plate_color,omitempty"` // blue、yellow、green、yellow_green、white、black
+	Type        string `json:"type,omitempty"`        // car、suv、truck、bus 等
+	Color       string `json:"color,omitempty"`       // 车身颜色
+	Description string `json:"description,omitempty"`
 }
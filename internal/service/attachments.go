@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"SnapReport/internal/auth"
+	"SnapReport/internal/events"
+	"SnapReport/internal/exif"
+	"SnapReport/internal/ids"
+	"SnapReport/internal/model"
+)
+
+// 上传文件的默认大小上限
+const (
+	DefaultMaxImageBytes = 20 << 20
+	DefaultMaxVideoBytes = 500 << 20
+)
+
+var (
+	ErrUnsupportedMedia = errors.New("unsupported media type")
+	ErrMediaTooLarge    = errors.New("media file too large")
+	// ErrStorageDisabled 表示服务未配置媒体存储
+	ErrStorageDisabled = errors.New("media storage not configured")
+	// ErrMediaPurged 表示报告的媒体已按保留策略清除，不能再添加附件
+	ErrMediaPurged = errors.New("report media purged by retention")
+)
+
+// DefaultURLExpiry 是附件下载地址的默认有效期
+const DefaultURLExpiry = 15 * time.Minute
+
+// exifLocation 用于解释没有记录时区的 EXIF 拍摄时间。手机照片通常使用
+// 当地时间，中国不实行夏令时，固定为 UTC+8。
+var exifLocation = time.FixedZone("CST", 8*3600)
+
+// 允许上传的内容类型及保存时使用的扩展名
+var mediaTypes = map[string]struct{ kind, ext string }{
+	"image/jpeg":      {"image", ".jpg"},
+	"image/png":       {"image", ".png"},
+	"image/webp":      {"image", ".webp"},
+	"image/heic":      {"image", ".heic"},
+	"video/mp4":       {"video", ".mp4"},
+	"video/quicktime": {"video", ".mov"},
+	"video/webm":      {"video", ".webm"},
+}
+
+// Upload 是一个待保存的上传文件
+type Upload struct {
+	Filename string // 客户端提供的文件名，只用于展示
+	Body     io.Reader
+}
+
+// Attach 保存上传的照片或视频并追加到报告。文件类型根据内容检测，
+// 照片中的 EXIF 拍摄时间和 GPS 坐标会被记录。已提交或媒体已被清除的报告
+// 不能再添加附件；上传期间报告被提交或清除时删除已保存的文件。
+func (s *ReportService) Attach(ctx context.Context, reportID string, up Upload) (*model.Attachment, error) {
+	if s.Blobs == nil {
+		return nil, ErrStorageDisabled
+	}
+	report, ok := s.Store.Get(reportID)
+	if !ok || !auth.CanAccess(ctx, report.OrgID, report.DeviceID) {
+		return nil, ErrReportNotFound
+	}
+	if err := attachable(report); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(up.Body, 512)
+	head, _ := br.Peek(512)
+	ct := sniff(head)
+	mt, ok := mediaTypes[ct]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMedia, ct)
+	}
+
+	a := model.Attachment{
+		ID:          ids.New("att_"),
+		Source:      "upload",
+		Kind:        mt.kind,
+		ContentType: ct,
+		Filename:    filepath.Base(up.Filename),
+		UploadedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	if a.Filename == "." || a.Filename == string(filepath.Separator) {
+		a.Filename = ""
+	}
+	a.Key = mediaKey(report.ID, a.ID+mt.ext)
+	if err := s.storeUpload(ctx, br, &a, s.Media.maxBytes(mt.kind)); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	report, ok = s.Store.Get(reportID)
+	err := ErrReportNotFound
+	if ok {
+		err = attachable(report)
+	}
+	if err == nil {
+		report.Attachments = append(report.Attachments, a)
+		err = s.Store.Save(report)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		s.Blobs.Delete(context.WithoutCancel(ctx), a.Key)
+		return nil, err
+	}
+	s.Events.Publish(events.ReportUpdated, report.OrgID, report.DeviceID, report)
+	return &a, nil
+}
+
+// attachable 检查报告是否还能添加附件
+func attachable(r model.Report) error {
+	switch {
+	case r.Status == "submitted":
+		return ErrReportSubmitted
+	case r.MediaPurgedAt != "":
+		return ErrMediaPurged
+	}
+	return nil
+}
+
+// mediaKey 返回报告媒体文件在存储中的 key
+func mediaKey(reportID, name string) string {
+	return "reports/" + reportID + "/" + name
+}
+
+// storeUpload 先将上传内容写入 Media.Dir 下的临时文件，以便计算大小和
+// SHA-256、读取 EXIF，并满足 S3 需要预先知道长度的要求，然后转存到 a.Key。
+// 超过 limit 时返回 ErrMediaTooLarge。
+func (s *ReportService) storeUpload(ctx context.Context, r io.Reader, a *model.Attachment, limit int64) error {
+	dir := filepath.Join(s.Media.Dir, "uploads")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, a.ID+"-*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r, limit+1))
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil && n > limit {
+		err = fmt.Errorf("%w: limit is %d bytes", ErrMediaTooLarge, limit)
+	}
+	if err != nil {
+		return err
+	}
+	a.Size = n
+	a.SHA256 = hex.EncodeToString(h.Sum(nil))
+	if a.ContentType == "image/jpeg" {
+		if _, err := f.Seek(0, io.SeekStart); err == nil {
+			readExif(f, a)
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.Blobs.Put(ctx, a.Key, f, n, a.ContentType)
+}
+
+// readExif 读取照片的拍摄时间和坐标，没有 EXIF 时忽略
+func readExif(r io.Reader, a *model.Attachment) {
+	info, err := exif.Decode(r, exifLocation)
+	if err != nil {
+		return
+	}
+	if !info.Time.IsZero() {
+		a.TakenAt = info.Time.UTC().Format(time.RFC3339)
+	}
+	if info.HasGPS {
+		lat, lng := info.Latitude, info.Longitude
+		a.Latitude, a.Longitude = &lat, &lng
+	}
+}
+
+// Attachments 返回报告的媒体文件及有时效的下载地址：行车记录仪视频
+// （已转存到媒体存储时）在前，之后是按上传顺序排列的附件
+func (s *ReportService) Attachments(ctx context.Context, reportID string) ([]model.Attachment, error) {
+	report, ok := s.Store.Get(reportID)
+	if !ok || !auth.CanAccess(ctx, report.OrgID, report.DeviceID) {
+		return nil, ErrReportNotFound
+	}
+	out := make([]model.Attachment, 0, len(report.Attachments)+1)
+	if report.VideoKey != "" {
+		out = append(out, model.Attachment{
+			ID:          "clip",
+			Source:      "dashcam",
+			Kind:        "video",
+			ContentType: "video/mp4",
+			Key:         report.VideoKey,
+			Size:        report.VideoSize,
+			SHA256:      report.VideoSHA256,
+			TakenAt:     report.OccurredAt,
+		})
+	}
+	out = append(out, report.Attachments...)
+	if s.Blobs == nil {
+		return out, nil
+	}
+	expiry := s.Media.URLExpiry
+	if expiry <= 0 {
+		expiry = DefaultURLExpiry
+	}
+	for i := range out {
+		if out[i].Key == "" {
+			continue // 已按保留策略清除
+		}
+		u, err := s.Blobs.URL(ctx, out[i].Key, expiry)
+		if err != nil {
+			return nil, err
+		}
+		out[i].URL = u
+	}
+	return out, nil
+}
+
+func (m MediaConfig) maxBytes(kind string) int64 {
+	if kind == "image" {
+		if m.MaxImageBytes > 0 {
+			return m.MaxImageBytes
+		}
+		return DefaultMaxImageBytes
+	}
+	if m.MaxVideoBytes > 0 {
+		return m.MaxVideoBytes
+	}
+	return DefaultMaxVideoBytes
+}
+
+// sniff 检测文件内容类型。http.DetectContentType 不识别 QuickTime 和
+// HEIC，它们与 MP4 同属 ISO BMFF，通过 ftyp 中的品牌区分。
+func sniff(head []byte) string {
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch string(head[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "heic", "heix", "mif1", "msf1":
+			return "image/heic"
+		}
+	}
+	// 去掉 "; charset=..." 等参数
+	ct, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return ct
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"SnapReport/internal/geo"
+	"SnapReport/internal/model"
+	"SnapReport/internal/store"
+)
+
+// ErrDuplicate 表示请求与已有报告重复，使用 errors.As 取得 *DuplicateError
+var ErrDuplicate = errors.New("duplicate report")
+
+// ErrReportExists 表示新报告的 ID 已被已有报告使用，例如重复导入同一 ID
+var ErrReportExists = errors.New("report already exists")
+
+// DuplicateError 携带被重复的已有报告
+type DuplicateError struct {
+	Existing model.Report
+}
+
+func (e *DuplicateError) Error() string { return "duplicate of report " + e.Existing.ID }
+
+func (e *DuplicateError) Is(target error) bool { return target == ErrDuplicate }
+
+// DedupConfig 控制重复报告检测，Window 为零时关闭检测
+type DedupConfig struct {
+	Window   time.Duration // 只与该时间窗口内创建的报告比较
+	Distance float64       // 视为同一地点的最大距离（米）
+}
+
+// findDuplicate 在同一组织最近的报告中查找与 r 重复的报告。
+//
+// 同一设备的同一段视频，或同一设备在附近的重复提交（双击）视为确定重复，
+// exact 为 true；不同设备在附近报告同一车辆（车队中多人同时按下）视为
+// 疑似重复，由调用方标记 DuplicateOf。号牌都已填写但不同的报告不算重复。
+func (s *ReportService) findDuplicate(r model.Report) (dup model.Report, exact, found bool) {
+	if s.Dedup.Window <= 0 {
+		return model.Report{}, false, false
+	}
+	now, err := time.Parse(time.RFC3339, r.Timestamp)
+	if err != nil {
+		return model.Report{}, false, false
+	}
+	candidates := s.Store.Query(store.Filter{
+		OrgID: r.OrgID,
+		From:  now.Add(-s.Dedup.Window).Format(time.RFC3339),
+		To:    now.Add(s.Dedup.Window).Format(time.RFC3339), // 导入的历史报告可能早于已有报告
+	})
+	// 从最新的报告开始比较
+	for i := len(candidates) - 1; i >= 0; i-- {
+		c := candidates[i]
+		if c.ID == r.ID || !samePlate(c, r) {
+			continue
+		}
+		if c.DeviceID == r.DeviceID && sameVideo(c, r) {
+			return c, true, true
+		}
+		if !s.near(c, r) || !sameViolation(c, r) {
+			continue
+		}
+		if c.DeviceID == r.DeviceID {
+			return c, true, true
+		}
+		if !found {
+			dup, found = c, true
+		}
+	}
+	return dup, false, found
+}
+
+func (s *ReportService) near(a, b model.Report) bool {
+	if !hasLocation(a) || !hasLocation(b) {
+		return false
+	}
+	return geo.Distance(a.Latitude, a.Longitude, b.Latitude, b.Longitude) <= s.Dedup.Distance
+}
+
+func hasLocation(r model.Report) bool {
+	return r.Latitude != 0 || r.Longitude != 0
+}
+
+// sameVideo 比较视频文件的哈希或设备上的下载地址。模拟模式的地址不代表
+// 具体文件，不参与比较。
+func sameVideo(a, b model.Report) bool {
+	if a.VideoSHA256 != "" && a.VideoSHA256 == b.VideoSHA256 {
+		return true
+	}
+	if a.VideoURL == "" || strings.HasPrefix(a.VideoURL, "ddpai://") {
+		return false
+	}
+	return a.VideoURL == b.VideoURL
+}
+
+// samePlate 只有两份报告都填写了号牌且号牌不同时才返回 false
+func samePlate(a, b model.Report) bool {
+	if a.Vehicle == nil || b.Vehicle == nil || a.Vehicle.Plate == "" || b.Vehicle.Plate == "" {
+		return true
+	}
+	return a.Vehicle.Plate == b.Vehicle.Plate
+}
+
+func sameViolation(a, b model.Report) bool {
+	return a.ViolationType == "" || b.ViolationType == "" || a.ViolationType == b.ViolationType
+}
+
+// saveNew 检测重复后保存新报告。ID 已被使用时返回 ErrReportExists，不覆盖
+// 已有报告；确定重复时不保存，返回 *DuplicateError；疑似重复时保存并填写
+// DuplicateOf。
+func (s *ReportService) saveNew(r *model.Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.Store.Get(r.ID); exists {
+		return fmt.Errorf("%w: %s", ErrReportExists, r.ID)
+	}
+	if dup, exact, ok := s.findDuplicate(*r); ok {
+		if exact {
+			return &DuplicateError{Existing: dup}
+		}
+		r.DuplicateOf = dup.ID
+	}
+	return s.Store.Save(*r)
+}
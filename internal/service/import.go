@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"SnapReport/internal/auth"
+	"SnapReport/internal/ids"
+	"SnapReport/internal/importer"
+	"SnapReport/internal/model"
+	"SnapReport/internal/tenant"
+	"SnapReport/internal/vehicle"
+	"SnapReport/internal/violation"
+)
+
+// ErrInvalidImport 表示导入的报告字段无效
+var ErrInvalidImport = errors.New("invalid report")
+
+// 导入结果中每行的状态
+const (
+	ImportCreated = "created"
+	ImportValid   = "valid"   // 试运行时校验通过
+	ImportSkipped = "skipped" // 报告已存在或与已有报告确定重复
+	ImportFailed  = "failed"
+)
+
+// ImportOptions 控制批量导入
+type ImportOptions struct {
+	// Geocode 时对缺少城市或道路的报告调用组织的地理编码器补全
+	Geocode bool
+	DryRun  bool
+}
+
+// ImportRow 是导入文件中一行的结果
+type ImportRow struct {
+	Line        int    `json:"line"`
+	ID          string `json:"id,omitempty"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// ImportResult 汇总一次导入
+type ImportResult struct {
+	DryRun  bool        `json:"dry_run"`
+	Total   int         `json:"total"`
+	Created int         `json:"created"`
+	Skipped int         `json:"skipped"`
+	Failed  int         `json:"failed"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+// Import 逐行导入 CSV 或 JSON Lines 格式的历史报告。每行独立校验和保存，
+// 失败的行记录在结果中，不影响其他行。只有格式未知、表头无效或读取失败
+// 时返回错误，此时已导入的行仍然保留。导入不推送事件。
+func (s *ReportService) Import(ctx context.Context, format string, r io.Reader, opts ImportOptions) (ImportResult, error) {
+	res := ImportResult{DryRun: opts.DryRun, Rows: []ImportRow{}}
+	err := importer.Decode(format, r, func(rec importer.Record) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		row := s.importOne(ctx, rec, opts)
+		res.Total++
+		switch row.Status {
+		case ImportCreated, ImportValid:
+			res.Created++
+		case ImportSkipped:
+			res.Skipped++
+		default:
+			res.Failed++
+		}
+		res.Rows = append(res.Rows, row)
+		return nil
+	})
+	return res, err
+}
+
+func (s *ReportService) importOne(ctx context.Context, rec importer.Record, opts ImportOptions) ImportRow {
+	row := ImportRow{Line: rec.Line, ID: rec.Report.ID}
+	fail := func(err error) ImportRow {
+		row.Status, row.Error = ImportFailed, err.Error()
+		return row
+	}
+	if rec.Err != nil {
+		return fail(rec.Err)
+	}
+	report := rec.Report
+	if err := s.normalizeImport(ctx, &report); err != nil {
+		return fail(err)
+	}
+	row.ID = report.ID
+	// 提前跳过已有的 ID 以免白白地理编码；saveNew 在 s.mu 下再检查一次
+	if _, exists := s.Store.Get(report.ID); exists {
+		row.Status, row.Error = ImportSkipped, ErrReportExists.Error()
+		return row
+	}
+	if opts.Geocode && (report.City == "" || report.RoadName == "") && hasLocation(report) {
+		if err := s.fillLocation(ctx, &report); err != nil {
+			return fail(err)
+		}
+	}
+	if opts.DryRun {
+		row.Status = ImportValid
+		if dup, exact, ok := s.findDuplicate(report); ok && exact {
+			row.Status, row.Error, row.DuplicateOf = ImportSkipped, (&DuplicateError{Existing: dup}).Error(), dup.ID
+		}
+		return row
+	}
+	if err := s.saveNew(&report); err != nil {
+		var dup *DuplicateError
+		switch {
+		case errors.As(err, &dup):
+			row.Status, row.Error, row.DuplicateOf = ImportSkipped, err.Error(), dup.Existing.ID
+			return row
+		case errors.Is(err, ErrReportExists):
+			row.Status, row.Error = ImportSkipped, ErrReportExists.Error()
+			return row
+		}
+		return fail(err)
+	}
+	row.Status, row.DuplicateOf = ImportCreated, report.DuplicateOf
+	return row
+}
+
+// normalizeImport 校验导入的报告并填写默认值。媒体、重复标记和法律保全
+// 等由服务维护的字段会被清除。
+func (s *ReportService) normalizeImport(ctx context.Context, r *model.Report) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidImport, fmt.Sprintf(format, args...))
+	}
+	if r.DeviceID == "" {
+		return invalid("device_id required")
+	}
+
+	orgID, restricted := auth.OrgFromContext(ctx)
+	switch {
+	case restricted && r.OrgID != "" && r.OrgID != orgID:
+		return invalid("cannot import into org %q", r.OrgID)
+	case restricted || r.OrgID == "":
+		r.OrgID = orgID
+	case s.Tenants != nil:
+		if _, ok := s.Tenants.Get(r.OrgID); !ok {
+			return fmt.Errorf("%w: %s", tenant.ErrOrgNotFound, r.OrgID)
+		}
+	}
+	if !auth.CanAccess(ctx, r.OrgID, r.DeviceID) {
+		return ErrForbidden
+	}
+
+	if r.ID == "" {
+		r.ID = s.newID()
+	} else if !ids.Valid(ReportIDPrefix, r.ID) {
+		return invalid("invalid id %q", r.ID)
+	}
+	if r.Timestamp == "" {
+		r.Timestamp = r.OccurredAt
+	}
+	if r.Timestamp == "" {
+		return invalid("timestamp or occurred_at required")
+	}
+	t, err := time.Parse(time.RFC3339, r.Timestamp)
+	if err != nil {
+		return invalid("timestamp must be RFC3339")
+	}
+	r.Timestamp = t.UTC().Format(time.RFC3339)
+	// 历史报告默认已经处理过。作为草稿导入时按原时间计算保留期限，
+	// 可能在下次清理时就被删除。
+	switch r.Status {
+	case "":
+		r.Status = "submitted"
+	case "prepared", "submitted":
+	default:
+		return invalid("status must be prepared or submitted")
+	}
+	if r.Status == "submitted" && r.SubmittedAt == "" {
+		r.SubmittedAt = r.Timestamp
+	}
+	if r.Latitude < -90 || r.Latitude > 90 || r.Longitude < -180 || r.Longitude > 180 {
+		return invalid("coordinates out of range")
+	}
+
+	r.ViolationCode = ""
+	if r.ViolationType != "" && s.Violations != nil {
+		typ, ok := s.Violations.Resolve(r.ViolationType)
+		if !ok {
+			return fmt.Errorf("%w: %s", violation.ErrUnknownType, r.ViolationType)
+		}
+		r.ViolationType, r.ViolationCode = typ.ID, typ.Code
+	}
+	if r.Vehicle != nil {
+		if *r.Vehicle == (model.Vehicle{}) {
+			r.Vehicle = nil
+		} else {
+			v, err := vehicle.Validate(*r.Vehicle)
+			if err != nil {
+				return err
+			}
+			r.Vehicle = &v
+		}
+	}
+	if r.Provider == "" && (r.City != "" || r.RoadName != "") {
+		r.Provider = "import"
+	}
+	r.VideoPath, r.VideoKey, r.Attachments, r.MediaPurgedAt = "", "", nil, ""
+	r.DuplicateOf, r.LegalHold, r.LegalHoldReason = "", false, ""
+	return nil
+}
+
+// fillLocation 用地理编码结果补全缺失的城市和道路，已有的值保持不变
+func (s *ReportService) fillLocation(ctx context.Context, r *model.Report) error {
+	g := *r
+	if err := s.geocode(ctx, &g); err != nil {
+		return err
+	}
+	if r.City == "" {
+		r.City = g.City
+	}
+	if r.RoadName == "" {
+		r.RoadName = g.RoadName
+		r.IsHighway = g.IsHighway
+	}
+	r.Provider = g.Provider
+	return nil
+}
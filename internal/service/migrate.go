@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"SnapReport/internal/model"
+	"SnapReport/internal/store"
+	"SnapReport/internal/tenant"
+	"SnapReport/internal/vehicle"
+)
+
+// MigrateChange 是一份报告上执行（或试运行时将要执行）的升级
+type MigrateChange struct {
+	ReportID string   `json:"report_id"`
+	Changes  []string `json:"changes"`
+}
+
+// MigrateResult 是一次数据升级的结果
+type MigrateResult struct {
+	DryRun  bool            `json:"dry_run"`
+	Scanned int             `json:"scanned"`
+	Changed []MigrateChange `json:"changed"`
+	Errors  []string        `json:"errors,omitempty"`
+}
+
+// Migrate 将旧版本保存的报告升级到当前格式：补全组织和提交时间、把违法
+// 类型别名和号牌规范化、把仍留在本地的视频转存到媒体存储。升级可以重复
+// 执行，已是当前格式的报告不会被修改。dryRun 时只返回将要执行的升级。
+func (s *ReportService) Migrate(ctx context.Context, dryRun bool) MigrateResult {
+	res := MigrateResult{DryRun: dryRun, Changed: []MigrateChange{}}
+	for _, r := range s.Store.Query(store.Filter{}) {
+		if ctx.Err() != nil {
+			res.Errors = append(res.Errors, ctx.Err().Error())
+			break
+		}
+		res.Scanned++
+		changes, err := s.migrateReport(ctx, r.ID, dryRun)
+		if err != nil {
+			res.Errors = append(res.Errors, r.ID+": "+err.Error())
+		}
+		if len(changes) > 0 {
+			res.Changed = append(res.Changed, MigrateChange{ReportID: r.ID, Changes: changes})
+		}
+	}
+	return res
+}
+
+// migrateReport 在 s.mu 下升级一份报告，返回所做的修改。转存视频失败时
+// 其余修改仍会保存。
+func (s *ReportService) migrateReport(ctx context.Context, id string, dryRun bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.Store.Get(id)
+	if !ok {
+		return nil, nil
+	}
+	changes := s.upgrade(&r)
+
+	var err error
+	if r.VideoPath != "" && r.VideoKey == "" && s.Blobs != nil && r.MediaPurgedAt == "" {
+		if dryRun {
+			changes = append(changes, "store local clip")
+		} else if err = s.storeClip(ctx, &r, nil); err == nil {
+			changes = append(changes, "store local clip as "+r.VideoKey)
+		}
+	}
+	if len(changes) > 0 && !dryRun {
+		if serr := s.Store.Save(r); serr != nil {
+			return nil, serr
+		}
+	}
+	return changes, err
+}
+
+// upgrade 修改 r 中可以就地补全或规范化的字段
+func (s *ReportService) upgrade(r *model.Report) []string {
+	var changes []string
+	if r.OrgID == "" {
+		r.OrgID = tenant.DefaultOrg
+		changes = append(changes, "set org_id "+tenant.DefaultOrg)
+	}
+	if r.Status == "submitted" && r.SubmittedAt == "" {
+		// 旧版本没有记录提交时间，以创建时间代替，保留期限因此只会提前
+		r.SubmittedAt = r.Timestamp
+		if r.SubmittedAt == "" {
+			r.SubmittedAt = time.Now().UTC().Format(time.RFC3339)
+		}
+		changes = append(changes, "set submitted_at")
+	}
+	if r.ViolationType != "" && s.Violations != nil {
+		if typ, ok := s.Violations.Resolve(r.ViolationType); ok && (typ.ID != r.ViolationType || typ.Code != r.ViolationCode) {
+			r.ViolationType, r.ViolationCode = typ.ID, typ.Code
+			changes = append(changes, "normalize violation_type "+typ.ID)
+		}
+	}
+	if r.Vehicle != nil {
+		// 无法通过校验的号牌保持原样，避免丢失人工录入的信息
+		if v, err := vehicle.Validate(*r.Vehicle); err == nil && v != *r.Vehicle {
+			r.Vehicle = &v
+			changes = append(changes, "normalize vehicle")
+		}
+	}
+	return changes
+}
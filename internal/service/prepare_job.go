@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"SnapReport/internal/auth"
+	"SnapReport/internal/ddpai"
+	"SnapReport/internal/events"
+	"SnapReport/internal/job"
+	"SnapReport/internal/model"
+)
+
+// 异步准备任务的阶段名称
+const (
+	StageGeocode   = "geocode"
+	StageListClips = "list_clips"
+	StageDownload  = "download"
+	StageTrim      = "trim"
+	StageHash      = "hash"
+	StageStore     = "store"
+)
+
+// MediaConfig 控制视频的下载和处理目录、裁剪方式、上传大小限制和下载
+// 地址的有效期。处理完成的文件转存到 ReportService.Blobs。
+type MediaConfig struct {
+	Dir           string
+	FFmpegPath    string // 为空时跳过裁剪阶段
+	MaxImageBytes int64  // 上传照片的大小上限，为 0 时使用 DefaultMaxImageBytes
+	MaxVideoBytes int64  // 上传视频的大小上限，为 0 时使用 DefaultMaxVideoBytes
+	// URLExpiry 是附件下载地址的有效期，为 0 时使用 DefaultURLExpiry
+	URLExpiry time.Duration
+}
+
+// ErrJobsDisabled 表示服务未启用异步任务
+var ErrJobsDisabled = errors.New("async jobs not enabled")
+
+// EnableJobs 创建执行异步准备任务的 Manager，调用方负责 Start
+func (s *ReportService) EnableJobs(st job.Store, workers int) *job.Manager {
+	s.Jobs = job.NewManager(st, s.jobStages(), s.finishJob, workers)
+	s.Jobs.OnUpdate = func(j *job.Job) {
+		s.Events.Publish(events.JobProgress, j.Draft.OrgID, j.Draft.DeviceID, j)
+	}
+	return s.Jobs
+}
+
+// PrepareAsync 创建一个异步准备任务。报告 ID 在创建时即确定，任务成功后
+// 才能通过该 ID 查询到报告。
+func (s *ReportService) PrepareAsync(ctx context.Context, req PrepareRequest) (*job.Job, error) {
+	if s.Jobs == nil {
+		return nil, ErrJobsDisabled
+	}
+	draft, err := s.draft(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !auth.CanAccess(ctx, draft.OrgID, draft.DeviceID) {
+		return nil, ErrForbidden
+	}
+	j := job.New(draft, req.DurationSec, s.Jobs.StageNames())
+	if err := s.Jobs.Submit(j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Job 返回任务的当前状态，调用方无权访问的任务视为不存在
+func (s *ReportService) Job(ctx context.Context, id string) (*job.Job, bool) {
+	if s.Jobs == nil {
+		return nil, false
+	}
+	j, ok := s.Jobs.Store.Get(id)
+	if !ok || !auth.CanAccess(ctx, j.Draft.OrgID, j.Draft.DeviceID) {
+		return nil, false
+	}
+	return j, true
+}
+
+func (s *ReportService) jobStages() []job.Stage {
+	return []job.Stage{
+		s.timed(StageGeocode, s.runGeocode),
+		s.timed(StageListClips, s.runListClips),
+		s.timed(StageDownload, s.runDownload),
+		s.timed(StageTrim, s.runTrim),
+		s.timed(StageHash, s.runHash),
+		s.timed(StageStore, s.runStore),
+	}
+}
+
+// timed 记录阶段的耗时，跳过的阶段不记录
+func (s *ReportService) timed(name string, run func(context.Context, *job.Job, func(float64)) error) job.Stage {
+	return job.Stage{Name: name, Run: func(ctx context.Context, j *job.Job, progress func(float64)) error {
+		start := time.Now()
+		err := run(ctx, j, progress)
+		if !errors.Is(err, job.ErrSkipped) {
+			s.Metrics.ObserveStage(name, time.Since(start), err)
+		}
+		return err
+	}}
+}
+
+func (s *ReportService) runGeocode(ctx context.Context, j *job.Job, _ func(float64)) error {
+	return s.geocode(ctx, &j.Draft)
+}
+
+func (s *ReportService) runListClips(ctx context.Context, j *job.Job, _ func(float64)) error {
+	return s.capture(ctx, &j.Draft, j.DurationSec)
+}
+
+func (s *ReportService) runDownload(ctx context.Context, j *job.Job, progress func(float64)) error {
+	if j.Draft.VideoURL == "" {
+		return job.ErrSkipped
+	}
+	if err := os.MkdirAll(s.Media.Dir, 0o755); err != nil {
+		return err
+	}
+	dst := filepath.Join(s.Media.Dir, j.ID+"_"+clipName(j.Draft.VideoURL))
+	tmp := dst + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	live := s.settings()
+	ctx, cancel := withStageTimeout(ctx, live.Timeouts.Download)
+	defer cancel()
+	last := 0.0
+	n, err := live.DDPai.Download(ctx, j.Draft.DeviceID, j.Draft.VideoURL, f, func(done, total int64) {
+		if total <= 0 {
+			return
+		}
+		// 每 5% 报告一次，避免频繁持久化
+		if p := float64(done) / float64(total); p-last >= 0.05 {
+			last = p
+			progress(p)
+		}
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if errors.Is(err, ddpai.ErrMockClip) {
+		return job.ErrSkipped
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	j.Draft.VideoPath = dst
+	j.Draft.VideoSize = n
+	return nil
+}
+
+// runTrim 用 ffmpeg 保留视频的最后 DurationSec 秒，不重新编码
+func (s *ReportService) runTrim(ctx context.Context, j *job.Job, _ func(float64)) error {
+	if s.Media.FFmpegPath == "" || j.Draft.VideoPath == "" || j.DurationSec <= 0 {
+		return job.ErrSkipped
+	}
+	src := j.Draft.VideoPath
+	tmp := src + ".trim" + filepath.Ext(src)
+	cmd := exec.CommandContext(ctx, s.Media.FFmpegPath,
+		"-y", "-loglevel", "error",
+		"-sseof", "-"+strconv.Itoa(j.DurationSec),
+		"-i", src, "-c", "copy", tmp)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("ffmpeg: %v: %s", err, out)
+	}
+	if err := os.Rename(tmp, src); err != nil {
+		return err
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	j.Draft.VideoSize = fi.Size()
+	return nil
+}
+
+func (s *ReportService) runHash(ctx context.Context, j *job.Job, _ func(float64)) error {
+	if j.Draft.VideoPath == "" {
+		return job.ErrSkipped
+	}
+	f, err := os.Open(j.Draft.VideoPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	j.Draft.VideoSHA256 = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// runStore 将处理完成的视频转存到媒体存储并删除本地文件
+func (s *ReportService) runStore(ctx context.Context, j *job.Job, progress func(float64)) error {
+	if s.Blobs == nil || j.Draft.VideoPath == "" {
+		return job.ErrSkipped
+	}
+	return s.storeClip(ctx, &j.Draft, progress)
+}
+
+func (s *ReportService) storeClip(ctx context.Context, r *model.Report, progress func(float64)) error {
+	f, err := os.Open(r.VideoPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	key := mediaKey(r.ID, "clip"+filepath.Ext(r.VideoPath))
+	var body io.Reader = f
+	if progress != nil && fi.Size() > 0 {
+		body = &progressReader{r: f, total: fi.Size(), progress: progress}
+	}
+	if err := s.Blobs.Put(ctx, key, body, fi.Size(), "video/mp4"); err != nil {
+		return err
+	}
+	f.Close()
+	os.Remove(r.VideoPath)
+	r.VideoKey = key
+	r.VideoPath = ""
+	return nil
+}
+
+// progressReader 每读取 5% 报告一次进度
+type progressReader struct {
+	r           io.Reader
+	done, total int64
+	last        float64
+	progress    func(float64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if f := float64(p.done) / float64(p.total); f-p.last >= 0.05 {
+		p.last = f
+		p.progress(f)
+	}
+	return n, err
+}
+
+func (s *ReportService) finishJob(ctx context.Context, j *job.Job) (string, error) {
+	report := j.Draft
+	// 旧版本创建的任务没有 store 阶段
+	if s.Blobs != nil && report.VideoPath != "" && report.VideoKey == "" {
+		if err := s.storeClip(ctx, &report, nil); err != nil {
+			return "", err
+		}
+	}
+	if err := s.checkEvidence(report, j.DurationSec, true); err != nil {
+		return "", err
+	}
+	report.Status = "prepared"
+	if err := s.saveNew(&report); err != nil {
+		var dup *DuplicateError
+		switch {
+		case errors.As(err, &dup):
+			// 任务指向已有报告
+			return dup.Existing.ID, nil
+		case errors.Is(err, ErrReportExists):
+			// 上次保存后进程在记录任务结果之前退出
+			return report.ID, nil
+		}
+		return "", err
+	}
+	s.Events.Publish(events.ReportCreated, report.OrgID, report.DeviceID, report)
+	return report.ID, nil
+}
+
+// clipName 从下载地址中提取文件名
+func clipName(videoURL string) string {
+	u, err := url.Parse(videoURL)
+	if err != nil {
+		return "clip.mp4"
+	}
+	name := path.Base(u.Query().Get("file"))
+	if name == "" || name == "." || name == "/" {
+		return "clip.mp4"
+	}
+	return name
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"SnapReport/internal/blob"
+)
+
+// DefaultReconcileGrace 是手动对账时默认的宽限期
+const DefaultReconcileGrace = time.Hour
+
+// ReconcileOptions 控制媒体存储对账
+type ReconcileOptions struct {
+	// Grace 内新写入的未引用对象不算孤立，它们可能属于正在进行的上传或任务
+	Grace         time.Duration
+	DeleteOrphans bool
+}
+
+// MissingBlob 是报告引用但存储中不存在的对象
+type MissingBlob struct {
+	ReportID string `json:"report_id"`
+	Key      string `json:"key"`
+}
+
+// ReconcileResult 是一次对账的结果
+type ReconcileResult struct {
+	StartedAt  string        `json:"started_at"`
+	FinishedAt string        `json:"finished_at"`
+	Objects    int           `json:"objects"`    // 存储中的对象数
+	Referenced int           `json:"referenced"` // 报告和未完成任务引用的对象数
+	Orphaned   []blob.Info   `json:"orphaned"`   // 没有被引用的对象
+	Missing    []MissingBlob `json:"missing"`    // 被引用但不存在的对象
+	Deleted    []string      `json:"deleted,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Reconcile 比较媒体存储中 reports/ 下的对象与报告的引用，找出孤立和缺失的对象。
+// 先读取引用再列出对象，避免把对账期间新上传的对象误报为缺失。
+func (s *ReportService) Reconcile(ctx context.Context, opts ReconcileOptions) (ReconcileResult, error) {
+	res := ReconcileResult{
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+		Orphaned:  []blob.Info{},
+		Missing:   []MissingBlob{},
+	}
+	if s.Blobs == nil {
+		return res, ErrStorageDisabled
+	}
+
+	refs := map[string]string{} // key -> report ID
+	for _, r := range s.Store.List() {
+		if r.VideoKey != "" {
+			refs[r.VideoKey] = r.ID
+		}
+		for _, a := range r.Attachments {
+			if a.Key != "" {
+				refs[a.Key] = r.ID
+			}
+		}
+	}
+	if s.Jobs != nil {
+		for _, j := range s.Jobs.Store.List() {
+			if !j.Finished() && j.Draft.VideoKey != "" {
+				refs[j.Draft.VideoKey] = j.Draft.ID
+			}
+		}
+	}
+	res.Referenced = len(refs)
+
+	objects, err := s.Blobs.List(ctx, "reports/")
+	if err != nil {
+		return res, err
+	}
+	res.Objects = len(objects)
+	cutoff := time.Now().Add(-opts.Grace)
+	seen := make(map[string]bool, len(objects))
+	for _, o := range objects {
+		seen[o.Key] = true
+		if _, ok := refs[o.Key]; ok || o.ModTime.After(cutoff) {
+			continue
+		}
+		res.Orphaned = append(res.Orphaned, o)
+		if opts.DeleteOrphans {
+			if err := s.Blobs.Delete(ctx, o.Key); err != nil {
+				return res, err
+			}
+			res.Deleted = append(res.Deleted, o.Key)
+		}
+	}
+	for key, id := range refs {
+		if !seen[key] {
+			res.Missing = append(res.Missing, MissingBlob{ReportID: id, Key: key})
+		}
+	}
+	sort.Slice(res.Missing, func(a, b int) bool { return res.Missing[a].Key < res.Missing[b].Key })
+	res.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	return res, nil
+}
+
+// RunReconciler 每隔 interval 对账一次，直到 ctx 被取消。结果写入日志，
+// 最近一次结果可通过 LastReconcile 查询。
+func (s *ReportService) RunReconciler(ctx context.Context, interval time.Duration, opts ReconcileOptions) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.ReconcileNow(ctx, opts)
+		}
+	}
+}
+
+// ReconcileNow 执行一次对账并记录结果，失败时结果的 Error 为错误信息
+func (s *ReportService) ReconcileNow(ctx context.Context, opts ReconcileOptions) (ReconcileResult, error) {
+	res, err := s.Reconcile(ctx, opts)
+	if err != nil {
+		res.Error = err.Error()
+		log.Printf("Media reconcile failed: %v", err)
+	} else if len(res.Orphaned) > 0 || len(res.Missing) > 0 {
+		log.Printf("Media reconcile: %d objects, %d orphaned (%d deleted), %d missing",
+			res.Objects, len(res.Orphaned), len(res.Deleted), len(res.Missing))
+	}
+	s.mu.Lock()
+	s.lastReconcile = &res
+	s.mu.Unlock()
+	return res, err
+}
+
+// LastReconcile 返回最近一次对账的结果
+func (s *ReportService) LastReconcile() (ReconcileResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastReconcile == nil {
+		return ReconcileResult{}, false
+	}
+	return *s.lastReconcile, true
+}
@@ -1,90 +1,449 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strconv"
+	"sync"
 	"time"
 
+	"SnapReport/internal/audit"
+	"SnapReport/internal/auth"
+	"SnapReport/internal/blob"
 	"SnapReport/internal/ddpai"
+	"SnapReport/internal/events"
 	"SnapReport/internal/geo"
+	"SnapReport/internal/ids"
+	"SnapReport/internal/job"
+	"SnapReport/internal/metrics"
 	"SnapReport/internal/model"
+	"SnapReport/internal/stats"
 	"SnapReport/internal/store"
+	"SnapReport/internal/tenant"
+	"SnapReport/internal/vehicle"
+	"SnapReport/internal/violation"
 )
 
+var (
+	ErrReportNotFound = errors.New("report not found")
+	// ErrForbidden 表示调用方不拥有请求中的设备
+	ErrForbidden = errors.New("device not owned by caller")
+	// ErrReportSubmitted 表示报告已提交，不能再修改
+	ErrReportSubmitted = errors.New("report already submitted")
+	// ErrInvalidOccurredAt 表示事件发生时间不是 RFC3339 格式
+	ErrInvalidOccurredAt = errors.New("occurred_at must be RFC3339")
+)
+
+// ReportIDPrefix 是报告 ID 的前缀，ID 格式见 ids 包
+const ReportIDPrefix = "rep_"
+
 type ReportService struct {
-	Store    store.Store
+	Store store.Store
+	// Geocoder、DDPai 和 Timeouts 在服务运行后只能通过 Reconfigure 替换
+	Geocoder geo.Geocoder
+	DDPai    *ddpai.Client
+	Timeouts Timeouts
+	Media    MediaConfig
+	Blobs    blob.Store // 为 nil 时不能上传附件，下载的视频保留在 Media.Dir
+	Jobs     *job.Manager
+	Events   *events.Bus      // 可为 nil
+	Tenants  *tenant.Registry // 为 nil 时所有组织使用 Geocoder
+	// Violations 用于校验 PrepareRequest.ViolationType 及其证据要求
+	Violations *violation.Taxonomy
+	Dedup      DedupConfig
+	// Retention 是保留规则，为空时不清理任何报告
+	Retention []RetentionRule
+	Audit     *audit.Log // 为 nil 时不记录审计日志
+	// Metrics 记录 Prepare 各阶段和地理编码的耗时，可为 nil
+	Metrics *metrics.Metrics
+
+	// live 保护 Reconfigure 替换的字段
+	live sync.RWMutex
+	// mu 串行化需要先读后写的保存，例如重复检测和追加附件
+	mu            sync.Mutex
+	lastReconcile *ReconcileResult
+}
+
+// Timeouts 是 Prepare 各阶段的期限，零值表示只受调用方 context 约束
+type Timeouts struct {
+	Geocode  time.Duration
+	Capture  time.Duration
+	Download time.Duration
+}
+
+// Settings 是可以在服务运行时替换的设置
+type Settings struct {
 	Geocoder geo.Geocoder
 	DDPai    *ddpai.Client
+	Timeouts Timeouts
+}
+
+// Reconfigure 原子地替换全局地理编码器、设备客户端和各阶段期限。
+// 进行中的 Prepare 在每个阶段开始时取得设置，已经开始的阶段不受影响。
+func (s *ReportService) Reconfigure(st Settings) {
+	s.live.Lock()
+	defer s.live.Unlock()
+	s.Geocoder, s.DDPai, s.Timeouts = st.Geocoder, st.DDPai, st.Timeouts
+}
+
+// settings 返回当前的设置
+func (s *ReportService) settings() Settings {
+	s.live.RLock()
+	defer s.live.RUnlock()
+	return Settings{Geocoder: s.Geocoder, DDPai: s.DDPai, Timeouts: s.Timeouts}
 }
 
 func NewReportService(s store.Store, g geo.Geocoder, d *ddpai.Client) *ReportService {
 	return &ReportService{
-		Store:    s,
-		Geocoder: g,
-		DDPai:    d,
+		Store:      s,
+		Geocoder:   g,
+		DDPai:      d,
+		Violations: violation.Default(),
 	}
 }
 
 type PrepareRequest struct {
+	// OrgID 只对不受组织限制的调用方生效，其余调用方固定使用自己的组织
+	OrgID       string
 	DeviceID    string
 	Latitude    float64
 	Longitude   float64
 	DurationSec int
 	Tags        []string
+
+	// ViolationType 可以是分类中的 ID、代码、名称或别名，保存时统一为 ID
+	ViolationType string
+	Description   string
+	OccurredAt    string
+
+	// Vehicle 是违法车辆，号牌会被校验并规范化
+	Vehicle *model.Vehicle
+}
+
+// Prepare 逆地理编码并抓取视频，生成一份待发送的报告。ctx 被取消时
+// 未完成的地理编码和设备请求会一并取消，且不会保存报告。与已有报告
+// 确定重复时不创建新报告，返回 *DuplicateError。
+func (s *ReportService) Prepare(ctx context.Context, req PrepareRequest) (*model.Report, error) {
+	report, err := s.draft(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !auth.CanAccess(ctx, report.OrgID, report.DeviceID) {
+		return nil, ErrForbidden
+	}
+	start := time.Now()
+	err = s.geocode(ctx, &report)
+	s.Metrics.ObserveStage(StageGeocode, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	start = time.Now()
+	err = s.capture(ctx, &report, req.DurationSec)
+	s.Metrics.ObserveStage(StageListClips, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.checkEvidence(report, req.DurationSec, true); err != nil {
+		return nil, err
+	}
+
+	report.Status = "prepared"
+	if err := s.saveNew(&report); err != nil {
+		return nil, err
+	}
+	s.Events.Publish(events.ReportCreated, report.OrgID, report.DeviceID, report)
+	return &report, nil
+}
+
+// draft 根据请求构造报告，校验违法类型以及抓取前即可判断的证据要求
+func (s *ReportService) draft(ctx context.Context, req PrepareRequest) (model.Report, error) {
+	orgID, restricted := auth.OrgFromContext(ctx)
+	if !restricted && req.OrgID != "" {
+		orgID = req.OrgID
+	}
+	r := model.Report{
+		ID:          s.newID(),
+		OrgID:       orgID,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
+		DeviceID:    req.DeviceID,
+		Tags:        req.Tags,
+		Description: req.Description,
+	}
+	occurredAt, err := normalizeOccurredAt(req.OccurredAt)
+	if err != nil {
+		return r, err
+	}
+	r.OccurredAt = occurredAt
+	if req.ViolationType != "" && s.Violations != nil {
+		typ, ok := s.Violations.Resolve(req.ViolationType)
+		if !ok {
+			return r, fmt.Errorf("%w: %s", violation.ErrUnknownType, req.ViolationType)
+		}
+		r.ViolationType = typ.ID
+		r.ViolationCode = typ.Code
+	}
+	if req.Vehicle != nil {
+		v, err := vehicle.Validate(*req.Vehicle)
+		if err != nil {
+			return r, err
+		}
+		r.Vehicle = &v
+	}
+	return r, s.checkEvidence(r, req.DurationSec, false)
 }
 
-func (s *ReportService) Prepare(req PrepareRequest) (*model.Report, error) {
-	city, road, category, err := s.Geocoder.ReverseGeocode(req.Latitude, req.Longitude)
+// normalizeOccurredAt 校验 RFC3339 格式的事件发生时间并转换为 UTC，空字符串保持为空
+func normalizeOccurredAt(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
 	if err != nil {
+		return "", ErrInvalidOccurredAt
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// unknownDuration 表示视频时长未知，例如修改已保存的报告时，此时不检查最短时长
+const unknownDuration = -1
+
+// checkEvidence 检查报告是否满足违法类型的证据要求，captured 为 false 时跳过视频检查。
+// 上传的视频附件也算作视频证据。
+func (s *ReportService) checkEvidence(r model.Report, durationSec int, captured bool) error {
+	if r.ViolationType == "" || s.Violations == nil {
+		return nil
+	}
+	typ, ok := s.Violations.Resolve(r.ViolationType)
+	if !ok {
+		return nil
+	}
+	if durationSec == unknownDuration {
+		durationSec = typ.Evidence.MinDurationSec
+	}
+	return typ.Check(durationSec, r.Latitude, r.Longitude, !captured || hasVideo(r))
+}
+
+func hasVideo(r model.Report) bool {
+	if r.VideoURL != "" {
+		return true
+	}
+	for _, a := range r.Attachments {
+		if a.Kind == "video" {
+			return true
+		}
+	}
+	return false
+}
+
+// geocode 填充报告的位置信息。地理编码失败不影响报告，只有 ctx 被取消时才返回错误。
+func (s *ReportService) geocode(ctx context.Context, r *model.Report) error {
+	g := s.geocoderFor(r.OrgID)
+	geoCtx, cancel := withStageTimeout(ctx, s.settings().Timeouts.Geocode)
+	start := time.Now()
+	city, road, category, err := g.ReverseGeocode(geoCtx, r.Latitude, r.Longitude)
+	cancel()
+	s.Metrics.ObserveGeocode(g.Provider(), time.Since(start), err)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		// Log error but continue, don't fail the whole request
 		fmt.Printf("Warning: geocode failed: %v\n", err)
 		city = "Unknown"
 		road = "Unknown"
 	}
+	r.City = city
+	r.RoadName = road
+	r.IsHighway = geo.ClassifyHighway(category, road)
+	r.Provider = g.Provider()
+	return nil
+}
 
-	isHighway := geo.ClassifyHighway(category, road)
+// geocoderFor 返回组织配置的地理编码器，组织未单独配置时使用全局地理编码器
+func (s *ReportService) geocoderFor(orgID string) geo.Geocoder {
+	if s.Tenants != nil {
+		if g := s.Tenants.Geocoder(orgID); g != nil {
+			return g
+		}
+	}
+	return s.settings().Geocoder
+}
 
-	videoURL, err := s.DDPai.CaptureRecentVideo(req.DeviceID, req.DurationSec)
+// capture 从设备获取最新视频的地址
+func (s *ReportService) capture(ctx context.Context, r *model.Report, durationSec int) error {
+	live := s.settings()
+	captureCtx, cancel := withStageTimeout(ctx, live.Timeouts.Capture)
+	videoURL, err := live.DDPai.CaptureRecentVideo(captureCtx, r.DeviceID, durationSec)
+	cancel()
 	if err != nil {
-		return nil, fmt.Errorf("capture video failed: %w", err)
-	}
-
-	id := s.newID()
-	now := time.Now().UTC().Format(time.RFC3339)
-	provider := s.Geocoder.Provider()
-	report := model.Report{
-		ID:        id,
-		Timestamp: now,
-		Latitude:  req.Latitude,
-		Longitude: req.Longitude,
-		City:      city,
-		RoadName:  road,
-		IsHighway: isHighway,
-		Provider:  provider,
-		VideoURL:  videoURL,
-		Status:    "prepared",
-		DeviceID:  req.DeviceID,
-		Tags:      req.Tags,
-	}
-	s.Store.Save(report)
-	return &report, nil
+		return fmt.Errorf("capture video failed: %w", err)
+	}
+	r.VideoURL = videoURL
+	return nil
 }
 
-func (s *ReportService) Send(id string) (*model.Report, error) {
+// Send 将报告标记为已提交。调用方无权访问的报告视为不存在。
+func (s *ReportService) Send(ctx context.Context, id string) (*model.Report, error) {
+	s.mu.Lock()
 	report, ok := s.Store.Get(id)
-	if !ok {
-		return nil, fmt.Errorf("report not found")
+	if !ok || !auth.CanAccess(ctx, report.OrgID, report.DeviceID) {
+		s.mu.Unlock()
+		return nil, ErrReportNotFound
 	}
+	previous := report.Status
 	report.Status = "submitted"
-	s.Store.Save(report)
+	if report.SubmittedAt == "" {
+		report.SubmittedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if err := s.Store.Save(report); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.mu.Unlock()
+	if previous != report.Status {
+		s.Events.Publish(events.ReportStatusChanged, report.OrgID, report.DeviceID, map[string]any{
+			"report":          report,
+			"previous_status": previous,
+			"submitter":       s.submitter(report.OrgID),
+		})
+	}
+	return &report, nil
+}
+
+// ReportPatch 是对报告的部分修改，nil 字段保持不变
+type ReportPatch struct {
+	ViolationType *string
+	Description   *string
+	OccurredAt    *string
+	Tags          []string
+	Vehicle       *model.Vehicle
+}
+
+// Update 修改尚未提交的报告，并发布 report.updated 事件。
+// 调用方无权访问的报告视为不存在。
+func (s *ReportService) Update(ctx context.Context, id string, p ReportPatch) (*model.Report, error) {
+	report, err := s.update(ctx, id, p)
+	if err != nil {
+		return nil, err
+	}
+	s.Events.Publish(events.ReportUpdated, report.OrgID, report.DeviceID, report)
 	return &report, nil
 }
 
-func (s *ReportService) List() []model.Report {
-	return s.Store.List()
+// update 在 s.mu 下重新读取并修改报告，避免覆盖保留策略或追加附件的修改
+func (s *ReportService) update(ctx context.Context, id string, p ReportPatch) (model.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report, ok := s.Store.Get(id)
+	if !ok || !auth.CanAccess(ctx, report.OrgID, report.DeviceID) {
+		return model.Report{}, ErrReportNotFound
+	}
+	if report.Status == "submitted" {
+		return model.Report{}, ErrReportSubmitted
+	}
+	if p.ViolationType != nil {
+		report.ViolationType, report.ViolationCode = "", ""
+		if *p.ViolationType != "" && s.Violations != nil {
+			typ, ok := s.Violations.Resolve(*p.ViolationType)
+			if !ok {
+				return model.Report{}, fmt.Errorf("%w: %s", violation.ErrUnknownType, *p.ViolationType)
+			}
+			report.ViolationType = typ.ID
+			report.ViolationCode = typ.Code
+		}
+		// 已保存的报告不记录视频时长，只检查坐标和视频
+		if err := s.checkEvidence(report, unknownDuration, true); err != nil {
+			return model.Report{}, err
+		}
+	}
+	if p.Description != nil {
+		report.Description = *p.Description
+	}
+	if p.OccurredAt != nil {
+		v, err := normalizeOccurredAt(*p.OccurredAt)
+		if err != nil {
+			return model.Report{}, err
+		}
+		report.OccurredAt = v
+	}
+	if p.Tags != nil {
+		report.Tags = p.Tags
+	}
+	if p.Vehicle != nil {
+		v, err := vehicle.Validate(*p.Vehicle)
+		if err != nil {
+			return model.Report{}, err
+		}
+		report.Vehicle = &v
+	}
+	if err := s.Store.Save(report); err != nil {
+		return model.Report{}, err
+	}
+	return report, nil
+}
+
+// submitter 返回组织配置的提交人信息
+func (s *ReportService) submitter(orgID string) tenant.SubmitterConfig {
+	if s.Tenants == nil {
+		return tenant.SubmitterConfig{}
+	}
+	org, _ := s.Tenants.Get(orgID)
+	return org.Submitter
+}
+
+// List 返回调用方可以访问且满足过滤条件的报告。受组织限制的调用方
+// 只能查询本组织，f.OrgID 会被覆盖。
+func (s *ReportService) List(ctx context.Context, f store.Filter) []model.Report {
+	if orgID, restricted := auth.OrgFromContext(ctx); restricted {
+		f.OrgID = orgID
+	}
+	all := s.Store.Query(f)
+	if _, ok := auth.UserFromContext(ctx); !ok {
+		return all
+	}
+	out := make([]model.Report, 0, len(all))
+	for _, r := range all {
+		if auth.CanAccess(ctx, r.OrgID, r.DeviceID) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Each 按 List 的顺序对调用方可以访问且满足过滤条件的报告逐个调用 fn，
+// 不会一次性载入全部报告。fn 返回错误或 ctx 被取消时停止并返回该错误。
+func (s *ReportService) Each(ctx context.Context, f store.Filter, fn func(model.Report) error) error {
+	if orgID, restricted := auth.OrgFromContext(ctx); restricted {
+		f.OrgID = orgID
+	}
+	return s.Store.Each(f, func(r model.Report) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !auth.CanAccess(ctx, r.OrgID, r.DeviceID) {
+			return nil
+		}
+		return fn(r)
+	})
+}
+
+// Stats 汇总调用方可以访问且满足过滤条件的报告
+func (s *ReportService) Stats(ctx context.Context, f store.Filter, opts stats.Options) stats.Stats {
+	return stats.Compute(s.List(ctx, f), opts)
+}
+
+func withStageTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
 }
 
 func (s *ReportService) newID() string {
-	now := time.Now().UTC().UnixNano()
-	return "rep_" + strconv.FormatInt(now, 36)
+	return ids.New(ReportIDPrefix)
 }
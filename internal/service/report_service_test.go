@@ -0,0 +1,1331 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"SnapReport/internal/audit"
+	"SnapReport/internal/auth"
+	"SnapReport/internal/blob"
+	"SnapReport/internal/blob/s3test"
+	"SnapReport/internal/ddpai"
+	"SnapReport/internal/ddpai/ddpaitest"
+	"SnapReport/internal/exif/exiftest"
+	"SnapReport/internal/ids"
+	"SnapReport/internal/job"
+	"SnapReport/internal/model"
+	"SnapReport/internal/store"
+	"SnapReport/internal/tenant"
+	"SnapReport/internal/vehicle"
+	"SnapReport/internal/violation"
+)
+
+type stubGeocoder struct {
+	city, road, category string
+	err                  error
+}
+
+func (g stubGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, string, string, error) {
+	return g.city, g.road, g.category, g.err
+}
+
+func (g stubGeocoder) Provider() string { return "stub" }
+
+func newTestService(t *testing.T, mock bool) (*ReportService, *ddpaitest.Server) {
+	t.Helper()
+	dev := ddpaitest.NewServer()
+	t.Cleanup(dev.Close)
+	g := stubGeocoder{city: "深圳市", road: "广深沿江高速", category: "motorway"}
+	svc := NewReportService(store.NewMemoryStore(), g, ddpai.NewClient(dev.URL, 2, mock))
+	return svc, dev
+}
+
+func fetch(t *testing.T, url string) []byte {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("download %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("download %s: status %d", url, resp.StatusCode)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return b
+}
+
+func TestPrepareAgainstFakeDevice(t *testing.T) {
+	for _, shape := range []ddpaitest.ListShape{ddpaitest.ListArray, ddpaitest.ListObject} {
+		svc, dev := newTestService(t, false)
+		dev.SetListShape(shape)
+		dev.SetFiles(
+			ddpaitest.File{Name: "old.mp4", Data: []byte("old")},
+			ddpaitest.File{Name: "latest.mp4", Data: ddpaitest.SampleClip()},
+		)
+
+		report, err := svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", Latitude: 22.5, Longitude: 113.9, DurationSec: 20})
+		if err != nil {
+			t.Fatalf("shape %d: prepare: %v", shape, err)
+		}
+		if !strings.Contains(report.VideoURL, "file=latest.mp4") || !strings.Contains(report.VideoURL, "session=fake-session") {
+			t.Fatalf("shape %d: unexpected video url %q", shape, report.VideoURL)
+		}
+		if !report.IsHighway || report.City != "深圳市" || report.Provider != "stub" {
+			t.Fatalf("shape %d: unexpected report %+v", shape, report)
+		}
+		if !dev.SuperDownload() {
+			t.Fatalf("shape %d: super download not enabled", shape)
+		}
+		if got := fetch(t, report.VideoURL); !bytes.Equal(got, ddpaitest.SampleClip()) {
+			t.Fatalf("shape %d: downloaded %d bytes, want sample clip", shape, len(got))
+		}
+		if _, ok := svc.Store.Get(report.ID); !ok {
+			t.Fatalf("shape %d: report not saved", shape)
+		}
+	}
+}
+
+func TestPrepareUsesFileKey(t *testing.T) {
+	svc, dev := newTestService(t, false)
+	dev.SetNameKey("file")
+	report, err := svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if !strings.Contains(report.VideoURL, "file=20240101120000_0010.mp4") {
+		t.Fatalf("unexpected video url %q", report.VideoURL)
+	}
+}
+
+func TestPrepareWithoutSession(t *testing.T) {
+	svc, dev := newTestService(t, false)
+	dev.SetSession("")
+	report, err := svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if strings.Contains(report.VideoURL, "session=") {
+		t.Fatalf("unexpected session in url %q", report.VideoURL)
+	}
+	fetch(t, report.VideoURL)
+}
+
+func TestPrepareDeviceFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		f    ddpaitest.Failure
+	}{
+		{"session 500", ddpaitest.CmdSession, ddpaitest.Failure{Status: http.StatusInternalServerError}},
+		{"list 503", ddpaitest.CmdPlaybackList, ddpaitest.Failure{Status: http.StatusServiceUnavailable}},
+		{"list malformed", ddpaitest.CmdPlaybackList, ddpaitest.Failure{Status: http.StatusOK, Body: "{not json"}},
+	}
+	for _, tt := range tests {
+		svc, dev := newTestService(t, false)
+		dev.Fail(tt.cmd, tt.f)
+		if _, err := svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 20}); err == nil {
+			t.Fatalf("%s: expected error", tt.name)
+		}
+		if n := len(svc.List(context.Background(), store.Filter{})); n != 0 {
+			t.Fatalf("%s: %d reports saved after failure", tt.name, n)
+		}
+	}
+}
+
+func TestPrepareMockFallback(t *testing.T) {
+	svc, dev := newTestService(t, true)
+	dev.Fail(ddpaitest.CmdSession, ddpaitest.Failure{Status: http.StatusInternalServerError, Times: 1})
+
+	report, err := svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 15})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if report.VideoURL != "ddpai://device/dev1/clip?duration=15" {
+		t.Fatalf("expected mock url, got %q", report.VideoURL)
+	}
+
+	// 故障只注入一次，第二次应走真实设备
+	report, err = svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 15})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if !strings.HasPrefix(report.VideoURL, dev.URL) {
+		t.Fatalf("expected device url, got %q", report.VideoURL)
+	}
+	if dev.Calls(ddpaitest.CmdSession) != 2 {
+		t.Fatalf("session calls = %d, want 2", dev.Calls(ddpaitest.CmdSession))
+	}
+}
+
+func TestPrepareGeocodeFailureStillCaptures(t *testing.T) {
+	svc, _ := newTestService(t, false)
+	svc.Geocoder = stubGeocoder{err: errors.New("boom")}
+	report, err := svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if report.City != "Unknown" || report.RoadName != "Unknown" {
+		t.Fatalf("unexpected location %q/%q", report.City, report.RoadName)
+	}
+}
+
+func TestPrepareEmptyDevice(t *testing.T) {
+	svc, dev := newTestService(t, false)
+	dev.SetFiles()
+	report, err := svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if report.VideoURL != "" {
+		t.Fatalf("expected empty video url, got %q", report.VideoURL)
+	}
+}
+
+type blockingGeocoder struct{}
+
+func (blockingGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, string, string, error) {
+	<-ctx.Done()
+	return "", "", "", ctx.Err()
+}
+
+func (blockingGeocoder) Provider() string { return "blocking" }
+
+func TestPrepareGeocodeStageTimeout(t *testing.T) {
+	svc, _ := newTestService(t, false)
+	svc.Geocoder = blockingGeocoder{}
+	svc.Timeouts.Geocode = 20 * time.Millisecond
+
+	report, err := svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if report.City != "Unknown" {
+		t.Fatalf("expected geocode fallback, got %q", report.City)
+	}
+}
+
+func TestPrepareCaptureStageTimeout(t *testing.T) {
+	svc, dev := newTestService(t, true)
+	svc.Timeouts.Capture = 20 * time.Millisecond
+	dev.Fail(ddpaitest.CmdPlaybackList, ddpaitest.Failure{Delay: time.Second})
+
+	start := time.Now()
+	_, err := svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded without mock fallback, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("prepare did not stop at capture deadline")
+	}
+}
+
+func TestPrepareCancelled(t *testing.T) {
+	svc, dev := newTestService(t, true)
+	dev.Fail(ddpaitest.CmdPlaybackList, ddpaitest.Failure{Delay: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if n := len(svc.List(context.Background(), store.Filter{})); n != 0 {
+		t.Fatalf("%d reports saved after cancel", n)
+	}
+
+	// 地理编码阶段被取消时同样中止
+	svc.Geocoder = blockingGeocoder{}
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if dev.Calls(ddpaitest.CmdSession) != 1 {
+		t.Fatalf("device contacted after geocode was cancelled")
+	}
+}
+
+func TestPrepareAsyncDownloadsAndHashes(t *testing.T) {
+	svc, _ := newTestService(t, false)
+	svc.Media.Dir = t.TempDir()
+	st, err := job.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.EnableJobs(st, 1).Start(ctx)
+
+	j, err := svc.PrepareAsync(context.Background(), PrepareRequest{DeviceID: "dev1", Latitude: 22.5, Longitude: 113.9, DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare async: %v", err)
+	}
+
+	var got *job.Job
+	for i := 0; i < 200; i++ {
+		got, _ = svc.Job(context.Background(), j.ID)
+		if got.Finished() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.Status != job.StatusSucceeded {
+		t.Fatalf("job did not succeed: %+v", got)
+	}
+	want := map[string]job.StageStatus{
+		StageGeocode:   job.StageDone,
+		StageListClips: job.StageDone,
+		StageDownload:  job.StageDone,
+		StageTrim:      job.StageSkipped,
+		StageHash:      job.StageDone,
+		StageStore:     job.StageSkipped,
+	}
+	for _, s := range got.Stages {
+		if s.Status != want[s.Name] {
+			t.Fatalf("stage %s = %s, want %s", s.Name, s.Status, want[s.Name])
+		}
+	}
+
+	report, ok := svc.Store.Get(got.ReportID)
+	if !ok {
+		t.Fatalf("report %s not saved", got.ReportID)
+	}
+	data, err := os.ReadFile(report.VideoPath)
+	if err != nil {
+		t.Fatalf("read downloaded clip: %v", err)
+	}
+	sum := sha256.Sum256(ddpaitest.SampleClip())
+	if !bytes.Equal(data, ddpaitest.SampleClip()) || report.VideoSHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("downloaded clip or hash mismatch: %+v", report)
+	}
+	if report.City != "深圳市" || report.Status != "prepared" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestReportsScopedToDeviceOwner(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	alice := auth.WithUser(context.Background(), &auth.User{ID: "alice", OrgID: tenant.DefaultOrg, Role: auth.RoleUser, Devices: []string{"dev-a"}})
+	bob := auth.WithUser(context.Background(), &auth.User{ID: "bob", OrgID: tenant.DefaultOrg, Role: auth.RoleUser, Devices: []string{"dev-b"}})
+	admin := auth.WithUser(context.Background(), &auth.User{ID: "root", OrgID: tenant.DefaultOrg, Role: auth.RoleAdmin})
+
+	ra, err := svc.Prepare(alice, PrepareRequest{DeviceID: "dev-a", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("alice prepare: %v", err)
+	}
+	if _, err := svc.Prepare(bob, PrepareRequest{DeviceID: "dev-b", DurationSec: 20}); err != nil {
+		t.Fatalf("bob prepare: %v", err)
+	}
+	if _, err := svc.Prepare(bob, PrepareRequest{DeviceID: "dev-a", DurationSec: 20}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("bob prepared on alice's device: %v", err)
+	}
+
+	if got := svc.List(alice, store.Filter{}); len(got) != 1 || got[0].DeviceID != "dev-a" {
+		t.Fatalf("alice sees %+v", got)
+	}
+	if got := svc.List(admin, store.Filter{}); len(got) != 2 {
+		t.Fatalf("admin sees %d reports, want 2", len(got))
+	}
+	if _, err := svc.Send(bob, ra.ID); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("bob sent alice's report: %v", err)
+	}
+	if _, err := svc.Send(alice, ra.ID); err != nil {
+		t.Fatalf("alice send: %v", err)
+	}
+}
+
+type namedGeocoder string
+
+func (g namedGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, string, string, error) {
+	return string(g), "road", "", nil
+}
+
+func (g namedGeocoder) Provider() string { return string(g) }
+
+func TestTenantsAreIsolated(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Tenants = tenant.NewRegistry(namedGeocoder("global"))
+	if _, err := svc.Tenants.Create(tenant.Org{ID: "fleet-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Tenants.Create(tenant.Org{ID: "fleet-b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	adminA := auth.WithUser(context.Background(), &auth.User{ID: "a", OrgID: "fleet-a", Role: auth.RoleAdmin})
+	adminB := auth.WithUser(context.Background(), &auth.User{ID: "b", OrgID: "fleet-b", Role: auth.RoleAdmin})
+	root := auth.WithUser(context.Background(), &auth.User{ID: "root", OrgID: tenant.DefaultOrg, Role: auth.RoleSuperAdmin})
+
+	// 两个组织使用相同的设备 ID
+	ra, err := svc.Prepare(adminA, PrepareRequest{OrgID: "fleet-b", DeviceID: "device_123", DurationSec: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra.OrgID != "fleet-a" {
+		t.Fatalf("org admin prepared into org %q", ra.OrgID)
+	}
+	if _, err := svc.Prepare(adminB, PrepareRequest{DeviceID: "device_123", DurationSec: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := svc.List(adminB, store.Filter{OrgID: "fleet-a"}); len(got) != 1 || got[0].OrgID != "fleet-b" {
+		t.Fatalf("fleet-b admin listed %+v", got)
+	}
+	if got := svc.List(root, store.Filter{OrgID: "fleet-a"}); len(got) != 1 || got[0].ID != ra.ID {
+		t.Fatalf("superadmin org query returned %+v", got)
+	}
+	if got := svc.List(root, store.Filter{}); len(got) != 2 {
+		t.Fatalf("superadmin sees %d reports, want 2", len(got))
+	}
+	if _, err := svc.Send(adminB, ra.ID); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("fleet-b sent fleet-a report: %v", err)
+	}
+}
+
+func TestTenantGeocoder(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Tenants = tenant.NewRegistry(namedGeocoder("global"))
+	if _, err := svc.Tenants.Create(tenant.Org{ID: "fleet-a", Geocoder: tenant.GeocoderConfig{Type: "amap", APIKey: "key-a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if g := svc.geocoderFor("fleet-a"); g.Provider() != "amap" {
+		t.Fatalf("fleet-a uses %s geocoder", g.Provider())
+	}
+	if g := svc.geocoderFor(tenant.DefaultOrg); g.Provider() != "global" {
+		t.Fatalf("default org uses %s geocoder", g.Provider())
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Tenants = tenant.NewRegistry(nil)
+	if _, err := svc.Tenants.Create(tenant.Org{ID: "fleet-a", Submitter: tenant.SubmitterConfig{Name: "A"}}); err != nil {
+		t.Fatal(err)
+	}
+	svc.Reconfigure(Settings{Geocoder: namedGeocoder("reloaded"), DDPai: svc.DDPai})
+	if g := svc.geocoderFor("fleet-a"); g.Provider() != "reloaded" {
+		t.Fatalf("fleet-a uses %s geocoder after reload", g.Provider())
+	}
+
+	if _, err := svc.Tenants.Put(tenant.Org{ID: "fleet-a", Geocoder: tenant.GeocoderConfig{Type: "amap", APIKey: "k"}, Submitter: tenant.SubmitterConfig{Name: "B"}}); err != nil {
+		t.Fatal(err)
+	}
+	if g := svc.geocoderFor("fleet-a"); g.Provider() != "amap" {
+		t.Fatalf("fleet-a uses %s geocoder after update", g.Provider())
+	}
+	if got := svc.submitter("fleet-a").Name; got != "B" {
+		t.Fatalf("submitter = %q", got)
+	}
+}
+
+func TestPrepareViolationType(t *testing.T) {
+	svc, dev := newTestService(t, false)
+
+	report, err := svc.Prepare(context.Background(), PrepareRequest{
+		DeviceID: "dev1", Latitude: 22.5, Longitude: 113.9, DurationSec: 20, ViolationType: "闯红灯",
+	})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if report.ViolationType != "running_red_light" || report.ViolationCode != "1625" {
+		t.Fatalf("violation not normalised: %q %q", report.ViolationType, report.ViolationCode)
+	}
+
+	_, err = svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 20, ViolationType: "speeding-ish"})
+	if !errors.Is(err, violation.ErrUnknownType) {
+		t.Fatalf("expected ErrUnknownType, got %v", err)
+	}
+
+	// 缺少坐标时在联系设备之前即被拒绝
+	calls := dev.Calls(ddpaitest.CmdSession)
+	_, err = svc.Prepare(context.Background(), PrepareRequest{DeviceID: "dev1", DurationSec: 20, ViolationType: "running_red_light"})
+	if !errors.Is(err, violation.ErrMissingEvidence) {
+		t.Fatalf("expected ErrMissingEvidence, got %v", err)
+	}
+	if dev.Calls(ddpaitest.CmdSession) != calls {
+		t.Fatalf("device contacted for a report missing evidence")
+	}
+
+	// 设备上没有视频
+	dev.SetFiles()
+	_, err = svc.Prepare(context.Background(), PrepareRequest{
+		DeviceID: "dev1", Latitude: 22.5, Longitude: 113.9, DurationSec: 20, ViolationType: "running_red_light",
+	})
+	if !errors.Is(err, violation.ErrMissingEvidence) {
+		t.Fatalf("expected ErrMissingEvidence without video, got %v", err)
+	}
+}
+
+func TestUpdateChecksEvidenceAndOccurredAt(t *testing.T) {
+	svc, _ := newTestService(t, false)
+	ctx := context.Background()
+
+	noLocation, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	typ := "running_red_light"
+	if _, err := svc.Update(ctx, noLocation.ID, ReportPatch{ViolationType: &typ}); !errors.Is(err, violation.ErrMissingEvidence) {
+		t.Fatalf("expected ErrMissingEvidence, got %v", err)
+	}
+	if got, _ := svc.Store.Get(noLocation.ID); got.ViolationType != "" {
+		t.Fatalf("rejected update saved violation type %q", got.ViolationType)
+	}
+
+	located, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", Latitude: 22.5, Longitude: 113.9, DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	updated, err := svc.Update(ctx, located.ID, ReportPatch{ViolationType: &typ})
+	if err != nil || updated.ViolationCode != "1625" {
+		t.Fatalf("update = %+v, %v", updated, err)
+	}
+
+	bad := "yesterday"
+	if _, err := svc.Update(ctx, located.ID, ReportPatch{OccurredAt: &bad}); !errors.Is(err, ErrInvalidOccurredAt) {
+		t.Fatalf("expected ErrInvalidOccurredAt, got %v", err)
+	}
+	at := "2024-05-01T10:00:00+08:00"
+	updated, err = svc.Update(ctx, located.ID, ReportPatch{OccurredAt: &at})
+	if err != nil || updated.OccurredAt != "2024-05-01T02:00:00Z" {
+		t.Fatalf("occurred_at = %q, %v", updated.OccurredAt, err)
+	}
+}
+
+func TestVehiclePlateUpdateAndSearch(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	ctx := context.Background()
+
+	_, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20, Vehicle: &model.Vehicle{Plate: "粤BI2345"}})
+	if !errors.Is(err, vehicle.ErrInvalidPlate) {
+		t.Fatalf("expected ErrInvalidPlate, got %v", err)
+	}
+
+	r, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20, Vehicle: &model.Vehicle{Plate: "粤b·d12345", Type: "SUV"}})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if r.Vehicle.Plate != "粤BD12345" || r.Vehicle.PlateColor != "green" || r.Vehicle.Type != "suv" {
+		t.Fatalf("vehicle not normalised: %+v", r.Vehicle)
+	}
+	other, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+
+	desc := "连续加塞"
+	updated, err := svc.Update(ctx, other.ID, ReportPatch{Description: &desc, Vehicle: &model.Vehicle{Plate: "粤B12345", PlateColor: "blue"}})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.Description != desc || updated.Vehicle.Plate != "粤B12345" {
+		t.Fatalf("update not applied: %+v", updated)
+	}
+
+	if got := svc.List(ctx, store.Filter{Plate: "D123"}); len(got) != 1 || got[0].ID != r.ID {
+		t.Fatalf("plate search returned %+v", got)
+	}
+	if got := svc.List(ctx, store.Filter{Plate: "粤B"}); len(got) != 2 {
+		t.Fatalf("plate prefix search returned %d reports", len(got))
+	}
+
+	if _, err := svc.Send(ctx, other.ID); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if _, err := svc.Update(ctx, other.ID, ReportPatch{Description: &desc}); !errors.Is(err, ErrReportSubmitted) {
+		t.Fatalf("expected ErrReportSubmitted, got %v", err)
+	}
+}
+
+func TestPrepareDetectsDuplicates(t *testing.T) {
+	svc, _ := newTestService(t, false)
+	svc.Dedup = DedupConfig{Window: time.Minute, Distance: 50}
+	ctx := context.Background()
+	plate := func(p string) *model.Vehicle { return &model.Vehicle{Plate: p} }
+
+	first, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", Latitude: 22.5, Longitude: 113.9, DurationSec: 20, Vehicle: plate("粤B12345")})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+
+	// 同一设备的同一段视频（双击）返回已有报告
+	_, err = svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", Latitude: 22.5, Longitude: 113.9, DurationSec: 20})
+	var dup *DuplicateError
+	if !errors.As(err, &dup) || dup.Existing.ID != first.ID {
+		t.Fatalf("expected duplicate of %s, got %v", first.ID, err)
+	}
+	if n := len(svc.Store.List()); n != 1 {
+		t.Fatalf("duplicate saved, store has %d reports", n)
+	}
+
+	// 车队中另一辆车在 ~11 米外报告同一车辆：保存但标记疑似重复
+	convoy, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev2", Latitude: 22.5001, Longitude: 113.9, DurationSec: 20, Vehicle: plate("粤B12345")})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if convoy.DuplicateOf != first.ID {
+		t.Fatalf("DuplicateOf = %q, want %q", convoy.DuplicateOf, first.ID)
+	}
+
+	// 号牌不同或距离太远都不算重复
+	other, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev3", Latitude: 22.5, Longitude: 113.9, DurationSec: 20, Vehicle: plate("粤B54321")})
+	if err != nil || other.DuplicateOf != "" {
+		t.Fatalf("different plate flagged as duplicate: %+v %v", other, err)
+	}
+	far, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev4", Latitude: 22.6, Longitude: 113.9, DurationSec: 20})
+	if err != nil || far.DuplicateOf != "" {
+		t.Fatalf("distant report flagged as duplicate: %+v %v", far, err)
+	}
+}
+
+func TestAttachMedia(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Media = MediaConfig{Dir: t.TempDir(), MaxImageBytes: 1 << 10}
+	blobs := blob.NewFS(t.TempDir(), "", nil)
+	svc.Blobs = blobs
+	ctx := context.Background()
+	report, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+
+	photo := exiftest.JPEG(exiftest.Photo{Taken: "2024:05:01 08:30:00", Lat: 22.5431, Lng: 113.9345})
+	a, err := svc.Attach(ctx, report.ID, Upload{Filename: "../IMG_0001.JPG", Body: bytes.NewReader(photo)})
+	if err != nil {
+		t.Fatalf("attach photo: %v", err)
+	}
+	sum := sha256.Sum256(photo)
+	if a.Kind != "image" || a.ContentType != "image/jpeg" || a.Filename != "IMG_0001.JPG" ||
+		a.Size != int64(len(photo)) || a.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected attachment: %+v", a)
+	}
+	if a.TakenAt != "2024-05-01T00:30:00Z" || a.Latitude == nil || *a.Latitude < 22.543 || *a.Latitude > 22.5432 {
+		t.Fatalf("exif not recorded: %+v", a)
+	}
+	if saved, err := os.ReadFile(filepath.Join(blobs.Dir, filepath.FromSlash(a.Key))); err != nil || !bytes.Equal(saved, photo) {
+		t.Fatalf("saved file differs: %v", err)
+	}
+
+	// 客户端声明的扩展名不影响类型检测
+	clip, err := svc.Attach(ctx, report.ID, Upload{Filename: "clip.jpg", Body: bytes.NewReader(ddpaitest.SampleClip())})
+	if err != nil || clip.Kind != "video" || clip.ContentType != "video/mp4" {
+		t.Fatalf("attach video: %+v %v", clip, err)
+	}
+
+	if _, err := svc.Attach(ctx, report.ID, Upload{Filename: "a.exe", Body: strings.NewReader("MZ\x90\x00 not media")}); !errors.Is(err, ErrUnsupportedMedia) {
+		t.Fatalf("expected ErrUnsupportedMedia, got %v", err)
+	}
+	big := append(exiftest.JPEG(exiftest.Photo{}), make([]byte, 2<<10)...)
+	if _, err := svc.Attach(ctx, report.ID, Upload{Filename: "big.jpg", Body: bytes.NewReader(big)}); !errors.Is(err, ErrMediaTooLarge) {
+		t.Fatalf("expected ErrMediaTooLarge, got %v", err)
+	}
+
+	list, err := svc.Attachments(ctx, report.ID)
+	if err != nil || len(list) != 2 || list[0].ID != a.ID || list[1].ID != clip.ID || list[0].URL == "" {
+		t.Fatalf("attachments = %+v, %v", list, err)
+	}
+	stored, _ := blobs.List(ctx, "")
+	tmp, _ := os.ReadDir(filepath.Join(svc.Media.Dir, "uploads"))
+	if len(stored) != 2 || len(tmp) != 0 {
+		t.Fatalf("rejected uploads left files behind: %d stored, %d temporary", len(stored), len(tmp))
+	}
+}
+
+func TestPrepareAsyncStoresClipInBlobStore(t *testing.T) {
+	svc, _ := newTestService(t, false)
+	svc.Media.Dir = t.TempDir()
+	srv := s3test.NewServer("media")
+	defer srv.Close()
+	s3, err := blob.NewS3(blob.S3Config{
+		Endpoint: srv.URL, Bucket: "media", PathStyle: true,
+		AccessKeyID: s3test.AccessKeyID, SecretAccessKey: s3test.SecretAccessKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Blobs = s3
+	st, err := job.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.EnableJobs(st, 1).Start(ctx)
+
+	j, err := svc.PrepareAsync(ctx, PrepareRequest{DeviceID: "dev1", Latitude: 22.5, Longitude: 113.9, DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare async: %v", err)
+	}
+	var got *job.Job
+	for i := 0; i < 200; i++ {
+		if got, _ = svc.Job(ctx, j.ID); got.Finished() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.Status != job.StatusSucceeded {
+		t.Fatalf("job did not succeed: %+v", got)
+	}
+
+	report, _ := svc.Store.Get(got.ReportID)
+	if report.VideoKey != "reports/"+report.ID+"/clip.mp4" || report.VideoPath != "" {
+		t.Fatalf("clip not moved to blob store: %+v", report)
+	}
+	if entries, _ := os.ReadDir(svc.Media.Dir); len(entries) != 0 {
+		t.Fatalf("local copy not removed: %d files", len(entries))
+	}
+	list, err := svc.Attachments(ctx, report.ID)
+	if err != nil || len(list) != 1 || list[0].Source != "dashcam" {
+		t.Fatalf("attachments = %+v, %v", list, err)
+	}
+	if data := fetch(t, list[0].URL); !bytes.Equal(data, ddpaitest.SampleClip()) {
+		t.Fatalf("presigned download returned %d bytes", len(data))
+	}
+}
+
+func TestReconcileFindsOrphanedAndMissingBlobs(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Media.Dir = t.TempDir()
+	srv := s3test.NewServer("media")
+	defer srv.Close()
+	s3, err := blob.NewS3(blob.S3Config{
+		Endpoint: srv.URL, Bucket: "media", PathStyle: true,
+		AccessKeyID: s3test.AccessKeyID, SecretAccessKey: s3test.SecretAccessKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Blobs = s3
+	ctx := context.Background()
+	if _, ok := svc.LastReconcile(); ok {
+		t.Fatal("unexpected reconcile result before first run")
+	}
+
+	report, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	kept, err := svc.Attach(ctx, report.ID, Upload{Filename: "a.jpg", Body: bytes.NewReader(exiftest.JPEG(exiftest.Photo{}))})
+	if err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	lost, err := svc.Attach(ctx, report.ID, Upload{Filename: "b.jpg", Body: bytes.NewReader(exiftest.JPEG(exiftest.Photo{}))})
+	if err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if err := s3.Delete(ctx, lost.Key); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"reports/rep_gone/clip.mp4", "reports/rep_new/clip.mp4"} {
+		if err := s3.Put(ctx, key, strings.NewReader("x"), 1, "video/mp4"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 只有旧对象算孤立，刚写入的可能属于正在进行的任务
+	srv.SetModTime("reports/rep_gone/clip.mp4", time.Now().Add(-2*time.Hour))
+
+	res, err := svc.ReconcileNow(ctx, ReconcileOptions{Grace: time.Hour})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if res.Objects != 3 || res.Referenced != 2 || len(res.Orphaned) != 1 || res.Orphaned[0].Key != "reports/rep_gone/clip.mp4" ||
+		len(res.Missing) != 1 || res.Missing[0] != (MissingBlob{ReportID: report.ID, Key: lost.Key}) || len(res.Deleted) != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if _, err := svc.ReconcileNow(ctx, ReconcileOptions{Grace: time.Hour, DeleteOrphans: true}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if keys := srv.Keys(); len(keys) != 2 || !slices.Contains(keys, kept.Key) || !slices.Contains(keys, "reports/rep_new/clip.mp4") {
+		t.Fatalf("orphan not deleted: %v", keys)
+	}
+	if last, ok := svc.LastReconcile(); !ok || len(last.Deleted) != 1 {
+		t.Fatalf("last result = %+v", last)
+	}
+}
+
+func TestRetentionSweep(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Media.Dir = t.TempDir()
+	blobs := blob.NewFS(t.TempDir(), "", nil)
+	svc.Blobs = blobs
+	svc.Audit = audit.NewMemory()
+	svc.Retention = []RetentionRule{
+		{Name: "drafts", Status: "prepared", MaxAge: 7 * 24 * time.Hour, Action: RetentionDelete},
+		{Name: "video", Status: "submitted", MaxAge: 180 * 24 * time.Hour, Action: RetentionPurgeMedia},
+	}
+	if err := ValidateRetentionRules(svc.Retention); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	age := func(id string, d time.Duration) {
+		r, _ := svc.Store.Get(id)
+		r.Timestamp = time.Now().Add(-d).UTC().Format(time.RFC3339)
+		if r.SubmittedAt != "" {
+			r.SubmittedAt = r.Timestamp
+		}
+		svc.Store.Save(r)
+	}
+	prepare := func(device string, photo bool) string {
+		r, err := svc.Prepare(ctx, PrepareRequest{DeviceID: device, DurationSec: 20})
+		if err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		if photo {
+			if _, err := svc.Attach(ctx, r.ID, Upload{Filename: "a.jpg", Body: bytes.NewReader(exiftest.JPEG(exiftest.Photo{}))}); err != nil {
+				t.Fatalf("attach: %v", err)
+			}
+		}
+		return r.ID
+	}
+	oldDraft := prepare("dev1", true)
+	newDraft := prepare("dev2", false)
+	oldSent := prepare("dev3", true)
+	held := prepare("dev4", true)
+	for _, id := range []string{oldSent, held} {
+		if _, err := svc.Send(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	age(oldDraft, 8*24*time.Hour)
+	age(newDraft, 6*24*time.Hour)
+	age(oldSent, 200*24*time.Hour)
+	age(held, 200*24*time.Hour)
+	if _, err := svc.SetLegalHold(ctx, held, true, "court order"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按报告时间先后处理
+	dry := svc.Sweep(ctx, true)
+	if len(dry.Actions) != 2 || dry.Actions[0].ReportID != oldSent || dry.Actions[0].Action != RetentionPurgeMedia ||
+		dry.Actions[1].ReportID != oldDraft || dry.Actions[1].Action != RetentionDelete ||
+		len(dry.Held) != 1 || dry.Held[0] != held {
+		t.Fatalf("dry run = %+v", dry)
+	}
+	if _, ok := svc.Store.Get(oldDraft); !ok || len(svc.AuditLog(ctx, audit.Filter{})) != 1 {
+		t.Fatal("dry run changed state")
+	}
+
+	res := svc.Sweep(ctx, false)
+	if len(res.Actions) != 2 || len(res.Errors) != 0 || res.Actions[0].AuditID == "" {
+		t.Fatalf("sweep = %+v", res)
+	}
+	if _, ok := svc.Store.Get(oldDraft); ok {
+		t.Fatal("old draft not deleted")
+	}
+	if _, ok := svc.Store.Get(newDraft); !ok {
+		t.Fatal("recent draft deleted")
+	}
+	purged, _ := svc.Store.Get(oldSent)
+	if purged.MediaPurgedAt == "" || len(purged.Attachments) != 1 || purged.Attachments[0].Key != "" || purged.Attachments[0].SHA256 == "" {
+		t.Fatalf("media not purged or metadata lost: %+v", purged)
+	}
+	if stored, _ := blobs.List(ctx, ""); len(stored) != 1 || !strings.Contains(stored[0].Key, held) {
+		t.Fatalf("remaining objects = %+v", stored)
+	}
+	entries := svc.AuditLog(ctx, audit.Filter{})
+	if len(entries) != 3 || entries[1].Action != audit.ActionMediaPurged || entries[1].Rule != "video" || len(entries[1].Keys) != 1 ||
+		entries[2].Action != audit.ActionReportDeleted || entries[2].ReportID != oldDraft {
+		t.Fatalf("audit log = %+v", entries)
+	}
+
+	if again := svc.Sweep(ctx, false); len(again.Actions) != 0 || len(again.Held) != 1 {
+		t.Fatalf("second sweep = %+v", again)
+	}
+	if _, err := svc.SetLegalHold(ctx, held, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if res := svc.Sweep(ctx, false); len(res.Actions) != 1 || res.Actions[0].ReportID != held {
+		t.Fatalf("sweep after releasing hold = %+v", res)
+	}
+}
+
+// slowStore 延迟读取，放大先读后写之间的窗口
+type slowStore struct{ store.Store }
+
+func (s slowStore) Get(id string) (model.Report, bool) {
+	r, ok := s.Store.Get(id)
+	time.Sleep(time.Millisecond)
+	return r, ok
+}
+
+func TestAttachRechecksReportAfterUpload(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		change func(svc *ReportService, id string)
+		want   error
+	}{
+		{"submitted", func(svc *ReportService, id string) {
+			if _, err := svc.Send(context.Background(), id); err != nil {
+				t.Fatal(err)
+			}
+		}, ErrReportSubmitted},
+		{"purged", func(svc *ReportService, id string) {
+			r, _ := svc.Store.Get(id)
+			r.MediaPurgedAt = time.Now().UTC().Format(time.RFC3339)
+			svc.Store.Save(r)
+		}, ErrMediaPurged},
+	} {
+		svc, _ := newTestService(t, true)
+		svc.Media.Dir = t.TempDir()
+		blobs := blob.NewFS(t.TempDir(), "", nil)
+		svc.Blobs = blobs
+		ctx := context.Background()
+		r, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pr, pw := io.Pipe()
+		done := make(chan error)
+		go func() {
+			_, err := svc.Attach(ctx, r.ID, Upload{Filename: "a.jpg", Body: pr})
+			done <- err
+		}()
+		// Write 返回时 Attach 已通过检查并在读取上传内容
+		if _, err := pw.Write(exiftest.JPEG(exiftest.Photo{})); err != nil {
+			t.Fatal(err)
+		}
+		c.change(svc, r.ID)
+		pw.Close()
+
+		if err := <-done; !errors.Is(err, c.want) {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+		if got, _ := svc.Store.Get(r.ID); len(got.Attachments) != 0 {
+			t.Fatalf("%s: attachment added: %+v", c.name, got.Attachments)
+		}
+		if objs, _ := blobs.List(ctx, ""); len(objs) != 0 {
+			t.Fatalf("%s: uploaded object kept: %+v", c.name, objs)
+		}
+	}
+}
+
+// failingStore 在 fail 为 true 时拒绝保存
+type failingStore struct {
+	store.Store
+	fail *atomic.Bool
+}
+
+func (s failingStore) Save(r model.Report) error {
+	if s.fail.Load() {
+		return fmt.Errorf("%w: %s: disk full", store.ErrSave, r.ID)
+	}
+	return s.Store.Save(r)
+}
+
+func TestSaveErrorsAreReturned(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	fail := new(atomic.Bool)
+	svc.Store = failingStore{svc.Store, fail}
+	ctx := context.Background()
+	r, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fail.Store(true)
+	if _, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev2", DurationSec: 20}); !errors.Is(err, store.ErrSave) {
+		t.Fatalf("prepare: expected ErrSave, got %v", err)
+	}
+	desc := "lost"
+	if _, err := svc.Update(ctx, r.ID, ReportPatch{Description: &desc}); !errors.Is(err, store.ErrSave) {
+		t.Fatalf("update: expected ErrSave, got %v", err)
+	}
+	if _, err := svc.Send(ctx, r.ID); !errors.Is(err, store.ErrSave) {
+		t.Fatalf("send: expected ErrSave, got %v", err)
+	}
+	if got, _ := svc.Store.Get(r.ID); got.Description != "" || got.Status != "prepared" {
+		t.Fatalf("report changed after failed saves: %+v", got)
+	}
+	if n := len(svc.Store.List()); n != 1 {
+		t.Fatalf("%d reports stored", n)
+	}
+}
+
+func TestUpdateDoesNotDropConcurrentAttachments(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Store = slowStore{svc.Store}
+	svc.Media.Dir = t.TempDir()
+	svc.Blobs = blob.NewFS(t.TempDir(), "", nil)
+	ctx := context.Background()
+	r, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := exiftest.JPEG(exiftest.Photo{})
+	desc := "updated"
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.Attach(ctx, r.ID, Upload{Filename: "a.jpg", Body: bytes.NewReader(photo)}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := svc.Update(ctx, r.ID, ReportPatch{Description: &desc}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := svc.Store.Get(r.ID); len(got.Attachments) != 10 {
+		t.Fatalf("attachments = %d, want 10", len(got.Attachments))
+	}
+}
+
+func TestRetentionKeepsMediaWhenAuditFails(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Media.Dir = t.TempDir()
+	blobs := blob.NewFS(t.TempDir(), "", nil)
+	svc.Blobs = blobs
+	svc.Retention = []RetentionRule{{Name: "drafts", Status: "prepared", MaxAge: time.Hour, Action: RetentionDelete}}
+	ctx := context.Background()
+	r, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Attach(ctx, r.ID, Upload{Filename: "a.jpg", Body: bytes.NewReader(exiftest.JPEG(exiftest.Photo{}))}); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := svc.Store.Get(r.ID)
+	stored.Timestamp = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	svc.Store.Save(stored)
+
+	// 已关闭的审计日志写入失败
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+	svc.Audit = log
+
+	if res := svc.Sweep(ctx, false); len(res.Errors) != 1 || len(res.Actions) != 0 {
+		t.Fatalf("sweep = %+v", res)
+	}
+	if _, ok := svc.Store.Get(r.ID); !ok {
+		t.Fatal("report deleted without audit record")
+	}
+	if objs, _ := blobs.List(ctx, ""); len(objs) != 1 {
+		t.Fatalf("media deleted without audit record: %+v", objs)
+	}
+}
+
+// blockingBlobs 的 Delete 在 release 关闭前一直阻塞，模拟慢速的对象存储
+type blockingBlobs struct {
+	blob.Store
+	deleting chan struct{}
+	release  chan struct{}
+}
+
+func (b blockingBlobs) Delete(ctx context.Context, key string) error {
+	b.deleting <- struct{}{}
+	<-b.release
+	return b.Store.Delete(ctx, key)
+}
+
+func TestRetentionDeleteDoesNotBlockWrites(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Media.Dir = t.TempDir()
+	blobs := blockingBlobs{blob.NewFS(t.TempDir(), "", nil), make(chan struct{}, 1), make(chan struct{})}
+	svc.Blobs = blobs
+	svc.Retention = []RetentionRule{{Name: "drafts", Status: "prepared", MaxAge: time.Hour, Action: RetentionPurgeMedia}}
+	ctx := context.Background()
+	old, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Attach(ctx, old.ID, Upload{Filename: "a.jpg", Body: bytes.NewReader(exiftest.JPEG(exiftest.Photo{}))}); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := svc.Store.Get(old.ID)
+	stored.Timestamp = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	svc.Store.Save(stored)
+	other, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev2", DurationSec: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swept := make(chan SweepResult)
+	go func() { swept <- svc.Sweep(ctx, false) }()
+	<-blobs.deleting
+
+	updated := make(chan error)
+	desc := "during sweep"
+	go func() {
+		_, err := svc.Update(ctx, other.ID, ReportPatch{Description: &desc})
+		updated <- err
+	}()
+	select {
+	case err := <-updated:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Update blocked while retention deletes media")
+	}
+	// 媒体删除期间报告已标记为清除，不能再追加附件
+	if got, _ := svc.Store.Get(old.ID); got.MediaPurgedAt == "" {
+		t.Fatalf("report not marked purged before deleting media: %+v", got)
+	}
+
+	close(blobs.release)
+	if res := <-swept; len(res.Actions) != 1 || len(res.Errors) != 0 {
+		t.Fatalf("sweep = %+v", res)
+	}
+}
+
+// failingBlobs 删除对象总是失败
+type failingBlobs struct{ blob.Store }
+
+func (failingBlobs) Delete(context.Context, string) error { return errors.New("unavailable") }
+
+func TestRetentionRestoresMediaWhenDeleteFails(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Media.Dir = t.TempDir()
+	svc.Blobs = failingBlobs{blob.NewFS(t.TempDir(), "", nil)}
+	svc.Retention = []RetentionRule{{Name: "drafts", Status: "prepared", MaxAge: time.Hour, Action: RetentionDelete}}
+	ctx := context.Background()
+	r, err := svc.Prepare(ctx, PrepareRequest{DeviceID: "dev1", DurationSec: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Attach(ctx, r.ID, Upload{Filename: "a.jpg", Body: bytes.NewReader(exiftest.JPEG(exiftest.Photo{}))}); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := svc.Store.Get(r.ID)
+	stored.Timestamp = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	svc.Store.Save(stored)
+
+	if res := svc.Sweep(ctx, false); len(res.Errors) != 1 || len(res.Actions) != 0 {
+		t.Fatalf("sweep = %+v", res)
+	}
+	got, ok := svc.Store.Get(r.ID)
+	if !ok || got.MediaPurgedAt != "" || len(mediaKeys(got)) != 1 {
+		t.Fatalf("report after failed delete = %+v", got)
+	}
+}
+
+func TestValidateRetentionRules(t *testing.T) {
+	for _, rules := range [][]RetentionRule{
+		{{Name: "", Status: "prepared", MaxAge: time.Hour, Action: RetentionDelete}},
+		{{Name: "a", Status: "sent", MaxAge: time.Hour, Action: RetentionDelete}},
+		{{Name: "a", Status: "prepared", MaxAge: 0, Action: RetentionDelete}},
+		{{Name: "a", Status: "prepared", MaxAge: time.Hour, Action: "archive"}},
+		{{Name: "a", Status: "prepared", MaxAge: time.Hour, Action: RetentionDelete}, {Name: "a", Status: "submitted", MaxAge: time.Hour, Action: RetentionDelete}},
+	} {
+		if err := ValidateRetentionRules(rules); !errors.Is(err, ErrInvalidRetentionRule) {
+			t.Errorf("%+v: expected ErrInvalidRetentionRule, got %v", rules, err)
+		}
+	}
+}
+
+func TestImportReportsPerRow(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Dedup = DedupConfig{Window: time.Minute, Distance: 50}
+	ctx := context.Background()
+	input := "device_id,timestamp,lat,lng,city,road_name,status,violation_type,plate,tags\n" +
+		"dev1,2023-03-01 09:00:00,22.54,113.93,,,submitted,闯红灯,粤b12345,imported\n" + // 补全位置
+		"dev1,2023-03-01 09:00:30,22.54,113.93,,,,,,\n" + // 与上一行确定重复
+		",2023-03-01 10:00:00,22.5,113.9,,,,,,\n" + // 缺少设备
+		"dev2,2023-03-02 10:00:00,95,113.9,,,,,,\n" + // 纬度越界
+		"dev2,2023-03-02 11:00:00,22.6,114.0,福田区,滨河大道,sent,,,\n" + // 状态无效
+		"dev2,2023-03-02 12:00:00,22.6,114.0,福田区,滨河大道,,unknown_type,,\n" +
+		"dev2,2023-03-02 13:00:00,22.6,114.0,福田区,滨河大道,,,粤Z,\n" + // 号牌无效
+		"dev3,2023-03-03 08:00:00,22.7,114.1,罗湖区,人民南路,,,,\n"
+
+	dry, err := svc.Import(ctx, "csv", strings.NewReader(input), ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dry.Total != 8 || dry.Created != 3 || dry.Failed != 5 || len(svc.Store.List()) != 0 {
+		t.Fatalf("dry run = %+v", dry)
+	}
+
+	res, err := svc.Import(ctx, "csv", strings.NewReader(input), ImportOptions{Geocode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make([]string, len(res.Rows))
+	for i, row := range res.Rows {
+		statuses[i] = row.Status
+	}
+	want := []string{ImportCreated, ImportSkipped, ImportFailed, ImportFailed, ImportFailed, ImportFailed, ImportFailed, ImportCreated}
+	if strings.Join(statuses, ",") != strings.Join(want, ",") || res.Created != 2 || res.Skipped != 1 || res.Failed != 5 {
+		t.Fatalf("unexpected rows: %+v", res.Rows)
+	}
+	if res.Rows[1].DuplicateOf != res.Rows[0].ID || res.Rows[2].Line != 4 || !strings.Contains(res.Rows[2].Error, "device_id") {
+		t.Fatalf("unexpected row details: %+v", res.Rows)
+	}
+
+	first, _ := svc.Store.Get(res.Rows[0].ID)
+	if first.City != "深圳市" || !first.IsHighway || first.Provider != "stub" || first.Status != "submitted" ||
+		first.SubmittedAt != "2023-03-01T01:00:00Z" || first.ViolationType != "running_red_light" || first.Vehicle.Plate != "粤B12345" {
+		t.Fatalf("first report not normalised: %+v", first)
+	}
+	last, _ := svc.Store.Get(res.Rows[7].ID)
+	if last.City != "罗湖区" || last.Provider != "import" || last.Status != "submitted" || last.SubmittedAt != last.Timestamp {
+		t.Fatalf("existing location overwritten: %+v", last)
+	}
+
+	// 使用导出的 ID 重新导入时跳过已有报告
+	again, err := svc.Import(ctx, "jsonl", strings.NewReader(`{"id":"`+first.ID+`","device_id":"dev1","timestamp":"2023-03-01T01:00:00Z"}`), ImportOptions{})
+	if err != nil || again.Skipped != 1 {
+		t.Fatalf("re-import = %+v, %v", again, err)
+	}
+}
+
+func TestConcurrentImportsNeverOverwrite(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Store = slowStore{svc.Store}
+	ctx := context.Background()
+	id := ids.New(ReportIDPrefix)
+	existing := model.Report{ID: id, OrgID: tenant.DefaultOrg, DeviceID: "dev1", Status: "submitted",
+		Timestamp: "2023-03-01T01:00:00Z", LegalHold: true, LegalHoldReason: "court order"}
+	if err := svc.saveNew(&existing); err != nil {
+		t.Fatal(err)
+	}
+	again := existing
+	again.LegalHold = false
+	if err := svc.saveNew(&again); !errors.Is(err, ErrReportExists) {
+		t.Fatalf("expected ErrReportExists, got %v", err)
+	}
+
+	// 同一 ID 的多次导入只有一次成功
+	fresh := ids.New(ReportIDPrefix)
+	line := `{"id":"` + fresh + `","device_id":"dev1","timestamp":"2023-03-02T01:00:00Z"}`
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := svc.Import(ctx, "jsonl", strings.NewReader(line), ImportOptions{})
+			if err != nil {
+				t.Error(err)
+			}
+			created.Add(int32(res.Created))
+		}()
+	}
+	wg.Wait()
+	if n := created.Load(); n != 1 {
+		t.Fatalf("%d imports created the same report", n)
+	}
+	if got, _ := svc.Store.Get(id); !got.LegalHold {
+		t.Fatalf("existing report overwritten: %+v", got)
+	}
+}
+
+func TestImportedHistoryKeptByRetention(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Audit = audit.NewMemory()
+	svc.Retention = []RetentionRule{
+		{Name: "drafts", Status: "prepared", MaxAge: 7 * 24 * time.Hour, Action: RetentionDelete},
+		{Name: "reports", Status: "submitted", MaxAge: 5 * 365 * 24 * time.Hour, Action: RetentionDelete},
+	}
+	ctx := context.Background()
+	old := time.Now().AddDate(-1, 0, 0).UTC().Format(time.RFC3339)
+	input := `{"device_id":"dev1","timestamp":"` + old + `"}
+{"device_id":"dev2","timestamp":"` + old + `","status":"prepared"}
+`
+	res, err := svc.Import(ctx, "jsonl", strings.NewReader(input), ImportOptions{})
+	if err != nil || res.Created != 2 {
+		t.Fatalf("import = %+v, %v", res, err)
+	}
+
+	// 没有状态的历史报告按已提交处理，不会被草稿规则删除
+	sweep := svc.Sweep(ctx, false)
+	if len(sweep.Actions) != 1 || sweep.Actions[0].ReportID != res.Rows[1].ID || sweep.Actions[0].Rule != "drafts" {
+		t.Fatalf("sweep = %+v", sweep)
+	}
+	if _, ok := svc.Store.Get(res.Rows[0].ID); !ok {
+		t.Fatal("imported report deleted by retention")
+	}
+}
+
+func TestImportScopedToCallerOrg(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	ctx := auth.WithUser(context.Background(), &auth.User{ID: "bob", OrgID: "fleet-a", Role: auth.RoleUser, Devices: []string{"dev1"}})
+	input := `{"device_id":"dev1","timestamp":"2023-03-01T01:00:00Z"}
+{"device_id":"dev2","timestamp":"2023-03-01T01:00:00Z"}
+{"device_id":"dev1","org_id":"fleet-b","timestamp":"2023-03-01T01:00:00Z"}
+`
+	res, err := svc.Import(ctx, "jsonl", strings.NewReader(input), ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 1 || res.Failed != 2 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if r, _ := svc.Store.Get(res.Rows[0].ID); r.OrgID != "fleet-a" {
+		t.Fatalf("report imported into %q", r.OrgID)
+	}
+}
+
+func TestMigrateUpgradesLegacyReports(t *testing.T) {
+	svc, _ := newTestService(t, true)
+	svc.Media.Dir = t.TempDir()
+	blobs := blob.NewFS(t.TempDir(), "", []byte("secret"))
+	svc.Blobs = blobs
+	ctx := context.Background()
+
+	clip := filepath.Join(svc.Media.Dir, "legacy.mp4")
+	if err := os.WriteFile(clip, []byte("clip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	svc.Store.Save(model.Report{
+		ID: "rep_legacy", Timestamp: "2024-01-02T03:04:05Z", Status: "submitted", DeviceID: "dev1",
+		ViolationType: "闯红灯", Vehicle: &model.Vehicle{Plate: "粤b·12345"}, VideoPath: clip,
+	})
+	svc.Store.Save(model.Report{ID: "rep_current", OrgID: tenant.DefaultOrg, Timestamp: "2024-01-02T03:04:05Z", Status: "prepared", DeviceID: "dev1"})
+
+	res := svc.Migrate(ctx, true)
+	if res.Scanned != 2 || len(res.Changed) != 1 || len(res.Changed[0].Changes) != 5 {
+		t.Fatalf("dry run = %+v", res)
+	}
+	if r, _ := svc.Store.Get("rep_legacy"); r.OrgID != "" || r.VideoPath != clip {
+		t.Fatalf("dry run modified report: %+v", r)
+	}
+
+	res = svc.Migrate(ctx, false)
+	if len(res.Errors) != 0 || len(res.Changed) != 1 {
+		t.Fatalf("migrate = %+v", res)
+	}
+	r, _ := svc.Store.Get("rep_legacy")
+	if r.OrgID != tenant.DefaultOrg || r.SubmittedAt != r.Timestamp || r.ViolationType != "running_red_light" ||
+		r.ViolationCode != "1625" || r.Vehicle.Plate != "粤B12345" || r.VideoPath != "" || r.VideoKey == "" {
+		t.Fatalf("report not upgraded: %+v", r)
+	}
+	if _, err := blobs.Stat(ctx, r.VideoKey); err != nil {
+		t.Fatalf("clip not stored: %v", err)
+	}
+	if _, err := os.Stat(clip); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("local clip not removed: %v", err)
+	}
+
+	if res := svc.Migrate(ctx, false); len(res.Changed) != 0 {
+		t.Fatalf("second migrate changed reports: %+v", res.Changed)
+	}
+}
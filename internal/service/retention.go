@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"SnapReport/internal/audit"
+	"SnapReport/internal/auth"
+	"SnapReport/internal/blob"
+	"SnapReport/internal/events"
+	"SnapReport/internal/model"
+	"SnapReport/internal/store"
+)
+
+// 保留规则的动作
+const (
+	RetentionDelete     = "delete"      // 删除报告及其全部媒体
+	RetentionPurgeMedia = "purge_media" // 删除视频和照片，只保留报告元数据
+)
+
+// retentionActor 是保留策略在审计日志中的操作人
+const retentionActor = "system:retention"
+
+// ErrInvalidRetentionRule 表示保留规则配置错误
+var ErrInvalidRetentionRule = errors.New("invalid retention rule")
+
+// RetentionRule 在报告达到 MaxAge 后执行 Action。草稿（prepared）从创建
+// 时间起算，已提交的报告从提交时间起算。
+type RetentionRule struct {
+	Name   string
+	Status string // 适用的报告状态，"prepared" 或 "submitted"
+	MaxAge time.Duration
+	Action string
+}
+
+// ValidateRetentionRules 检查规则是否完整且名称唯一
+func ValidateRetentionRules(rules []RetentionRule) error {
+	seen := map[string]bool{}
+	for i, r := range rules {
+		switch {
+		case r.Name == "":
+			return fmt.Errorf("%w: rule %d: name required", ErrInvalidRetentionRule, i)
+		case seen[r.Name]:
+			return fmt.Errorf("%w: duplicate rule %q", ErrInvalidRetentionRule, r.Name)
+		case r.Status != "prepared" && r.Status != "submitted":
+			return fmt.Errorf("%w: rule %q: status must be prepared or submitted", ErrInvalidRetentionRule, r.Name)
+		case r.MaxAge <= 0:
+			return fmt.Errorf("%w: rule %q: age must be positive", ErrInvalidRetentionRule, r.Name)
+		case r.Action != RetentionDelete && r.Action != RetentionPurgeMedia:
+			return fmt.Errorf("%w: rule %q: action must be delete or purge_media", ErrInvalidRetentionRule, r.Name)
+		}
+		seen[r.Name] = true
+	}
+	return nil
+}
+
+// SweepAction 是一份报告上执行（或试运行时将要执行）的清理
+type SweepAction struct {
+	ReportID string   `json:"report_id"`
+	OrgID    string   `json:"org_id"`
+	Rule     string   `json:"rule"`
+	Action   string   `json:"action"`
+	Keys     []string `json:"keys,omitempty"` // 删除的媒体对象
+	AuditID  string   `json:"audit_id,omitempty"`
+}
+
+// SweepResult 是一次保留策略清理的结果
+type SweepResult struct {
+	StartedAt  string        `json:"started_at"`
+	FinishedAt string        `json:"finished_at"`
+	DryRun     bool          `json:"dry_run"`
+	Actions    []SweepAction `json:"actions"`
+	Held       []string      `json:"held"`             // 因法律保全跳过的报告
+	Errors     []string      `json:"errors,omitempty"` // 失败的报告在下次清理时重试
+}
+
+// Sweep 按 Retention 规则清理过期的报告和媒体。dryRun 时只返回将要执行的
+// 清理，不做任何修改。每次清理先写审计记录并标记报告，再删除媒体，最后
+// 删除报告；删除媒体时不持有 s.mu。审计记录写入失败时不删除任何数据；
+// 删除失败的媒体会放回报告，下次清理时重试并再写一条审计记录（已删除的
+// 对象视为成功）。
+func (s *ReportService) Sweep(ctx context.Context, dryRun bool) SweepResult {
+	res := SweepResult{
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+		DryRun:    dryRun,
+		Actions:   []SweepAction{},
+		Held:      []string{},
+	}
+	now := time.Now()
+	for _, r := range s.Store.Query(store.Filter{}) {
+		rule, ok := s.retentionRule(r, now)
+		if !ok {
+			continue
+		}
+		if r.LegalHold {
+			res.Held = append(res.Held, r.ID)
+			continue
+		}
+		if dryRun {
+			res.Actions = append(res.Actions, SweepAction{
+				ReportID: r.ID, OrgID: r.OrgID, Rule: rule.Name, Action: rule.Action, Keys: mediaKeys(r),
+			})
+			continue
+		}
+		a, held, err := s.applyRetention(ctx, r.ID, now)
+		switch {
+		case err != nil:
+			res.Errors = append(res.Errors, r.ID+": "+err.Error())
+		case held:
+			res.Held = append(res.Held, r.ID)
+		case a != nil:
+			res.Actions = append(res.Actions, *a)
+		}
+	}
+	res.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	return res
+}
+
+// retentionRule 返回报告适用的规则。多条规则同时适用时 delete 优先。
+func (s *ReportService) retentionRule(r model.Report, now time.Time) (RetentionRule, bool) {
+	since := r.Timestamp
+	if r.Status == "submitted" && r.SubmittedAt != "" {
+		since = r.SubmittedAt
+	}
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return RetentionRule{}, false
+	}
+	var found RetentionRule
+	ok := false
+	for _, rule := range s.Retention {
+		if rule.Status != r.Status || now.Sub(t) < rule.MaxAge {
+			continue
+		}
+		if rule.Action == RetentionPurgeMedia && (r.MediaPurgedAt != "" || !hasMedia(r)) {
+			continue
+		}
+		if !ok || rule.Action == RetentionDelete && found.Action != RetentionDelete {
+			found, ok = rule, true
+		}
+	}
+	return found, ok
+}
+
+// applyRetention 清理一份报告，分三步以免删除媒体时阻塞其它写入：
+//  1. 在 s.mu 下重新读取报告，写审计记录，并把报告标记为媒体已清除后保存，
+//     此后追加附件会被拒绝；
+//  2. 释放 s.mu，删除媒体存储中的对象和本地视频文件；
+//  3. 重新获取 s.mu，把删除失败的媒体放回报告以便下次重试；删除规则在
+//     报告仍存在且未被保全时删除报告。
+//
+// 第 2 步期间被设置法律保全的报告媒体已被删除，但报告本身保留。
+func (s *ReportService) applyRetention(ctx context.Context, id string, now time.Time) (a *SweepAction, held bool, err error) {
+	s.mu.Lock()
+	r, ok := s.Store.Get(id)
+	if !ok {
+		s.mu.Unlock()
+		return nil, false, nil
+	}
+	rule, ok := s.retentionRule(r, now)
+	if !ok {
+		s.mu.Unlock()
+		return nil, false, nil
+	}
+	if r.LegalHold {
+		s.mu.Unlock()
+		return nil, true, nil
+	}
+	keys := mediaKeys(r)
+	if len(keys) > 0 && s.Blobs == nil {
+		s.mu.Unlock()
+		return nil, false, ErrStorageDisabled
+	}
+	entry := audit.Entry{
+		Actor:    retentionActor,
+		Action:   audit.ActionMediaPurged,
+		OrgID:    r.OrgID,
+		ReportID: r.ID,
+		Rule:     rule.Name,
+		Keys:     keys,
+	}
+	if rule.Action == RetentionDelete {
+		entry.Action = audit.ActionReportDeleted
+	}
+	// 先写审计记录，写入失败时不删除任何数据
+	if entry, err = s.audit(entry); err != nil {
+		s.mu.Unlock()
+		return nil, false, err
+	}
+	if hasMedia(r) {
+		purged := r
+		purged.Attachments = append([]model.Attachment(nil), r.Attachments...)
+		clearMedia(&purged, now)
+		if err := s.Store.Save(purged); err != nil {
+			s.mu.Unlock()
+			return nil, false, err
+		}
+	}
+	s.mu.Unlock()
+
+	failed := map[string]bool{}
+	for _, key := range keys {
+		if derr := s.Blobs.Delete(ctx, key); derr != nil && !errors.Is(derr, blob.ErrNotFound) {
+			failed[key] = true
+			err = derr
+		}
+	}
+	keepFile := false
+	if r.VideoPath != "" {
+		if rerr := os.Remove(r.VideoPath); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			keepFile = true
+			err = rerr
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.Store.Get(id)
+	if err != nil {
+		if ok {
+			restoreMedia(&cur, r, failed, keepFile)
+			if serr := s.Store.Save(cur); serr != nil {
+				log.Printf("retention: restore media of %s: %v", cur.ID, serr)
+			}
+		}
+		return nil, false, err
+	}
+	action := &SweepAction{
+		ReportID: r.ID, OrgID: r.OrgID, Rule: rule.Name, Action: rule.Action, Keys: keys, AuditID: entry.ID,
+	}
+	if !ok {
+		return action, false, nil
+	}
+	if rule.Action == RetentionDelete {
+		if cur.LegalHold {
+			return nil, true, nil
+		}
+		s.Store.Delete(cur.ID)
+		s.Events.Publish(events.ReportDeleted, cur.OrgID, cur.DeviceID, map[string]string{"id": cur.ID, "rule": rule.Name})
+	} else {
+		s.Events.Publish(events.ReportUpdated, cur.OrgID, cur.DeviceID, cur)
+	}
+	return action, false, nil
+}
+
+// clearMedia 去掉报告中的媒体引用并记录清除时间，附件的元数据保留
+func clearMedia(r *model.Report, now time.Time) {
+	r.VideoURL, r.VideoPath, r.VideoKey = "", "", ""
+	for i := range r.Attachments {
+		r.Attachments[i].Key = ""
+	}
+	r.MediaPurgedAt = now.UTC().Format(time.RFC3339)
+}
+
+// restoreMedia 把删除失败的对象和本地文件放回 cur，使下次清理时重试
+func restoreMedia(cur *model.Report, orig model.Report, failed map[string]bool, keepFile bool) {
+	restored := keepFile
+	if keepFile {
+		cur.VideoPath = orig.VideoPath
+	}
+	if failed[orig.VideoKey] {
+		cur.VideoKey, cur.VideoURL = orig.VideoKey, orig.VideoURL
+		restored = true
+	}
+	for _, a := range orig.Attachments {
+		if !failed[a.Key] {
+			continue
+		}
+		for i := range cur.Attachments {
+			if cur.Attachments[i].ID == a.ID {
+				cur.Attachments[i].Key = a.Key
+				restored = true
+			}
+		}
+	}
+	if restored {
+		cur.MediaPurgedAt = ""
+	}
+}
+
+func (s *ReportService) audit(e audit.Entry) (audit.Entry, error) {
+	if s.Audit == nil {
+		return e, nil
+	}
+	return s.Audit.Record(e)
+}
+
+// mediaKeys 返回报告在媒体存储中的全部对象
+func mediaKeys(r model.Report) []string {
+	var keys []string
+	if r.VideoKey != "" {
+		keys = append(keys, r.VideoKey)
+	}
+	for _, a := range r.Attachments {
+		if a.Key != "" {
+			keys = append(keys, a.Key)
+		}
+	}
+	return keys
+}
+
+func hasMedia(r model.Report) bool {
+	return r.VideoPath != "" || len(mediaKeys(r)) > 0
+}
+
+// SetLegalHold 设置或解除报告的法律保全并写入审计日志。保全中的报告
+// 不会被保留策略删除或清除媒体。调用方无权访问的报告视为不存在。
+func (s *ReportService) SetLegalHold(ctx context.Context, id string, hold bool, reason string) (*model.Report, error) {
+	s.mu.Lock()
+	report, ok := s.Store.Get(id)
+	if !ok || !auth.CanAccess(ctx, report.OrgID, report.DeviceID) {
+		s.mu.Unlock()
+		return nil, ErrReportNotFound
+	}
+	actor := "system"
+	if u, ok := auth.UserFromContext(ctx); ok {
+		actor = u.ID
+	}
+	entry := audit.Entry{Actor: actor, Action: audit.ActionLegalHoldSet, OrgID: report.OrgID, ReportID: id, Reason: reason}
+	if !hold {
+		entry.Action = audit.ActionLegalHoldClear
+		reason = ""
+	}
+	if _, err := s.audit(entry); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	report.LegalHold, report.LegalHoldReason = hold, reason
+	if err := s.Store.Save(report); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.mu.Unlock()
+	s.Events.Publish(events.ReportUpdated, report.OrgID, report.DeviceID, report)
+	return &report, nil
+}
+
+// AuditLog 返回调用方组织的审计记录，f.OrgID 对受组织限制的调用方无效
+func (s *ReportService) AuditLog(ctx context.Context, f audit.Filter) []audit.Entry {
+	if s.Audit == nil {
+		return []audit.Entry{}
+	}
+	if orgID, restricted := auth.OrgFromContext(ctx); restricted {
+		f.OrgID = orgID
+	}
+	return s.Audit.List(f)
+}
+
+// RunRetention 每隔 interval 执行一次保留策略清理，直到 ctx 被取消
+func (s *ReportService) RunRetention(ctx context.Context, interval time.Duration, dryRun bool) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			res := s.Sweep(ctx, dryRun)
+			for _, a := range res.Actions {
+				if dryRun {
+					log.Printf("Retention dry run: would %s report %s (rule %s)", a.Action, a.ReportID, a.Rule)
+				} else {
+					log.Printf("Retention: %s report %s (rule %s)", a.Action, a.ReportID, a.Rule)
+				}
+			}
+			for _, e := range res.Errors {
+				log.Printf("Retention failed: %s", e)
+			}
+		}
+	}
+}
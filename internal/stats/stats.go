@@ -0,0 +1,189 @@
+// Package stats 汇总报告的数量分布和空间热点
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"SnapReport/internal/geo"
+	"SnapReport/internal/model"
+)
+
+// 默认参数
+const (
+	DefaultPrecision = 6  // 热点格子约 1.2km × 0.6km
+	DefaultTop       = 20 // 返回的热点数
+)
+
+// DefaultLocation 是按天、按周分组使用的时区（北京时间）
+var DefaultLocation = time.FixedZone("UTC+8", 8*3600)
+
+type Options struct {
+	Precision int            // geohash 长度，1-12
+	Top       int            // 返回数量最多的前 Top 个热点，0 表示 DefaultTop，负数表示全部
+	Location  *time.Location // 按天、按周分组的时区
+}
+
+// Count 是一个分组及其报告数
+type Count struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// Hotspot 是一个 geohash 格子内的报告
+type Hotspot struct {
+	Geohash string `json:"geohash"`
+	Count   int    `json:"count"`
+	// Lat 和 Lng 是格子内报告坐标的平均值，用于在地图上标注
+	Lat    float64    `json:"lat"`
+	Lng    float64    `json:"lng"`
+	Bounds [4]float64 `json:"bounds"` // [minLat, minLng, maxLat, maxLng]
+	// ViolationTypes 是格子内的违法类型分布
+	ViolationTypes []Count `json:"violation_types"`
+}
+
+type Stats struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+	// SubmittedRatio 是已提交报告占全部报告的比例
+	SubmittedRatio float64 `json:"submitted_ratio"`
+	ByCity         []Count `json:"by_city"`
+	ByRoad         []Count `json:"by_road"`
+	ByViolation    []Count `json:"by_violation_type"` // 未分类的报告计入 ""
+	ByTag          []Count `json:"by_tag"`
+	Highway        int     `json:"highway"`
+	Urban          int     `json:"urban"`
+	ByDevice       []Count `json:"by_device"`
+	ByDay          []Count `json:"by_day"`  // "2006-01-02"，按时间先后
+	ByWeek         []Count `json:"by_week"` // ISO 周，如 "2024-W18"
+	// Hotspots 按报告数从多到少排列，没有坐标的报告不参与
+	Hotspots  []Hotspot `json:"hotspots"`
+	Precision int       `json:"precision"`
+}
+
+// Compute 汇总 reports。报告的日期取事件发生时间，没有时取创建时间。
+func Compute(reports []model.Report, opts Options) Stats {
+	if opts.Precision < 1 || opts.Precision > geo.MaxGeohashPrecision {
+		opts.Precision = DefaultPrecision
+	}
+	if opts.Top == 0 {
+		opts.Top = DefaultTop
+	}
+	if opts.Location == nil {
+		opts.Location = DefaultLocation
+	}
+
+	s := Stats{Total: len(reports), ByStatus: map[string]int{}, Precision: opts.Precision}
+	city, road, vio, tag, device := counter{}, counter{}, counter{}, counter{}, counter{}
+	day, week := counter{}, counter{}
+	type cell struct {
+		n        int
+		lat, lng float64
+		vio      counter
+	}
+	cells := map[string]*cell{}
+
+	for _, r := range reports {
+		s.ByStatus[r.Status]++
+		city.add(r.City)
+		road.add(r.RoadName)
+		vio.add(r.ViolationType)
+		for _, t := range r.Tags {
+			tag.add(t)
+		}
+		device.add(r.DeviceID)
+		if r.IsHighway {
+			s.Highway++
+		} else {
+			s.Urban++
+		}
+		if t, ok := reportTime(r); ok {
+			t = t.In(opts.Location)
+			day.add(t.Format("2006-01-02"))
+			y, w := t.ISOWeek()
+			week.add(fmt.Sprintf("%d-W%02d", y, w))
+		}
+		if r.Latitude == 0 && r.Longitude == 0 {
+			continue
+		}
+		h := geo.Geohash(r.Latitude, r.Longitude, opts.Precision)
+		c := cells[h]
+		if c == nil {
+			c = &cell{vio: counter{}}
+			cells[h] = c
+		}
+		c.n++
+		c.lat += r.Latitude
+		c.lng += r.Longitude
+		c.vio.add(r.ViolationType)
+	}
+	if s.Total > 0 {
+		s.SubmittedRatio = float64(s.ByStatus["submitted"]) / float64(s.Total)
+	}
+	s.ByCity, s.ByRoad, s.ByViolation, s.ByTag, s.ByDevice = city.top(), road.top(), vio.top(), tag.top(), device.top()
+	s.ByDay, s.ByWeek = day.sorted(), week.sorted()
+
+	s.Hotspots = make([]Hotspot, 0, len(cells))
+	for h, c := range cells {
+		minLat, minLng, maxLat, maxLng, _ := geo.GeohashBounds(h)
+		s.Hotspots = append(s.Hotspots, Hotspot{
+			Geohash:        h,
+			Count:          c.n,
+			Lat:            c.lat / float64(c.n),
+			Lng:            c.lng / float64(c.n),
+			Bounds:         [4]float64{minLat, minLng, maxLat, maxLng},
+			ViolationTypes: c.vio.top(),
+		})
+	}
+	sort.Slice(s.Hotspots, func(a, b int) bool {
+		if s.Hotspots[a].Count != s.Hotspots[b].Count {
+			return s.Hotspots[a].Count > s.Hotspots[b].Count
+		}
+		return s.Hotspots[a].Geohash < s.Hotspots[b].Geohash
+	})
+	if opts.Top > 0 && len(s.Hotspots) > opts.Top {
+		s.Hotspots = s.Hotspots[:opts.Top]
+	}
+	return s
+}
+
+func reportTime(r model.Report) (time.Time, bool) {
+	v := r.OccurredAt
+	if v == "" {
+		v = r.Timestamp
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, err == nil
+}
+
+type counter map[string]int
+
+func (c counter) add(k string) { c[k]++ }
+
+// top 按数量从多到少排列，数量相同时按名称
+func (c counter) top() []Count {
+	out := c.list()
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Count != out[b].Count {
+			return out[a].Count > out[b].Count
+		}
+		return out[a].Key < out[b].Key
+	})
+	return out
+}
+
+// sorted 按名称排列，用于日期
+func (c counter) sorted() []Count {
+	out := c.list()
+	sort.Slice(out, func(a, b int) bool { return out[a].Key < out[b].Key })
+	return out
+}
+
+func (c counter) list() []Count {
+	out := make([]Count, 0, len(c))
+	for k, n := range c {
+		out = append(out, Count{Key: k, Count: n})
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+package stats
+
+import (
+	"testing"
+
+	"SnapReport/internal/model"
+)
+
+func TestCompute(t *testing.T) {
+	reports := []model.Report{
+		{ID: "1", Status: "submitted", City: "深圳市", RoadName: "深南大道", DeviceID: "d1", ViolationType: "running_red_light",
+			Tags: []string{"night"}, Timestamp: "2024-04-30T17:00:00Z", Latitude: 22.5431, Longitude: 113.9345},
+		{ID: "2", Status: "prepared", City: "深圳市", RoadName: "深南大道", DeviceID: "d1", ViolationType: "running_red_light",
+			Timestamp: "2024-05-01T02:00:00Z", Latitude: 22.5433, Longitude: 113.9347},
+		{ID: "3", Status: "submitted", City: "深圳市", RoadName: "广深沿江高速", IsHighway: true, DeviceID: "d2",
+			Tags: []string{"night", "rain"}, Timestamp: "2024-05-06T02:00:00Z", OccurredAt: "2024-05-05T15:59:00Z",
+			Latitude: 22.70, Longitude: 113.80},
+		{ID: "4", Status: "prepared", City: "Unknown", DeviceID: "d2", Timestamp: "2024-05-06T03:00:00Z"},
+	}
+	s := Compute(reports, Options{})
+	if s.Total != 4 || s.ByStatus["submitted"] != 2 || s.SubmittedRatio != 0.5 || s.Highway != 1 || s.Urban != 3 {
+		t.Fatalf("unexpected totals: %+v", s)
+	}
+	if s.ByCity[0] != (Count{"深圳市", 3}) || s.ByRoad[0] != (Count{"深南大道", 2}) || s.ByTag[0] != (Count{"night", 2}) ||
+		s.ByViolation[1] != (Count{"running_red_light", 2}) || len(s.ByDevice) != 2 {
+		t.Fatalf("unexpected breakdowns: %+v", s)
+	}
+	// 按北京时间分组：17:00Z 是 5 月 1 日，15:59Z 是 5 月 5 日
+	wantDays := []Count{{"2024-05-01", 2}, {"2024-05-05", 1}, {"2024-05-06", 1}}
+	if len(s.ByDay) != 3 || s.ByDay[0] != wantDays[0] || s.ByDay[1] != wantDays[1] || s.ByDay[2] != wantDays[2] {
+		t.Fatalf("by day = %+v", s.ByDay)
+	}
+	if len(s.ByWeek) != 2 || s.ByWeek[0] != (Count{"2024-W18", 3}) || s.ByWeek[1] != (Count{"2024-W19", 1}) {
+		t.Fatalf("by week = %+v", s.ByWeek)
+	}
+
+	if len(s.Hotspots) != 2 {
+		t.Fatalf("hotspots = %+v", s.Hotspots)
+	}
+	h := s.Hotspots[0]
+	if h.Count != 2 || h.Geohash != "ws100x" || h.Lat < 22.5431 || h.Lat > 22.5433 ||
+		h.Bounds[0] > 22.5431 || h.Bounds[2] < 22.5433 || h.ViolationTypes[0] != (Count{"running_red_light", 2}) {
+		t.Fatalf("unexpected top hotspot: %+v", h)
+	}
+
+	if top := Compute(reports, Options{Top: 1, Precision: 2}); len(top.Hotspots) != 1 || top.Hotspots[0].Count != 3 || top.Precision != 2 {
+		t.Fatalf("coarse hotspots = %+v", top.Hotspots)
+	}
+}
+
+func TestComputeEmpty(t *testing.T) {
+	s := Compute(nil, Options{})
+	if s.Total != 0 || s.SubmittedRatio != 0 || s.Hotspots == nil || s.ByCity == nil {
+		t.Fatalf("unexpected empty stats: %+v", s)
+	}
+}
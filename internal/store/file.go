@@ -0,0 +1,104 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"SnapReport/internal/model"
+)
+
+// FileStore 将每份报告保存为目录下的一个 JSON 文件，并在内存中保留一份副本。
+// 写文件失败时 Save 返回错误，内存中的副本不变，避免重启后丢失已确认的修改。
+type FileStore struct {
+	*MemoryStore
+	dir string
+	// wmu 保证文件和内存副本按相同的顺序更新
+	wmu sync.Mutex
+}
+
+// NewFileStore 打开 dir 并加载其中已有的报告
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{MemoryStore: NewMemoryStore(), dir: dir}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var r model.Report
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, fmt.Errorf("load report %s: %w", e.Name(), err)
+		}
+		s.items[r.ID] = r
+	}
+	return s, nil
+}
+
+func (s *FileStore) Save(r model.Report) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if err := s.write(r); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrSave, r.ID, err)
+	}
+	return s.MemoryStore.Save(r)
+}
+
+func (s *FileStore) write(r model.Report) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免进程中途退出留下半个文件
+	path := s.path(r.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(id string) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("store: delete report %s: %v", id, err)
+	}
+	s.MemoryStore.Delete(id)
+}
+
+// Close 等待进行中的写入完成，并将目录同步到磁盘，使已保存报告的重命名在
+// 断电后仍然有效。Close 之后不应再调用 Save 或 Delete。
+func (s *FileStore) Close() error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// path 返回报告文件的路径。报告 ID 只含字母、数字和下划线，去掉路径部分以防万一。
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"SnapReport/internal/model"
+)
+
+func TestFileStoreReloadsSavedReports(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Save(model.Report{ID: "rep_a", DeviceID: "dev1", Timestamp: "2024-05-01T00:00:00Z", Status: "prepared"})
+	s.Save(model.Report{ID: "rep_b", DeviceID: "dev1", Timestamp: "2024-05-02T00:00:00Z", Status: "prepared"})
+	s.Save(model.Report{ID: "rep_a", DeviceID: "dev1", Timestamp: "2024-05-01T00:00:00Z", Status: "submitted"})
+	s.Save(model.Report{ID: "rep_c", DeviceID: "dev2", Timestamp: "2024-05-03T00:00:00Z"})
+	s.Delete("rep_c")
+	s.Delete("rep_missing") // 不存在的报告不报错
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, " ") != "rep_a.json rep_b.json" {
+		t.Fatalf("files = %v", names)
+	}
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reopened.Query(Filter{})
+	if len(got) != 2 || got[0].ID != "rep_a" || got[0].Status != "submitted" || got[1].ID != "rep_b" {
+		t.Fatalf("reloaded %+v", got)
+	}
+	if _, ok := reopened.Get("rep_c"); ok {
+		t.Fatalf("deleted report reloaded")
+	}
+}
+
+func TestFileStoreIgnoresOtherFilesAndRejectsCorruptReports(t *testing.T) {
+	dir := t.TempDir()
+	// 中途退出留下的临时文件和子目录不会被加载
+	for name, body := range map[string]string{
+		"rep_a.json.tmp": "{",
+		"notes.txt":      "hello",
+		"rep_b.json":     `{"id":"rep_b","device_id":"dev1"}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub.json"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.List(); len(got) != 1 || got[0].ID != "rep_b" {
+		t.Fatalf("loaded %+v", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "rep_c.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(dir); err == nil || !strings.Contains(err.Error(), "rep_c.json") {
+		t.Fatalf("expected error naming the corrupt file, got %v", err)
+	}
+}
+
+func TestFileStoreSaveFailsWithoutChangingMemory(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(model.Report{ID: "rep_a", DeviceID: "dev1", Status: "prepared"}); err != nil {
+		t.Fatal(err)
+	}
+	// 报告文件所在位置被目录占用，写入失败
+	if err := os.Remove(filepath.Join(dir, "rep_a.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "rep_a.json"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(model.Report{ID: "rep_a", DeviceID: "dev1", Status: "submitted"}); !errors.Is(err, ErrSave) {
+		t.Fatalf("expected ErrSave, got %v", err)
+	}
+	if got, _ := s.Get("rep_a"); got.Status != "prepared" {
+		t.Fatalf("memory updated after failed write: %+v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rep_a.json.tmp")); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+}
@@ -1,15 +1,62 @@
 package store
 
 import (
+	"errors"
+	"sort"
+	"strings"
 	"sync"
 
 	"SnapReport/internal/model"
 )
 
+// ErrSave 表示报告未能写入持久存储，此时存储中的报告保持不变
+var ErrSave = errors.New("save report failed")
+
 type Store interface {
-	Save(r model.Report)
+	// Save 保存报告，失败时返回包装了 ErrSave 的错误且不修改已有报告
+	Save(r model.Report) error
 	Get(id string) (model.Report, bool)
 	List() []model.Report
+	Query(f Filter) []model.Report
+	// Each 按与 Query 相同的顺序对满足条件的报告逐个调用 fn，fn 返回错误时停止并返回该错误
+	Each(f Filter, fn func(model.Report) error) error
+	Delete(id string)
+}
+
+// Filter 是报告列表的查询条件，零值字段不参与过滤
+type Filter struct {
+	OrgID    string
+	DeviceID string
+	Status   string
+	From     string // RFC3339，包含
+	To       string // RFC3339，不包含
+	// Plate 是规范化后的号牌片段，匹配号牌中包含该片段的报告，
+	// 方便只看清部分号牌时查询
+	Plate string
+}
+
+// Match 报告 r 是否满足过滤条件
+func (f Filter) Match(r model.Report) bool {
+	if f.OrgID != "" && r.OrgID != f.OrgID {
+		return false
+	}
+	if f.DeviceID != "" && r.DeviceID != f.DeviceID {
+		return false
+	}
+	if f.Status != "" && r.Status != f.Status {
+		return false
+	}
+	// 时间戳都是 UTC RFC3339，可以直接按字符串比较
+	if f.From != "" && r.Timestamp < f.From {
+		return false
+	}
+	if f.To != "" && r.Timestamp >= f.To {
+		return false
+	}
+	if f.Plate != "" && (r.Vehicle == nil || !strings.Contains(r.Vehicle.Plate, f.Plate)) {
+		return false
+	}
+	return true
 }
 
 type MemoryStore struct {
@@ -23,10 +70,11 @@ func NewMemoryStore() *MemoryStore {
 	}
 }
 
-func (s *MemoryStore) Save(r model.Report) {
+func (s *MemoryStore) Save(r model.Report) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.items[r.ID] = r
+	return nil
 }
 
 func (s *MemoryStore) Get(id string) (model.Report, bool) {
@@ -36,6 +84,12 @@ func (s *MemoryStore) Get(id string) (model.Report, bool) {
 	return r, ok
 }
 
+func (s *MemoryStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+}
+
 func (s *MemoryStore) List() []model.Report {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -45,3 +99,53 @@ func (s *MemoryStore) List() []model.Report {
 	}
 	return out
 }
+
+// Query 按时间先后返回满足条件的报告
+func (s *MemoryStore) Query(f Filter) []model.Report {
+	s.mu.RLock()
+	out := make([]model.Report, 0)
+	for _, r := range s.items {
+		if f.Match(r) {
+			out = append(out, r)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Timestamp != out[b].Timestamp {
+			return out[a].Timestamp < out[b].Timestamp
+		}
+		return out[a].ID < out[b].ID
+	})
+	return out
+}
+
+// Each 按时间先后对满足条件的报告逐个调用 fn。只在排序时复制时间戳和 ID，
+// 报告在调用 fn 之前逐个读取，因此内存占用与报告大小无关，也不会在 fn
+// 执行期间持有锁。遍历期间被删除或不再满足条件的报告会被跳过。
+func (s *MemoryStore) Each(f Filter, fn func(model.Report) error) error {
+	type entry struct{ ts, id string }
+	s.mu.RLock()
+	keys := make([]entry, 0)
+	for _, r := range s.items {
+		if f.Match(r) {
+			keys = append(keys, entry{r.Timestamp, r.ID})
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].ts != keys[b].ts {
+			return keys[a].ts < keys[b].ts
+		}
+		return keys[a].id < keys[b].id
+	})
+	for _, k := range keys {
+		r, ok := s.Get(k.id)
+		if !ok || !f.Match(r) {
+			continue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"SnapReport/internal/model"
+)
+
+func TestEachMatchesQueryAndSkipsDeleted(t *testing.T) {
+	s := NewMemoryStore()
+	for _, r := range []model.Report{
+		{ID: "rep_c", DeviceID: "dev1", Timestamp: "2024-05-03T00:00:00Z"},
+		{ID: "rep_a", DeviceID: "dev1", Timestamp: "2024-05-01T00:00:00Z"},
+		{ID: "rep_x", DeviceID: "dev2", Timestamp: "2024-05-02T00:00:00Z"},
+		{ID: "rep_b", DeviceID: "dev1", Timestamp: "2024-05-01T00:00:00Z"},
+	} {
+		s.Save(r)
+	}
+	f := Filter{DeviceID: "dev1"}
+
+	var got []string
+	err := s.Each(f, func(r model.Report) error {
+		got = append(got, r.ID)
+		if r.ID == "rep_a" {
+			s.Delete("rep_b") // 遍历期间删除的报告被跳过
+		}
+		return nil
+	})
+	if err != nil || len(got) != 2 || got[0] != "rep_a" || got[1] != "rep_c" {
+		t.Fatalf("Each = %v, %v", got, err)
+	}
+	if q := s.Query(f); len(q) != 2 || q[0].ID != "rep_a" || q[1].ID != "rep_c" {
+		t.Fatalf("Query = %+v", q)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	if err := s.Each(f, func(model.Report) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Fatalf("Each did not stop: %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,251 @@
+// Package tenant 管理组织（租户）。每个组织拥有独立的报告、设备、
+// 提交人信息和地理编码 API Key。
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"SnapReport/internal/geo"
+	"SnapReport/internal/statefile"
+)
+
+// DefaultOrg 是未启用认证或未指定组织时使用的组织
+const DefaultOrg = "default"
+
+// GeocoderConfig 为空时使用全局地理编码器
+type GeocoderConfig struct {
+	Type      string `json:"type"`
+	UserAgent string `json:"user_agent,omitempty"`
+	APIKey    string `json:"-"`
+}
+
+// SubmitterConfig 是向交管部门提交报告时使用的提交人信息
+type SubmitterConfig struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type Org struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Geocoder  GeocoderConfig  `json:"geocoder"`
+	Submitter SubmitterConfig `json:"submitter"`
+	CreatedAt string          `json:"created_at"`
+}
+
+var (
+	ErrOrgExists       = errors.New("organisation already exists")
+	ErrOrgNotFound     = errors.New("organisation not found")
+	ErrInvalidOrgID    = errors.New("organisation id must be 1-64 lowercase letters, digits, '-' or '_'")
+	ErrInvalidGeocoder = errors.New("invalid geocoder")
+)
+
+var orgIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// Registry 保存组织及其地理编码器
+type Registry struct {
+	mu        sync.RWMutex
+	orgs      map[string]*Org
+	geocoders map[string]geo.Geocoder
+	fallback  geo.Geocoder
+
+	// path 为空时通过 Create 添加的组织只保存在内存中，见 Persist
+	path    string
+	created map[string]bool
+}
+
+// NewRegistry 创建只包含 DefaultOrg 的注册表，fallback 为未单独配置地理编码器的组织所用，
+// 可为 nil
+func NewRegistry(fallback geo.Geocoder) *Registry {
+	r := &Registry{
+		orgs:      make(map[string]*Org),
+		geocoders: make(map[string]geo.Geocoder),
+		fallback:  fallback,
+		created:   make(map[string]bool),
+	}
+	r.orgs[DefaultOrg] = &Org{ID: DefaultOrg, Name: "Default", CreatedAt: now()}
+	return r
+}
+
+// Create 通过 API 添加一个组织。org.Geocoder.Type 非空时为其创建独立的地理
+// 编码器。调用过 Persist 时组织写入文件，写入失败时不添加组织。
+func (r *Registry) Create(org Org) (Org, error) {
+	return r.put(org, true)
+}
+
+// Put 添加配置文件中的组织，或替换已有组织的名称、地理编码器和提交人信息
+// 并保留创建时间，用于启动和重新加载配置。此后该组织以配置为准。
+func (r *Registry) Put(org Org) (Org, error) {
+	return r.put(org, false)
+}
+
+// PutAll 先校验 orgs 中的全部组织并构造各自的地理编码器，全部成功后再
+// 逐个按 Put 添加或替换。任一组织无效时返回其错误，注册表保持不变。
+func (r *Registry) PutAll(orgs []Org) error {
+	geocoders := make([]geo.Geocoder, len(orgs))
+	for i, org := range orgs {
+		g, err := build(org)
+		if err != nil {
+			return err
+		}
+		geocoders[i] = g
+	}
+	for i, org := range orgs {
+		if _, err := r.store(org, geocoders[i], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) put(org Org, runtime bool) (Org, error) {
+	g, err := build(org)
+	if err != nil {
+		return Org{}, err
+	}
+	return r.store(org, g, runtime)
+}
+
+// build 校验组织 ID 并构造组织单独配置的地理编码器，未配置时返回 nil
+func build(org Org) (geo.Geocoder, error) {
+	if !orgIDPattern.MatchString(org.ID) {
+		return nil, ErrInvalidOrgID
+	}
+	if org.Geocoder.Type == "" {
+		return nil, nil
+	}
+	g, err := geo.New(org.Geocoder.Type, org.Geocoder.APIKey, org.Geocoder.UserAgent)
+	if err != nil {
+		return nil, fmt.Errorf("org %s: %w: %v", org.ID, ErrInvalidGeocoder, err)
+	}
+	return g, nil
+}
+
+func (r *Registry) store(org Org, g geo.Geocoder, runtime bool) (Org, error) {
+	if org.Name == "" {
+		org.Name = org.ID
+	}
+	org.CreatedAt = now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.orgs[org.ID]; ok {
+		if runtime {
+			return Org{}, ErrOrgExists
+		}
+		org.CreatedAt = old.CreatedAt
+	}
+	r.orgs[org.ID] = &org
+	delete(r.geocoders, org.ID)
+	if g != nil {
+		r.geocoders[org.ID] = g
+	}
+	switch {
+	case runtime:
+		r.created[org.ID] = true
+		if err := r.save(); err != nil {
+			delete(r.orgs, org.ID)
+			delete(r.geocoders, org.ID)
+			delete(r.created, org.ID)
+			return Org{}, err
+		}
+	case r.created[org.ID]:
+		// 写入失败时文件中仍有该组织，下次启动时以配置为准跳过它
+		delete(r.created, org.ID)
+		_ = r.save()
+	}
+	return org, nil
+}
+
+// savedOrg 是 Persist 文件中的组织，包含地理编码 API Key
+type savedOrg struct {
+	Org
+	GeocoderAPIKey string `json:"geocoder_api_key,omitempty"`
+}
+
+// Persist 加载 path 中通过 API 创建的组织，之后 Create 的结果写入该文件。
+// 须在添加配置中的组织之后调用，与配置冲突的组织被跳过。
+func (r *Registry) Persist(path string) error {
+	var saved []savedOrg
+	if err := statefile.Load(path, &saved); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, so := range saved {
+		org := so.Org
+		org.Geocoder.APIKey = so.GeocoderAPIKey
+		if _, ok := r.orgs[org.ID]; ok {
+			log.Printf("tenant: skipping saved org %q: defined in the config file", org.ID)
+			continue
+		}
+		if org.Geocoder.Type != "" {
+			g, err := geo.New(org.Geocoder.Type, org.Geocoder.APIKey, org.Geocoder.UserAgent)
+			if err != nil {
+				log.Printf("tenant: skipping saved org %q: %v", org.ID, err)
+				continue
+			}
+			r.geocoders[org.ID] = g
+		}
+		r.orgs[org.ID] = &org
+		r.created[org.ID] = true
+	}
+	r.path = path
+	return nil
+}
+
+// save 写入 Persist 的文件，调用方持有 r.mu
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	saved := make([]savedOrg, 0, len(r.created))
+	for id := range r.created {
+		o := r.orgs[id]
+		saved = append(saved, savedOrg{Org: *o, GeocoderAPIKey: o.Geocoder.APIKey})
+	}
+	sort.Slice(saved, func(a, b int) bool { return saved[a].ID < saved[b].ID })
+	return statefile.Save(r.path, saved)
+}
+
+func (r *Registry) Get(id string) (Org, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	o, ok := r.orgs[id]
+	if !ok {
+		return Org{}, false
+	}
+	return *o, true
+}
+
+func (r *Registry) List() []Org {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Org, 0, len(r.orgs))
+	for _, o := range r.orgs {
+		out = append(out, *o)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out
+}
+
+// Geocoder 返回组织使用的地理编码器
+func (r *Registry) Geocoder(orgID string) geo.Geocoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if g, ok := r.geocoders[orgID]; ok {
+		return g
+	}
+	return r.fallback
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,78 @@
+package tenant
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistCreatedOrgs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orgs.json")
+	open := func(config ...Org) *Registry {
+		r := NewRegistry(nil)
+		for _, o := range config {
+			if _, err := r.Put(o); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := r.Persist(path); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r := open(Org{ID: "fleet-a"})
+	created, err := r.Create(Org{ID: "fleet-b", Geocoder: GeocoderConfig{Type: "amap", APIKey: "key-b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Create(Org{ID: "fleet-c"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Create(Org{ID: "fleet-a"}); !errors.Is(err, ErrOrgExists) {
+		t.Fatalf("expected ErrOrgExists, got %v", err)
+	}
+	if _, err := r.Create(Org{ID: "fleet-d", Geocoder: GeocoderConfig{Type: "amap"}}); !errors.Is(err, ErrInvalidGeocoder) {
+		t.Fatalf("expected ErrInvalidGeocoder, got %v", err)
+	}
+
+	// fleet-c 后来写入配置文件，以配置为准
+	r = open(Org{ID: "fleet-a"}, Org{ID: "fleet-c", Name: "From config"})
+	b, ok := r.Get("fleet-b")
+	if !ok || b.CreatedAt != created.CreatedAt || b.Geocoder.APIKey != "key-b" || r.Geocoder("fleet-b") == nil {
+		t.Fatalf("org not restored: %+v", b)
+	}
+	if c, _ := r.Get("fleet-c"); c.Name != "From config" {
+		t.Fatalf("config org overridden by saved org: %+v", c)
+	}
+	if _, ok := r.Get("fleet-d"); ok || len(r.List()) != 4 {
+		t.Fatalf("orgs = %+v", r.List())
+	}
+}
+
+func TestPutAllChangesNothingWhenAnyOrgIsInvalid(t *testing.T) {
+	r := NewRegistry(nil)
+	if _, err := r.Put(Org{ID: "fleet-a", Name: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	err := r.PutAll([]Org{
+		{ID: "fleet-a", Name: "A2", Geocoder: GeocoderConfig{Type: "amap", APIKey: "key"}},
+		{ID: "fleet-b", Geocoder: GeocoderConfig{Type: "bogus"}},
+	})
+	if !errors.Is(err, ErrInvalidGeocoder) {
+		t.Fatalf("expected ErrInvalidGeocoder, got %v", err)
+	}
+	if org, _ := r.Get("fleet-a"); org.Name != "A" || r.Geocoder("fleet-a") != nil {
+		t.Fatalf("fleet-a changed by rejected PutAll: %+v", org)
+	}
+	if _, ok := r.Get("fleet-b"); ok {
+		t.Fatal("fleet-b added by rejected PutAll")
+	}
+
+	if err := r.PutAll([]Org{{ID: "fleet-a", Name: "A2"}, {ID: "fleet-b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if org, _ := r.Get("fleet-a"); org.Name != "A2" {
+		t.Fatalf("fleet-a = %+v", org)
+	}
+}
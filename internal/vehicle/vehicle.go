@@ -0,0 +1,144 @@
+// Package vehicle 校验和规范化违法车辆信息，包括中国大陆机动车号牌
+// （普通号牌、新能源号牌以及挂、学、警、港、澳等专用号牌）。
+package vehicle
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"SnapReport/internal/model"
+)
+
+var (
+	ErrInvalidPlate = errors.New("invalid license plate")
+	ErrInvalidField = errors.New("invalid vehicle field")
+)
+
+// PlateKind 是号牌的种类
+type PlateKind string
+
+const (
+	PlateStandard       PlateKind = "standard"         // 普通号牌，蓝牌或黄牌
+	PlateNewEnergySmall PlateKind = "new_energy_small" // 小型新能源汽车，渐变绿牌
+	PlateNewEnergyLarge PlateKind = "new_energy_large" // 大型新能源汽车，黄绿双拼牌
+	PlateSpecial        PlateKind = "special"          // 挂、学、警、港、澳、领、使
+)
+
+// 号牌颜色
+const (
+	ColorBlue        = "blue"
+	ColorYellow      = "yellow"
+	ColorGreen       = "green"
+	ColorYellowGreen = "yellow_green"
+	ColorWhite       = "white"
+	ColorBlack       = "black"
+)
+
+var plateColors = map[string]bool{
+	ColorBlue: true, ColorYellow: true, ColorGreen: true,
+	ColorYellowGreen: true, ColorWhite: true, ColorBlack: true,
+}
+
+// VehicleTypes 是允许的车辆类型
+var VehicleTypes = []string{"car", "suv", "mpv", "van", "pickup", "truck", "bus", "motorcycle", "other"}
+
+const provinces = "京津沪渝冀豫云辽黑湘皖鲁新苏浙赣鄂桂甘晋蒙陕吉闽贵粤青藏川宁琼"
+
+// 号牌序号不使用字母 I 和 O，以免与数字 1 和 0 混淆
+const serial = `[A-HJ-NP-Z0-9]`
+
+var (
+	reStandard = regexp.MustCompile(`^[` + provinces + `][A-HJ-NP-Z]` + serial + `{5}$`)
+	reNESmall  = regexp.MustCompile(`^[` + provinces + `][A-HJ-NP-Z][DF]` + serial + `[0-9]{4}$`)
+	reNELarge  = regexp.MustCompile(`^[` + provinces + `][A-HJ-NP-Z][0-9]{5}[DF]$`)
+	reSpecial  = regexp.MustCompile(`^[` + provinces + `][A-HJ-NP-Z]` + serial + `{4}[挂学警港澳领使]$`)
+)
+
+// NormalizePlate 去除空格、分隔符并转为大写，例如 "粤b·12345" -> "粤B12345"
+func NormalizePlate(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r), r == '·', r == '.', r == '-', r == '•', r == '・':
+			continue
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// ParsePlate 规范化并校验号牌，返回规范化后的号牌和种类
+func ParsePlate(s string) (string, PlateKind, error) {
+	p := NormalizePlate(s)
+	switch {
+	case reNESmall.MatchString(p):
+		return p, PlateNewEnergySmall, nil
+	case reNELarge.MatchString(p):
+		return p, PlateNewEnergyLarge, nil
+	case reStandard.MatchString(p):
+		return p, PlateStandard, nil
+	case reSpecial.MatchString(p):
+		return p, PlateSpecial, nil
+	}
+	return p, "", fmt.Errorf("%w: %q", ErrInvalidPlate, s)
+}
+
+// Validate 校验并规范化车辆信息：号牌必须符合格式，颜色和类型必须为已知值，
+// 新能源号牌的颜色必须为 green 或 yellow_green。号牌为空时只校验其余字段，
+// 因为目击者不一定看清了号牌。
+func Validate(v model.Vehicle) (model.Vehicle, error) {
+	v.PlateColor = strings.ToLower(strings.TrimSpace(v.PlateColor))
+	v.Type = strings.ToLower(strings.TrimSpace(v.Type))
+	v.Color = strings.TrimSpace(v.Color)
+	v.Description = strings.TrimSpace(v.Description)
+
+	if v.PlateColor != "" && !plateColors[v.PlateColor] {
+		return v, fmt.Errorf("%w: plate_color %q", ErrInvalidField, v.PlateColor)
+	}
+	if v.Type != "" && !validType(v.Type) {
+		return v, fmt.Errorf("%w: type %q", ErrInvalidField, v.Type)
+	}
+	if v.Plate == "" {
+		return v, nil
+	}
+
+	plate, kind, err := ParsePlate(v.Plate)
+	if err != nil {
+		return v, err
+	}
+	v.Plate = plate
+	switch kind {
+	case PlateNewEnergySmall:
+		if v.PlateColor == "" {
+			v.PlateColor = ColorGreen
+		}
+		if v.PlateColor != ColorGreen {
+			return v, fmt.Errorf("%w: new energy plate %s must be green", ErrInvalidField, plate)
+		}
+	case PlateNewEnergyLarge:
+		if v.PlateColor == "" {
+			v.PlateColor = ColorYellowGreen
+		}
+		if v.PlateColor != ColorYellowGreen {
+			return v, fmt.Errorf("%w: large new energy plate %s must be yellow_green", ErrInvalidField, plate)
+		}
+	case PlateStandard:
+		if v.PlateColor == ColorGreen || v.PlateColor == ColorYellowGreen {
+			return v, fmt.Errorf("%w: %s is not a new energy plate", ErrInvalidField, plate)
+		}
+	}
+	return v, nil
+}
+
+func validType(t string) bool {
+	for _, v := range VehicleTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
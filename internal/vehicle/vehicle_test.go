@@ -0,0 +1,67 @@
+package vehicle
+
+import (
+	"errors"
+	"testing"
+
+	"SnapReport/internal/model"
+)
+
+func TestParsePlate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		kind PlateKind
+	}{
+		{"粤B12345", "粤B12345", PlateStandard},
+		{"京a·8c9d1", "京A8C9D1", PlateStandard},
+		{"沪 A-D12345", "沪AD12345", PlateNewEnergySmall},
+		{"浙AFA1234", "浙AFA1234", PlateNewEnergySmall},
+		{"苏E12345D", "苏E12345D", PlateNewEnergyLarge},
+		{"鲁B1234挂", "鲁B1234挂", PlateSpecial},
+		{"粤Z1234港", "粤Z1234港", PlateSpecial},
+	}
+	for _, tt := range tests {
+		got, kind, err := ParsePlate(tt.in)
+		if err != nil || got != tt.want || kind != tt.kind {
+			t.Fatalf("ParsePlate(%q) = %q, %q, %v; want %q, %q", tt.in, got, kind, err, tt.want, tt.kind)
+		}
+	}
+}
+
+func TestParsePlateRejects(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"AB12345",  // 缺少省份简称
+		"粤B1234",   // 位数不足
+		"粤BI2345",  // 序号不能使用 I
+		"粤BO2345",  // 序号不能使用 O
+		"粤1B2345",  // 第二位必须为字母
+		"粤BD1234A", // 新能源小型车后四位必须为数字
+		"粤B123456", // 7 位数字不是新能源号牌
+		"港B12345",  // 港不是省份简称
+	} {
+		if _, _, err := ParsePlate(in); !errors.Is(err, ErrInvalidPlate) {
+			t.Fatalf("ParsePlate(%q) accepted", in)
+		}
+	}
+}
+
+func TestValidatePlateColour(t *testing.T) {
+	v, err := Validate(model.Vehicle{Plate: "粤BD12345"})
+	if err != nil || v.PlateColor != ColorGreen {
+		t.Fatalf("new energy plate colour defaulted to %q, %v", v.PlateColor, err)
+	}
+	if _, err := Validate(model.Vehicle{Plate: "粤BD12345", PlateColor: "blue"}); !errors.Is(err, ErrInvalidField) {
+		t.Fatalf("blue new energy plate accepted")
+	}
+	if _, err := Validate(model.Vehicle{Plate: "粤B12345", PlateColor: "green"}); !errors.Is(err, ErrInvalidField) {
+		t.Fatalf("green standard plate accepted")
+	}
+	if _, err := Validate(model.Vehicle{Type: "spaceship"}); !errors.Is(err, ErrInvalidField) {
+		t.Fatalf("unknown vehicle type accepted")
+	}
+	if v, err := Validate(model.Vehicle{Type: " SUV ", Color: "白色"}); err != nil || v.Type != "suv" {
+		t.Fatalf("vehicle without plate rejected: %+v %v", v, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package violation 定义违法/事件类型分类，以及每种类型所需的证据。
+// 默认分类中的代码参照公安部《道路交通安全违法行为代码》，各地可能有所不同，
+// 可在配置文件中覆盖。
+package violation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownType     = errors.New("unknown violation type")
+	ErrMissingEvidence = errors.New("missing required evidence")
+)
+
+// Evidence 是某种类型的报告必须具备的证据
+type Evidence struct {
+	Video          bool `json:"video" yaml:"video"`                       // 必须有视频
+	MinDurationSec int  `json:"min_duration_sec" yaml:"min_duration_sec"` // 视频最短时长
+	Location       bool `json:"location" yaml:"location"`                 // 必须有 GPS 坐标
+}
+
+type Type struct {
+	ID       string   `json:"id" yaml:"id"`     // 稳定的英文标识，保存在报告中
+	Code     string   `json:"code" yaml:"code"` // 交管部门违法代码，事件类可为空
+	Name     string   `json:"name" yaml:"name"`
+	NameEN   string   `json:"name_en" yaml:"name_en"`
+	Aliases  []string `json:"aliases,omitempty" yaml:"aliases"`
+	Evidence Evidence `json:"evidence" yaml:"evidence"`
+}
+
+// Taxonomy 是一组违法/事件类型
+type Taxonomy struct {
+	types []Type
+	index map[string]int
+}
+
+// New 创建分类并检查 ID、代码、名称和别名不重复
+func New(types []Type) (*Taxonomy, error) {
+	t := &Taxonomy{index: make(map[string]int)}
+	for i, typ := range types {
+		if typ.ID == "" {
+			return nil, fmt.Errorf("violation type #%d: id required", i+1)
+		}
+		keys := append([]string{typ.ID, typ.Code, typ.Name, typ.NameEN}, typ.Aliases...)
+		for _, k := range keys {
+			k = normalize(k)
+			if k == "" {
+				continue
+			}
+			if j, ok := t.index[k]; ok && j != i {
+				return nil, fmt.Errorf("violation type %s: %q already used by %s", typ.ID, k, types[j].ID)
+			}
+			t.index[k] = i
+		}
+	}
+	t.types = append([]Type(nil), types...)
+	return t, nil
+}
+
+// Default 返回内置分类
+func Default() *Taxonomy {
+	t, err := New(DefaultTypes)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Types 返回全部类型
+func (t *Taxonomy) Types() []Type {
+	return append([]Type(nil), t.types...)
+}
+
+// Resolve 按 ID、代码、中英文名称或别名（不区分大小写）查找类型
+func (t *Taxonomy) Resolve(s string) (Type, bool) {
+	i, ok := t.index[normalize(s)]
+	if !ok {
+		return Type{}, false
+	}
+	return t.types[i], true
+}
+
+// Check 检查报告是否具备该类型要求的证据，hasVideo 为抓取到视频地址
+func (typ Type) Check(durationSec int, lat, lng float64, hasVideo bool) error {
+	e := typ.Evidence
+	if e.Location && lat == 0 && lng == 0 {
+		return fmt.Errorf("%w: %s requires location", ErrMissingEvidence, typ.ID)
+	}
+	if e.Video && !hasVideo {
+		return fmt.Errorf("%w: %s requires video", ErrMissingEvidence, typ.ID)
+	}
+	if e.MinDurationSec > 0 && durationSec < e.MinDurationSec {
+		return fmt.Errorf("%w: %s requires at least %ds of video", ErrMissingEvidence, typ.ID, e.MinDurationSec)
+	}
+	return nil
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// DefaultTypes 是内置的违法/事件类型
+var DefaultTypes = []Type{
+	{
+		ID: "running_red_light", Code: "1625", Name: "闯红灯", NameEN: "Running a red light",
+		Aliases:  []string{"red light", "违反信号灯"},
+		Evidence: Evidence{Video: true, MinDurationSec: 10, Location: true},
+	},
+	{
+		ID: "illegal_lane_change", Code: "1345", Name: "违法变道", NameEN: "Illegal lane change",
+		Aliases:  []string{"lane change", "实线变道", "压实线"},
+		Evidence: Evidence{Video: true, MinDurationSec: 10, Location: true},
+	},
+	{
+		ID: "occupying_emergency_lane", Code: "1019", Name: "占用应急车道", NameEN: "Occupying the emergency lane",
+		Aliases:  []string{"emergency lane", "应急车道"},
+		Evidence: Evidence{Video: true, MinDurationSec: 10, Location: true},
+	},
+	{
+		ID: "wrong_way_driving", Code: "1301", Name: "逆向行驶", NameEN: "Driving against traffic",
+		Aliases:  []string{"wrong way", "逆行"},
+		Evidence: Evidence{Video: true, MinDurationSec: 5, Location: true},
+	},
+	{
+		ID: "not_yielding_to_pedestrians", Code: "1357", Name: "不礼让行人", NameEN: "Not yielding to pedestrians",
+		Aliases:  []string{"pedestrian", "礼让行人"},
+		Evidence: Evidence{Video: true, MinDurationSec: 5, Location: true},
+	},
+	{
+		ID: "ignoring_prohibition_sign", Code: "1344", Name: "违反禁令标志", NameEN: "Ignoring a prohibition sign",
+		Aliases:  []string{"禁令标志"},
+		Evidence: Evidence{Video: true, MinDurationSec: 5, Location: true},
+	},
+	{
+		ID: "handheld_phone", Code: "1223", Name: "驾驶时使用手持电话", NameEN: "Using a handheld phone while driving",
+		Aliases:  []string{"phone", "打电话"},
+		Evidence: Evidence{Video: true, Location: true},
+	},
+	{
+		ID: "illegal_parking", Code: "1039", Name: "违法停车", NameEN: "Illegal parking",
+		Aliases:  []string{"parking", "违停"},
+		Evidence: Evidence{Video: true, Location: true},
+	},
+	{
+		ID: "accident", Name: "交通事故", NameEN: "Traffic accident",
+		Aliases:  []string{"事故", "collision", "crash"},
+		Evidence: Evidence{Location: true},
+	},
+	{
+		ID: "other", Name: "其他", NameEN: "Other",
+	},
+}
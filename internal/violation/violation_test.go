@@ -0,0 +1,54 @@
+package violation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveNormalizesNames(t *testing.T) {
+	tax := Default()
+	for _, s := range []string{"accident", "Accident", " 事故 ", "交通事故", "CRASH"} {
+		typ, ok := tax.Resolve(s)
+		if !ok || typ.ID != "accident" {
+			t.Fatalf("%q resolved to %+v, %v", s, typ, ok)
+		}
+	}
+	if typ, ok := tax.Resolve("1625"); !ok || typ.ID != "running_red_light" {
+		t.Fatalf("code 1625 resolved to %+v", typ)
+	}
+	if _, ok := tax.Resolve("speeding-ish"); ok {
+		t.Fatalf("unknown type resolved")
+	}
+}
+
+func TestNewRejectsDuplicates(t *testing.T) {
+	_, err := New([]Type{
+		{ID: "a", Code: "1000"},
+		{ID: "b", Code: "1000"},
+	})
+	if err == nil {
+		t.Fatalf("expected duplicate code error")
+	}
+}
+
+func TestCheckEvidence(t *testing.T) {
+	typ, _ := Default().Resolve("running_red_light")
+	if err := typ.Check(20, 22.5, 113.9, true); err != nil {
+		t.Fatalf("complete evidence rejected: %v", err)
+	}
+	cases := []struct {
+		name     string
+		duration int
+		lat, lng float64
+		video    bool
+	}{
+		{"no location", 20, 0, 0, true},
+		{"no video", 20, 22.5, 113.9, false},
+		{"too short", 5, 22.5, 113.9, true},
+	}
+	for _, c := range cases {
+		if err := typ.Check(c.duration, c.lat, c.lng, c.video); !errors.Is(err, ErrMissingEvidence) {
+			t.Fatalf("%s: expected ErrMissingEvidence, got %v", c.name, err)
+		}
+	}
+}
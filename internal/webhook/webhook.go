@@ -0,0 +1,629 @@
+// Package webhook 将报告生命周期事件以签名 JSON 的形式推送给外部订阅者，
+// 失败时按指数退避重试，超过最大次数后进入死信列表。
+//
+// 投递是尽力而为的：等待重试的投递和死信只保存在内存中，进程重启后丢失。
+// 默认拒绝指向回环、内网和链路本地地址的订阅，防止订阅被用来探测内网。
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"SnapReport/internal/events"
+	"SnapReport/internal/ids"
+	"SnapReport/internal/statefile"
+)
+
+// 请求头
+const (
+	HeaderSignature = "X-SnapReport-Signature"
+	HeaderTimestamp = "X-SnapReport-Timestamp"
+	HeaderEvent     = "X-SnapReport-Event"
+	HeaderDelivery  = "X-SnapReport-Delivery"
+)
+
+// EventTypes 是可以订阅的事件类型，"*" 表示全部
+var EventTypes = []string{
+	events.ReportCreated,
+	events.ReportUpdated,
+	events.ReportStatusChanged,
+	events.ReportDeleted,
+	events.JobProgress,
+}
+
+// Subscription 只接收所属组织的事件；OrgID 为空的订阅（平台级）接收所有组织的事件
+type Subscription struct {
+	ID        string   `json:"id"`
+	OrgID     string   `json:"org_id,omitempty"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"-"`
+	CreatedAt string   `json:"created_at"`
+}
+
+func (s Subscription) matches(e events.Event) bool {
+	if s.OrgID != "" && s.OrgID != e.OrgID {
+		return false
+	}
+	for _, typ := range s.Events {
+		if typ == "*" || typ == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+type Attempt struct {
+	At         string `json:"at"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type Delivery struct {
+	ID             string         `json:"id"`
+	SubscriptionID string         `json:"subscription_id"`
+	EventID        int64          `json:"event_id"`
+	EventType      string         `json:"event_type"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       []Attempt      `json:"attempts"`
+	NextAttemptAt  string         `json:"next_attempt_at,omitempty"`
+
+	payload []byte
+}
+
+// Payload 是 POST 给订阅者的请求体
+type Payload struct {
+	DeliveryID string `json:"delivery_id"`
+	EventID    int64  `json:"event_id"`
+	Event      string `json:"event"`
+	Time       string `json:"time"`
+	Data       any    `json:"data"`
+}
+
+// SecretPrefix 是自动生成的订阅密钥的前缀
+const SecretPrefix = "whsec_"
+
+// Sign 计算签名，格式为 "sha256=<hex>"。签名内容是 timestamp（Unix 秒）、
+// "." 和请求体，接收方据此拒绝重放的旧请求。
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验签名和时间戳，时间戳与当前时间相差超过 tolerance 时拒绝，
+// 供接收方使用
+func Verify(secret, timestamp string, body []byte, signature string, tolerance time.Duration) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if d := time.Since(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// GenerateSecret 生成随机的订阅密钥
+func GenerateSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return SecretPrefix + hex.EncodeToString(b), nil
+}
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrInvalidURL   = errors.New("url must be an absolute http or https URL")
+	ErrInvalidEvent = errors.New("unknown event type")
+	ErrNotDead      = errors.New("delivery is not in the dead-letter list")
+	ErrConfigured   = errors.New("subscription is defined in the config file")
+	// ErrPrivateAddress 表示订阅地址指向回环、内网或链路本地地址，见 Dispatcher.AllowPrivate
+	ErrPrivateAddress = errors.New("url must not point to a loopback, private or link-local address")
+)
+
+// Dispatcher 订阅事件总线并投递给匹配的订阅者
+type Dispatcher struct {
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxBackoff  time.Duration
+	// MaxDelivered 和 MaxDead 是保留的成功投递和死信数量，超出时丢弃最早的记录。
+	// 投递成功后不再保留请求体。
+	MaxDelivered int
+	MaxDead      int
+	// AllowPrivate 为 false 时，添加订阅和建立连接时都拒绝回环、内网、
+	// 链路本地等地址，需要在添加订阅前设置
+	AllowPrivate bool
+
+	mu         sync.Mutex
+	subs       map[string]Subscription
+	deliveries map[string]*Delivery
+	delivered  []string // 按完成顺序排列的成功投递
+	dead       []string // 按进入顺序排列的死信
+	// path 为空时通过 Create 添加的订阅只保存在内存中，见 Persist
+	path    string
+	created map[string]bool
+	ctx     context.Context
+	wg      sync.WaitGroup
+}
+
+func NewDispatcher(maxAttempts int, backoff time.Duration) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	d := &Dispatcher{
+		MaxAttempts:  maxAttempts,
+		Backoff:      backoff,
+		MaxBackoff:   10 * time.Minute,
+		MaxDelivered: 100,
+		MaxDead:      1000,
+		subs:         make(map[string]Subscription),
+		deliveries:   make(map[string]*Delivery),
+		created:      make(map[string]bool),
+		ctx:          context.Background(),
+	}
+	// 在拨号时检查实际连接的地址，覆盖 DNS 变化和重定向；不使用代理，
+	// 否则检查的是代理的地址
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			if d.AllowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	d.Client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return d
+}
+
+// Add 校验并添加配置文件中的订阅，orgID 为空表示平台级订阅。secret 为空时
+// 生成一个，调用方从返回值的 Secret 取得并告知订阅者。
+func (d *Dispatcher) Add(orgID, rawURL string, eventTypes []string, secret string) (Subscription, error) {
+	return d.add(orgID, rawURL, eventTypes, secret, false)
+}
+
+// Create 与 Add 相同，用于通过 API 创建的订阅。调用过 Persist 时订阅写入文件，
+// 写入失败时不添加订阅。
+func (d *Dispatcher) Create(orgID, rawURL string, eventTypes []string, secret string) (Subscription, error) {
+	return d.add(orgID, rawURL, eventTypes, secret, true)
+}
+
+func (d *Dispatcher) add(orgID, rawURL string, eventTypes []string, secret string, runtime bool) (Subscription, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, ErrInvalidURL
+	}
+	if err := d.checkHost(u.Hostname()); err != nil {
+		return Subscription{}, err
+	}
+	if len(eventTypes) == 0 {
+		eventTypes = []string{"*"}
+	}
+	for _, e := range eventTypes {
+		if !validEvent(e) {
+			return Subscription{}, fmt.Errorf("%w: %s", ErrInvalidEvent, e)
+		}
+	}
+	if secret == "" {
+		var err error
+		if secret, err = GenerateSecret(); err != nil {
+			return Subscription{}, err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sub := Subscription{
+		ID:        d.nextID("wh_"),
+		OrgID:     orgID,
+		URL:       rawURL,
+		Events:    append([]string(nil), eventTypes...),
+		Secret:    secret,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	d.subs[sub.ID] = sub
+	if runtime {
+		d.created[sub.ID] = true
+		if err := d.save(); err != nil {
+			delete(d.subs, sub.ID)
+			delete(d.created, sub.ID)
+			return Subscription{}, err
+		}
+	}
+	return sub, nil
+}
+
+// checkHost 拒绝解析到受限地址的主机。解析失败时放行，投递时由拨号检查兜底。
+func (d *Dispatcher) checkHost(host string) error {
+	if d.AllowPrivate {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if blockedIP(a.IP) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+	}
+	return nil
+}
+
+// cgnat 是运营商级 NAT 的共享地址段 100.64.0.0/10
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// blockedIP 判断地址是否为回环、内网、链路本地、组播或未指定地址
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || cgnat.Contains(ip)
+}
+
+func validEvent(e string) bool {
+	if e == "*" {
+		return true
+	}
+	for _, t := range EventTypes {
+		if t == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove 删除通过 API 创建的订阅，orgID 非空时只能删除该组织的订阅。
+// 配置文件中的订阅返回 ErrConfigured。
+func (d *Dispatcher) Remove(orgID, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.subs[id]
+	if !ok || (orgID != "" && s.OrgID != orgID) {
+		return ErrNotFound
+	}
+	if !d.created[id] {
+		return ErrConfigured
+	}
+	delete(d.subs, id)
+	delete(d.created, id)
+	if err := d.save(); err != nil {
+		d.subs[id] = s
+		d.created[id] = true
+		return err
+	}
+	return nil
+}
+
+// savedSubscription 是 Persist 文件中的订阅，包含签名所需的密钥
+type savedSubscription struct {
+	Subscription
+	Secret string `json:"secret"`
+}
+
+// Persist 加载 path 中通过 API 创建的订阅，之后 Create 和 Remove 的结果写入
+// 该文件。文件包含订阅的密钥，只对所有者可读写。
+func (d *Dispatcher) Persist(path string) error {
+	var saved []savedSubscription
+	if err := statefile.Load(path, &saved); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range saved {
+		if _, ok := d.subs[s.ID]; ok || s.Secret == "" {
+			continue
+		}
+		s.Subscription.Secret = s.Secret
+		d.subs[s.ID] = s.Subscription
+		d.created[s.ID] = true
+	}
+	d.path = path
+	return nil
+}
+
+// save 写入 Persist 的文件，调用方持有 d.mu
+func (d *Dispatcher) save() error {
+	if d.path == "" {
+		return nil
+	}
+	saved := make([]savedSubscription, 0, len(d.created))
+	for id := range d.created {
+		saved = append(saved, savedSubscription{Subscription: d.subs[id], Secret: d.subs[id].Secret})
+	}
+	sort.Slice(saved, func(a, b int) bool { return saved[a].ID < saved[b].ID })
+	return statefile.Save(d.path, saved)
+}
+
+// Subscriptions 返回组织的订阅，orgID 为空时返回全部订阅
+func (d *Dispatcher) Subscriptions(orgID string) []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Subscription, 0, len(d.subs))
+	for _, s := range d.subs {
+		if orgID != "" && s.OrgID != orgID {
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out
+}
+
+// Deliveries 返回投递记录，orgID、subscriptionID 或 status 为空时不过滤
+func (d *Dispatcher) Deliveries(orgID, subscriptionID string, status DeliveryStatus) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Delivery, 0)
+	for _, dl := range d.deliveries {
+		if orgID != "" && d.subs[dl.SubscriptionID].OrgID != orgID {
+			continue
+		}
+		if subscriptionID != "" && dl.SubscriptionID != subscriptionID {
+			continue
+		}
+		if status != "" && dl.Status != status {
+			continue
+		}
+		c := *dl
+		c.Attempts = append([]Attempt(nil), dl.Attempts...)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out
+}
+
+// Retry 重新投递一条死信，orgID 非空时只能重试该组织的投递
+func (d *Dispatcher) Retry(orgID, deliveryID string) error {
+	d.mu.Lock()
+	dl, ok := d.deliveries[deliveryID]
+	if !ok {
+		d.mu.Unlock()
+		return ErrNotFound
+	}
+	if dl.Status != DeliveryDead {
+		d.mu.Unlock()
+		return ErrNotDead
+	}
+	sub, ok := d.subs[dl.SubscriptionID]
+	if !ok || (orgID != "" && sub.OrgID != orgID) {
+		d.mu.Unlock()
+		return ErrNotFound
+	}
+	dl.Status = DeliveryPending
+	d.dead = remove(d.dead, dl.ID)
+	d.mu.Unlock()
+
+	d.deliver(sub, dl)
+	return nil
+}
+
+// Run 订阅总线并投递事件，直到 ctx 被取消
+func (d *Dispatcher) Run(ctx context.Context, bus *events.Bus) {
+	d.mu.Lock()
+	d.ctx = ctx
+	d.mu.Unlock()
+
+	// 只投递启动之后的事件；被总线断开（处理太慢）时从 lastID 补发
+	lastID := bus.LastID()
+	for {
+		replay, ch, cancel := bus.Subscribe(lastID, nil)
+		for _, e := range replay {
+			d.dispatch(e)
+			lastID = e.ID
+		}
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				cancel()
+				d.wg.Wait()
+				return
+			case e, ok := <-ch:
+				if !ok {
+					open = false
+					break
+				}
+				d.dispatch(e)
+				lastID = e.ID
+			}
+		}
+		cancel()
+	}
+}
+
+func (d *Dispatcher) dispatch(e events.Event) {
+	if e.Type == events.StreamReset {
+		r, _ := e.Data.(events.Reset)
+		log.Printf("Warning: webhook dispatcher fell behind, events %d to %d not delivered", r.LastEventID+1, r.OldestID-1)
+		return
+	}
+	for _, sub := range d.Subscriptions("") {
+		if !sub.matches(e) {
+			continue
+		}
+		d.mu.Lock()
+		dl := &Delivery{
+			ID:             d.nextID("dlv_"),
+			SubscriptionID: sub.ID,
+			EventID:        e.ID,
+			EventType:      e.Type,
+			Status:         DeliveryPending,
+		}
+		d.deliveries[dl.ID] = dl
+		d.mu.Unlock()
+
+		body, err := json.Marshal(Payload{
+			DeliveryID: dl.ID,
+			EventID:    e.ID,
+			Event:      e.Type,
+			Time:       e.Time,
+			Data:       e.Data,
+		})
+		if err != nil {
+			d.mu.Lock()
+			dl.Attempts = append(dl.Attempts, Attempt{At: now(), Error: err.Error()})
+			d.finish(dl, DeliveryDead)
+			d.mu.Unlock()
+			continue
+		}
+		d.mu.Lock()
+		dl.payload = body
+		d.mu.Unlock()
+		d.deliver(sub, dl)
+	}
+}
+
+// deliver 在后台投递，失败后按指数退避重试
+func (d *Dispatcher) deliver(sub Subscription, dl *Delivery) {
+	d.mu.Lock()
+	ctx := d.ctx
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		wait := d.Backoff
+		for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+			a := d.post(ctx, sub, dl)
+			d.mu.Lock()
+			dl.Attempts = append(dl.Attempts, a)
+			success := a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+			switch {
+			case success:
+				d.finish(dl, DeliveryDelivered)
+			case attempt == d.MaxAttempts:
+				d.finish(dl, DeliveryDead)
+			default:
+				dl.NextAttemptAt = time.Now().Add(wait).UTC().Format(time.RFC3339)
+			}
+			d.mu.Unlock()
+			if success || attempt == d.MaxAttempts {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			wait *= 2
+			if wait > d.MaxBackoff {
+				wait = d.MaxBackoff
+			}
+		}
+	}()
+}
+
+// finish 结束一次投递，并按 MaxDelivered 和 MaxDead 丢弃最早的记录。调用方持有 d.mu。
+func (d *Dispatcher) finish(dl *Delivery, status DeliveryStatus) {
+	dl.Status = status
+	dl.NextAttemptAt = ""
+	if status == DeliveryDelivered {
+		dl.payload = nil
+		d.delivered = d.evict(append(d.delivered, dl.ID), d.MaxDelivered)
+		return
+	}
+	d.dead = d.evict(append(d.dead, dl.ID), d.MaxDead)
+}
+
+// evict 删除 list 中超出 max 的最早记录，返回剩余的 ID
+func (d *Dispatcher) evict(list []string, max int) []string {
+	n := len(list) - max
+	if n <= 0 {
+		return list
+	}
+	for _, id := range list[:n] {
+		delete(d.deliveries, id)
+	}
+	return append(list[:0], list[n:]...)
+}
+
+func remove(list []string, id string) []string {
+	for i, v := range list {
+		if v == id {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+func (d *Dispatcher) post(ctx context.Context, sub Subscription, dl *Delivery) Attempt {
+	start := time.Now()
+	a := Attempt{At: now()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(dl.payload))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SnapReport-Webhook/1.0")
+	req.Header.Set(HeaderEvent, dl.EventType)
+	req.Header.Set(HeaderDelivery, dl.ID)
+	ts := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, ts, dl.payload))
+	resp, err := d.Client.Do(req)
+	a.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	a.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		a.Error = "unexpected status " + strconv.Itoa(resp.StatusCode)
+	}
+	return a
+}
+
+// nextID 生成订阅或投递 ID
+func (d *Dispatcher) nextID(prefix string) string {
+	return ids.New(prefix)
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,312 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"SnapReport/internal/events"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	failures int // 前 failures 次请求返回 500
+	bodies   [][]byte
+	headers  []http.Header
+	calls    int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.calls <= r.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.bodies = append(r.bodies, body)
+	r.headers = append(r.headers, req.Header.Clone())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func startDispatcher(t *testing.T, maxAttempts int) (*Dispatcher, *events.Bus) {
+	t.Helper()
+	bus := events.NewBus(100)
+	d := NewDispatcher(maxAttempts, 5*time.Millisecond)
+	// 测试接收方监听在 127.0.0.1
+	d.AllowPrivate = true
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go d.Run(ctx, bus)
+	// 等待 Run 订阅总线
+	time.Sleep(10 * time.Millisecond)
+	return d, bus
+}
+
+func waitStatus(t *testing.T, d *Dispatcher, status DeliveryStatus, n int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := d.Deliveries("", "", status); len(got) == n {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d %s deliveries, got %+v", n, status, d.Deliveries("", "", ""))
+	return nil
+}
+
+func TestDeliverSignedPayload(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	d, bus := startDispatcher(t, 3)
+	sub, err := d.Add("", srv.URL, []string{events.ReportCreated}, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.JobProgress, "org", "dev1", "ignored")
+	bus.Publish(events.ReportCreated, "org", "dev1", map[string]string{"id": "rep_1"})
+
+	got := waitStatus(t, d, DeliveryDelivered, 1)
+	if got[0].SubscriptionID != sub.ID || got[0].EventType != events.ReportCreated || len(got[0].Attempts) != 1 {
+		t.Fatalf("unexpected delivery %+v", got[0])
+	}
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	if len(rcv.bodies) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(rcv.bodies))
+	}
+	body, h := rcv.bodies[0], rcv.headers[0]
+	ts, sig := h.Get(HeaderTimestamp), h.Get(HeaderSignature)
+	if !Verify("s3cret", ts, body, sig, time.Minute) {
+		t.Fatalf("signature %q does not verify", sig)
+	}
+	if Verify("wrong", ts, body, sig, time.Minute) {
+		t.Fatalf("signature verified with wrong secret")
+	}
+	// 重放的旧请求即使签名正确也被拒绝
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if Verify("s3cret", old, body, Sign("s3cret", old, body), time.Minute) {
+		t.Fatalf("stale timestamp accepted")
+	}
+	if Verify("s3cret", old, body, sig, time.Hour*2) {
+		t.Fatalf("signature verified with another timestamp")
+	}
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Event != events.ReportCreated || p.DeliveryID != got[0].ID || h.Get(HeaderEvent) != events.ReportCreated {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	rcv := &receiver{failures: 2}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	d, bus := startDispatcher(t, 5)
+	if _, err := d.Add("", srv.URL, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.ReportStatusChanged, "org", "dev1", nil)
+
+	got := waitStatus(t, d, DeliveryDelivered, 1)
+	a := got[0].Attempts
+	if len(a) != 3 || a[0].StatusCode != 500 || a[1].StatusCode != 500 || a[2].StatusCode != 204 {
+		t.Fatalf("unexpected attempts %+v", a)
+	}
+}
+
+func TestDeadLetterAndRetry(t *testing.T) {
+	rcv := &receiver{failures: 3}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	d, bus := startDispatcher(t, 3)
+	if _, err := d.Add("", srv.URL, []string{"*"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.ReportCreated, "org", "dev1", nil)
+
+	dead := waitStatus(t, d, DeliveryDead, 1)
+	if len(dead[0].Attempts) != 3 {
+		t.Fatalf("dead after %d attempts, want 3", len(dead[0].Attempts))
+	}
+	if err := d.Retry("", dead[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, d, DeliveryDelivered, 1)
+	if err := d.Retry("", dead[0].ID); err != ErrNotDead {
+		t.Fatalf("retry of delivered delivery: %v", err)
+	}
+}
+
+func TestDeliveryHistoryIsBounded(t *testing.T) {
+	ok := httptest.NewServer(&receiver{})
+	defer ok.Close()
+	failing := httptest.NewServer(&receiver{failures: 1 << 30})
+	defer failing.Close()
+
+	d, bus := startDispatcher(t, 1)
+	d.MaxDelivered, d.MaxDead = 2, 3
+	first := bus.LastID() + 1
+	for _, u := range []string{ok.URL, failing.URL} {
+		if _, err := d.Add("", u, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 逐个发布，等两个订阅都投递完成，保证完成顺序与事件顺序一致
+	for i := 0; i < 5; i++ {
+		bus.Publish(events.ReportCreated, "org", "dev1", i)
+		id := bus.LastID()
+		deadline := time.Now().Add(2 * time.Second)
+		for finished := 0; finished < 2; {
+			if time.Now().After(deadline) {
+				t.Fatalf("event %d not delivered: %+v", id, d.Deliveries("", "", ""))
+			}
+			time.Sleep(time.Millisecond)
+			finished = 0
+			for _, dl := range d.Deliveries("", "", "") {
+				if dl.EventID == id && dl.Status != DeliveryPending {
+					finished++
+				}
+			}
+		}
+	}
+
+	delivered := waitStatus(t, d, DeliveryDelivered, 2)
+	dead := waitStatus(t, d, DeliveryDead, 3)
+	if delivered[0].EventID != first+3 || dead[0].EventID != first+2 {
+		t.Fatalf("oldest records kept: %+v %+v", delivered, dead)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n := len(d.deliveries); n != 5 {
+		t.Fatalf("%d deliveries in memory, want 5", n)
+	}
+	for _, dl := range d.deliveries {
+		if (dl.Status == DeliveryDelivered) != (dl.payload == nil) {
+			t.Fatalf("delivery %s: status %s, payload kept %v", dl.ID, dl.Status, dl.payload != nil)
+		}
+	}
+}
+
+func TestPersistCreatedSubscriptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	open := func() *Dispatcher {
+		d := NewDispatcher(1, time.Millisecond)
+		if _, err := d.Add("", "https://example.com/config", nil, "config-secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Persist(path); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	d := open()
+	kept, err := d.Create("fleet-a", "https://example.com/a", []string{events.ReportCreated}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := d.Create("", "https://example.com/b", nil, "b-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Remove("", removed.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range d.Subscriptions("") {
+		if s.URL == "https://example.com/config" {
+			if err := d.Remove("", s.ID); !errors.Is(err, ErrConfigured) {
+				t.Fatalf("removing a configured subscription: %v", err)
+			}
+		}
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("state file: %v, %v", fi, err)
+	}
+
+	subs := open().Subscriptions("fleet-a")
+	if len(subs) != 1 || subs[0].ID != kept.ID || subs[0].Secret != kept.Secret || subs[0].Events[0] != events.ReportCreated {
+		t.Fatalf("subscriptions not restored: %+v", subs)
+	}
+	if n := len(open().Subscriptions("")); n != 2 {
+		t.Fatalf("%d subscriptions after restart, want 2", n)
+	}
+}
+
+func TestAddValidates(t *testing.T) {
+	d := NewDispatcher(1, time.Millisecond)
+	sub, err := d.Add("", "https://example.com/hook", nil, "")
+	if err != nil || !strings.HasPrefix(sub.Secret, SecretPrefix) {
+		t.Fatalf("secret not generated: %+v, %v", sub, err)
+	}
+	if _, err := d.Add("", "ftp://example.com", nil, ""); err != ErrInvalidURL {
+		t.Fatalf("expected invalid url, got %v", err)
+	}
+	if _, err := d.Add("", "https://example.com/hook", []string{"report.archived"}, ""); err == nil {
+		t.Fatalf("expected invalid event error")
+	}
+}
+
+func TestPrivateAddressesRejected(t *testing.T) {
+	d := NewDispatcher(1, time.Millisecond)
+	for _, u := range []string{"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://169.254.169.254/latest", "https://10.0.0.5/hook", "http://[::1]/hook", "http://100.64.1.1/hook"} {
+		if _, err := d.Create("fleet-a", u, nil, ""); !errors.Is(err, ErrPrivateAddress) {
+			t.Fatalf("%s: expected private address error, got %v", u, err)
+		}
+	}
+
+	// 添加时放行的订阅在连接时仍被拒绝
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+	d.AllowPrivate = true
+	sub, err := d.Create("", srv.URL, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.AllowPrivate = false
+	at := d.post(context.Background(), sub, &Delivery{ID: "whd_test", payload: []byte("{}")})
+	if !strings.Contains(at.Error, ErrPrivateAddress.Error()) || len(rcv.bodies) != 0 {
+		t.Fatalf("delivery to a private address not blocked: %+v", at)
+	}
+}
+
+func TestOrgSubscriptionOnlyReceivesOwnEvents(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	d, bus := startDispatcher(t, 1)
+	if _, err := d.Add("fleet-a", srv.URL, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.ReportCreated, "fleet-b", "dev1", nil)
+	bus.Publish(events.ReportCreated, "fleet-a", "dev1", nil)
+
+	got := waitStatus(t, d, DeliveryDelivered, 1)
+	if got[0].EventID != bus.LastID() {
+		t.Fatalf("delivered event %d, want fleet-a event %d", got[0].EventID, bus.LastID())
+	}
+	if n := len(d.Deliveries("fleet-b", "", "")); n != 0 {
+		t.Fatalf("fleet-b sees %d deliveries", n)
+	}
+}
@@ -1,19 +1,59 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"os"
+	"strings"
 
-	"SnapReport/internal/api"
 	"SnapReport/internal/config"
-	"SnapReport/internal/ddpai"
-	"SnapReport/internal/geo"
-	"SnapReport/internal/service"
-	"SnapReport/internal/store"
+)
+
+// configFile 是 --config 指定的配置文件，默认为 SNAPREPORT_CONFIG 或 config.yaml
+type configFile struct {
+	path     string
+	explicit bool // 显式指定的文件必须存在
+}
+
+func (c *configFile) String() string { return c.path }
+
+func (c *configFile) Set(v string) error {
+	c.path, c.explicit = v, true
+	return nil
+}
+
+// overrides 收集 --set key=value 参数
+type overrides []string
 
-	"github.com/gin-gonic/gin"
+func (o *overrides) String() string { return strings.Join(*o, ",") }
+
+func (o *overrides) Set(v string) error {
+	*o = append(*o, v)
+	return nil
+}
+
+var (
+	configPath = configFile{path: "config.yaml"}
+	configSet  overrides
 )
 
+// configFlags 在 fs 上注册 --config 和 --set，它们也可以写在命令名之前
+func configFlags(fs *flag.FlagSet) {
+	fs.Var(&configPath, "config", "配置文件，默认为 $SNAPREPORT_CONFIG 或 config.yaml")
+	fs.Var(&configSet, "set", "覆盖配置项，如 --set server.port=9090，可重复")
+}
+
+// loadConfig 按 默认值 < 配置文件 < SNAPREPORT_* 环境变量 < --set 的顺序加载配置
+func loadConfig() (*config.Config, error) {
+	return config.LoadFrom(config.Sources{
+		Path:      configPath.path,
+		MustExist: configPath.explicit,
+		Env:       os.Environ(),
+		Overrides: configSet,
+	})
+}
+
 // maskAPIKey 隐藏API密钥的中间部分，仅显示首尾字符
 func maskAPIKey(key string) string {
 	if len(key) <= 8 {
@@ -22,50 +62,81 @@ func maskAPIKey(key string) string {
 	return key[:4] + "***" + key[len(key)-4:]
 }
 
-func main() {
-	// 1. Load Config
-	cfg, err := config.Load("config.yaml")
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
-	}
+const usage = `Usage: SnapReport [--config FILE] [--set key=value]... <command> [flags]
 
-	// 2. Initialize Dependencies
-	memStore := store.NewMemoryStore()
+服务:
+  serve            启动 HTTP 服务（不带命令时的默认行为）
 
-	// 根据配置选择地理编码器
-	var geocoder geo.Geocoder
-	switch cfg.Geocoder.Type {
-	case "amap":
-		if cfg.Geocoder.APIKey == "" {
-			log.Fatal("AMap geocoder requires API key. Please set geocoder.api_key in config.yaml")
-		}
-		geocoder = geo.NewAMapGeocoder(cfg.Geocoder.APIKey)
-		log.Printf("Using AMap geocoder with API key: %s", maskAPIKey(cfg.Geocoder.APIKey))
-	default: // "nominatim" 或未指定
-		geocoder = geo.NewNominatimGeocoder(cfg.Geocoder.UserAgent)
-		log.Printf("Using Nominatim geocoder with user agent: %s", cfg.Geocoder.UserAgent)
-	}
+客户端命令，通过 HTTP API 访问运行中的服务:
+  prepare          抓取视频并创建报告
+  send ID          提交报告
+  list             列出报告
+  export           导出报告（csv、xlsx、geojson、kml）
+  import FILE      从 CSV 或 JSON Lines 文件批量导入报告
 
-	ddpaiClient := ddpai.NewClient(
-		cfg.DDPai.BaseURL,
-		cfg.DDPai.TimeoutSeconds,
-		cfg.DDPai.MockMode,
-	)
+管理命令，直接读取配置和存储:
+  devices status   检查行车记录仪是否可用
+  config validate  校验配置文件
+  migrate          将旧版本保存的报告升级到当前格式
 
-	// 3. Initialize Service
-	svc := service.NewReportService(memStore, geocoder, ddpaiClient)
+运行 "SnapReport <command> -h" 查看命令的参数。--config 和 --set 对所有命令有效，
+配置项也可以用 SNAPREPORT_<YAML 路径> 环境变量覆盖，详见 README。
+`
 
-	// 4. Initialize Handler
-	handler := api.NewHandler(svc)
-
-	// 5. Setup Gin Router
-	router := gin.Default()
-	handler.RegisterGinRoutes(router)
+func main() {
+	if p := os.Getenv("SNAPREPORT_CONFIG"); p != "" {
+		configPath = configFile{path: p, explicit: true}
+	}
+	global := flag.NewFlagSet("SnapReport", flag.ContinueOnError)
+	configFlags(global)
+	global.Usage = func() { fmt.Fprint(global.Output(), usage) }
+	if err := global.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+	if global.NArg() == 0 {
+		os.Exit(runServe(nil))
+	}
+	cmd, args := global.Arg(0), global.Args()[1:]
+	var run func([]string) int
+	switch cmd {
+	case "serve":
+		run = runServe
+	case "prepare":
+		run = runPrepare
+	case "send":
+		run = runSend
+	case "list":
+		run = runList
+	case "export":
+		run = runExport
+	case "import":
+		run = runImport
+	case "devices":
+		run = subcommand("devices", map[string]func([]string) int{"status": runDevicesStatus})
+	case "config":
+		run = subcommand("config", map[string]func([]string) int{"validate": runConfigValidate})
+	case "migrate":
+		run = runMigrate
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	os.Exit(run(args))
+}
 
-	// 6. Start Server
-	addr := fmt.Sprintf(":%d", cfg.Server.Port)
-	log.Printf("SnapReport backend listening on %s", addr)
-	if err := router.Run(addr); err != nil {
-		log.Fatal(err)
+// subcommand 返回分派 "<name> <sub>" 形式命令的函数
+func subcommand(name string, subs map[string]func([]string) int) func([]string) int {
+	return func(args []string) int {
+		if len(args) == 0 || subs[args[0]] == nil {
+			fmt.Fprintf(os.Stderr, "usage: SnapReport %s <subcommand>, see SnapReport help\n", name)
+			return 2
+		}
+		return subs[args[0]](args[1:])
 	}
 }
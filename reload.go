@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"SnapReport/internal/config"
+	"SnapReport/internal/service"
+)
+
+// reloader 在配置文件变化或收到 SIGHUP 时重新加载配置。新配置必须通过校验，
+// 只有全局地理编码器、设备设置和组织在运行时生效，其他变化记录为需要重启。
+type reloader struct {
+	svc *service.ReportService
+
+	mu  sync.Mutex
+	cfg *config.Config // 最近一次接受的配置
+	// sum 是配置文件内容的哈希，只由 run 读写
+	sum [sha256.Size]byte
+}
+
+// reloadablePrefixes 是可以在运行时生效的配置项
+var reloadablePrefixes = []string{"geocoder.", "ddpai.", "orgs"}
+
+func reloadable(path string) bool {
+	for _, p := range reloadablePrefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func newReloader(cfg *config.Config, svc *service.ReportService) *reloader {
+	r := &reloader{svc: svc, cfg: cfg}
+	r.sum, _ = fileSum(configPath.path)
+	return r
+}
+
+// run 处理 SIGHUP，并按 server.reload_interval_seconds 检查配置文件，直到 ctx 结束
+func (r *reloader) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if n := r.cfg.Server.ReloadIntervalSeconds; n > 0 {
+		t := time.NewTicker(time.Duration(n) * time.Second)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.sum, _ = fileSum(configPath.path)
+			r.reload("SIGHUP")
+		case <-tick:
+			// 按内容判断，只修改时间的变化不触发重新加载
+			sum, err := fileSum(configPath.path)
+			if err != nil || sum == r.sum {
+				continue
+			}
+			r.sum = sum
+			r.reload(configPath.path + " changed")
+		}
+	}
+}
+
+// reload 重新加载配置，校验失败时保留正在使用的配置
+func (r *reloader) reload(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := loadConfig()
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		log.Printf("Config reload (%s) rejected, keeping the running configuration: %v", reason, err)
+		return
+	}
+	changes := config.Diff(r.cfg, next)
+	if len(changes) == 0 {
+		log.Printf("Config reload (%s): no changes", reason)
+		return
+	}
+	if err := r.apply(next); err != nil {
+		log.Printf("Config reload (%s) rejected, keeping the running configuration: %v", reason, err)
+		return
+	}
+	log.Printf("Config reload (%s): %d change(s)", reason, len(changes))
+	for _, c := range changes {
+		if reloadable(c.Path) {
+			log.Printf("  %s", c)
+		} else {
+			log.Printf("  %s (not applied, restart required)", c)
+		}
+	}
+	r.cfg = next
+}
+
+// apply 先构造新配置的地理编码器和设备客户端并校验全部组织，全部成功后再替换，
+// 任一步失败时正在使用的配置保持不变
+func (r *reloader) apply(next *config.Config) error {
+	geocoder, err := newGeocoder(next)
+	if err != nil {
+		return err
+	}
+	orgs := configOrgs(next)
+	if err := r.svc.Tenants.PutAll(orgs); err != nil {
+		return err
+	}
+	r.svc.Reconfigure(service.Settings{
+		Geocoder: geocoder,
+		DDPai:    newDDPaiClient(next, r.svc.Metrics),
+		Timeouts: newTimeouts(next),
+	})
+
+	kept := map[string]bool{}
+	for _, o := range orgs {
+		kept[o.ID] = true
+	}
+	// 报告可能仍引用被删除的组织，它们在重启前保持可用
+	for _, o := range r.cfg.Orgs {
+		if !kept[o.ID] {
+			log.Printf("Config reload: org %s removed from config, it stays active until restart", o.ID)
+		}
+	}
+	return nil
+}
+
+func fileSum(path string) ([sha256.Size]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"SnapReport/internal/api"
+	"SnapReport/internal/audit"
+	"SnapReport/internal/config"
+	"SnapReport/internal/ids"
+	"SnapReport/internal/job"
+	"SnapReport/internal/service"
+	"SnapReport/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runServe 实现 "SnapReport serve"：启动 HTTP 服务和后台任务，收到 SIGINT 或
+// SIGTERM 后排空进行中的工作再退出
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: SnapReport serve [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// 1. Load Config
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("%v\nRun \"SnapReport config validate\" to check the configuration", err)
+	}
+
+	// ctx 在排空结束后取消，停止异步任务；bg 中的后台循环在排空任务之后停止
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	bg := newBackground()
+	defer bg.cancel()
+
+	// 2. Initialize Dependencies
+	if cfg.Server.Node != nil {
+		ids.SetNode(*cfg.Server.Node)
+	}
+	reports, err := openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open report store: %v", err)
+	}
+
+	// 3. Initialize Service
+	svc, err := newService(cfg, reports)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bg.Go(newReloader(cfg, svc).run)
+	if cfg.Retention.AuditFile != "" {
+		if svc.Audit, err = audit.Open(cfg.Retention.AuditFile); err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+	} else {
+		svc.Audit = audit.NewMemory()
+	}
+
+	jobStore, err := job.NewFileStore(cfg.Jobs.Dir)
+	if err != nil {
+		log.Fatalf("Failed to open job store: %v", err)
+	}
+	jobs := svc.EnableJobs(jobStore, cfg.Jobs.Workers)
+	jobs.Start(ctx)
+	if cfg.Jobs.TTLHours > 0 {
+		ttl := time.Duration(cfg.Jobs.TTLHours) * time.Hour
+		bg.Go(func(ctx context.Context) { jobs.RunPruner(ctx, min(ttl, time.Hour), ttl) })
+	}
+	if cfg.Storage.Reconcile.IntervalMinutes > 0 {
+		opts := service.ReconcileOptions{
+			Grace:         time.Duration(cfg.Storage.Reconcile.GraceMinutes) * time.Minute,
+			DeleteOrphans: cfg.Storage.Reconcile.DeleteOrphans,
+		}
+		bg.Go(func(ctx context.Context) {
+			svc.RunReconciler(ctx, time.Duration(cfg.Storage.Reconcile.IntervalMinutes)*time.Minute, opts)
+		})
+	}
+
+	if cfg.Retention.IntervalMinutes > 0 && len(svc.Retention) > 0 {
+		bg.Go(func(ctx context.Context) {
+			svc.RunRetention(ctx, time.Duration(cfg.Retention.IntervalMinutes)*time.Minute, cfg.Retention.DryRun)
+		})
+	}
+
+	// 4. Initialize Handler
+	handler, dispatcher, err := newHandler(cfg, svc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bg.Go(func(ctx context.Context) { dispatcher.Run(ctx, svc.Events) })
+	if !cfg.Auth.Enabled {
+		log.Printf("Warning: authentication disabled, all reports are visible to anyone who can reach the server")
+	}
+
+	// 5. Setup Gin Router
+	router := gin.Default()
+	handler.RegisterGinRoutes(router)
+
+	// 6. Start Server
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Server.Port), Handler: router}
+	srv.RegisterOnShutdown(handler.CloseStreams)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	log.Printf("SnapReport backend listening on %s", srv.Addr)
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case s := <-sig:
+		log.Printf("Received %s, shutting down (send again to exit immediately)", s)
+	}
+	go func() {
+		<-sig
+		log.Fatal("Received second signal, exiting without draining")
+	}()
+	code := drain(cfg, srv, handler, svc, bg)
+	stop()
+	if n := len(dispatcher.Deliveries("", "", webhook.DeliveryPending)); n > 0 {
+		log.Printf("Warning: %d pending webhook deliveries dropped (deliveries are kept in memory only)", n)
+	}
+
+	// 7. Flush Stores
+	if err := closeStore(reports); err != nil {
+		log.Printf("Warning: flush report store: %v", err)
+		code = 1
+	}
+	if err := svc.Audit.Close(); err != nil {
+		log.Printf("Warning: close audit log: %v", err)
+		code = 1
+	}
+	log.Printf("Shutdown complete")
+	return code
+}
+
+// drain 先在 server.shutdown_delay_seconds 内报告未就绪，再在
+// server.shutdown_timeout_seconds 内依次排空 HTTP 请求和异步任务，最后停止
+// 后台循环（保留策略、对账、Webhook 投递和配置重新加载）。期限内未完成时
+// 返回 1，被中断的任务在下次启动时继续。
+func drain(cfg *config.Config, srv *http.Server, handler *api.Handler, svc *service.ReportService, bg *background) int {
+	handler.Drain()
+	if d := cfg.Server.ShutdownDelaySeconds; d > 0 {
+		log.Printf("Reporting not ready for %ds before draining", d)
+		time.Sleep(time.Duration(d) * time.Second)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+	code := 0
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Warning: in-flight requests not finished: %v", err)
+		srv.Close()
+		code = 1
+	}
+	if err := svc.Jobs.Drain(ctx); err != nil {
+		log.Printf("Warning: prepare jobs interrupted, they resume on next start: %v", err)
+		code = 1
+	}
+	if err := bg.stop(ctx); err != nil {
+		log.Printf("Warning: background tasks not finished: %v", err)
+		code = 1
+	}
+	return code
+}
+
+// background 跟踪后台循环，关闭时取消并等待它们退出
+type background struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newBackground() *background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &background{ctx: ctx, cancel: cancel}
+}
+
+// Go 在后台运行 f，f 应在 ctx 结束后返回
+func (b *background) Go(f func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		f(b.ctx)
+	}()
+}
+
+// stop 取消后台循环并等待它们退出，wait 结束时不再等待
+func (b *background) stop(wait context.Context) error {
+	b.cancel()
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-wait.Done():
+		return wait.Err()
+	}
+}
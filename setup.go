@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"time"
+
+	"SnapReport/internal/api"
+	"SnapReport/internal/auth"
+	"SnapReport/internal/blob"
+	"SnapReport/internal/config"
+	"SnapReport/internal/dashboard"
+	"SnapReport/internal/ddpai"
+	"SnapReport/internal/events"
+	"SnapReport/internal/geo"
+	"SnapReport/internal/idempotency"
+	"SnapReport/internal/metrics"
+	"SnapReport/internal/service"
+	"SnapReport/internal/store"
+	"SnapReport/internal/tenant"
+	"SnapReport/internal/violation"
+	"SnapReport/internal/webhook"
+)
+
+// 以下函数根据配置构造服务的各个部分，serve、config validate 和管理命令
+// 共用。除 openStore 外它们不创建文件（store.state_dir 中的文件只读取），
+// 也不启动后台任务。
+
+// openStore 打开配置的报告存储
+func openStore(cfg *config.Config) (store.Store, error) {
+	switch cfg.Store.Type {
+	case "file", "":
+		return store.NewFileStore(cfg.Store.Dir)
+	case "memory":
+		return store.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store.type %q", cfg.Store.Type)
+	}
+}
+
+// closeStore 将文件存储中已保存的报告同步到磁盘，内存存储不需要关闭
+func closeStore(s store.Store) error {
+	if c, ok := s.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// newGeocoder 根据配置选择地理编码器
+func newGeocoder(cfg *config.Config) (geo.Geocoder, error) {
+	g, err := geo.New(cfg.Geocoder.Type, cfg.Geocoder.APIKey, cfg.Geocoder.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Geocoder.Type == "amap" {
+		log.Printf("Using AMap geocoder with API key: %s", maskAPIKey(cfg.Geocoder.APIKey))
+	} else {
+		log.Printf("Using Nominatim geocoder with user agent: %s", cfg.Geocoder.UserAgent)
+	}
+	return g, nil
+}
+
+// newDDPaiClient 返回行车记录仪客户端，m 可为 nil
+func newDDPaiClient(cfg *config.Config, m *metrics.Metrics) *ddpai.Client {
+	c := ddpai.NewClient(cfg.DDPai.BaseURL, cfg.DDPai.TimeoutSeconds, cfg.DDPai.MockMode)
+	c.Metrics = m
+	return c
+}
+
+// newTimeouts 返回 Prepare 各阶段的期限
+func newTimeouts(cfg *config.Config) service.Timeouts {
+	return service.Timeouts{
+		Geocode:  time.Duration(cfg.Geocoder.TimeoutSeconds) * time.Second,
+		Capture:  time.Duration(cfg.DDPai.CaptureTimeoutSeconds) * time.Second,
+		Download: time.Duration(cfg.DDPai.DownloadTimeoutSeconds) * time.Second,
+	}
+}
+
+// configOrgs 返回配置文件中的组织
+func configOrgs(cfg *config.Config) []tenant.Org {
+	orgs := make([]tenant.Org, 0, len(cfg.Orgs))
+	for _, o := range cfg.Orgs {
+		orgs = append(orgs, tenant.Org{
+			ID:   o.ID,
+			Name: o.Name,
+			Geocoder: tenant.GeocoderConfig{
+				Type:      o.Geocoder.Type,
+				UserAgent: o.Geocoder.UserAgent,
+				APIKey:    o.Geocoder.APIKey,
+			},
+			Submitter: tenant.SubmitterConfig{
+				Name:  o.Submitter.Name,
+				Phone: o.Submitter.Phone,
+				Email: o.Submitter.Email,
+			},
+		})
+	}
+	return orgs
+}
+
+// newBlobStore 返回配置的媒体存储
+func newBlobStore(cfg *config.Config) (blob.Store, error) {
+	switch cfg.Storage.Type {
+	case "s3":
+		s3, err := blob.NewS3(blob.S3Config{
+			Endpoint:        cfg.Storage.S3.Endpoint,
+			Region:          cfg.Storage.S3.Region,
+			Bucket:          cfg.Storage.S3.Bucket,
+			AccessKeyID:     cfg.Storage.S3.AccessKeyID,
+			SecretAccessKey: cfg.Storage.S3.SecretAccessKey,
+			PathStyle:       cfg.Storage.S3.PathStyle,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid storage.s3: %w", err)
+		}
+		log.Printf("Using media storage %s", s3)
+		return s3, nil
+	case "local", "":
+		log.Printf("Using local media storage in %s", cfg.Storage.Local.Dir)
+		return blob.NewFS(cfg.Storage.Local.Dir, cfg.Storage.Local.BaseURL, []byte(cfg.Storage.Local.Secret)), nil
+	default:
+		return nil, fmt.Errorf("unknown storage.type %q", cfg.Storage.Type)
+	}
+}
+
+// newService 构造使用报告存储 st 的服务，不包括审计日志和异步任务
+func newService(cfg *config.Config, st store.Store) (*service.ReportService, error) {
+	geocoder, err := newGeocoder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var m *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		m = metrics.New()
+	}
+	svc := service.NewReportService(st, geocoder, newDDPaiClient(cfg, m))
+	svc.Metrics = m
+	m.ReportsByStatus(func() map[string]int {
+		counts := map[string]int{"prepared": 0, "submitted": 0}
+		for _, r := range svc.Store.List() {
+			counts[r.Status]++
+		}
+		return counts
+	})
+	svc.Timeouts = newTimeouts(cfg)
+	if len(cfg.ViolationTypes) > 0 {
+		if svc.Violations, err = violation.New(cfg.ViolationTypes); err != nil {
+			return nil, fmt.Errorf("invalid violation_types: %w", err)
+		}
+	}
+	svc.Dedup = service.DedupConfig{
+		Window:   time.Duration(cfg.Dedup.WindowSeconds) * time.Second,
+		Distance: cfg.Dedup.DistanceMeters,
+	}
+	svc.Events = events.NewBus(cfg.Events.LogSize)
+	// 未单独配置地理编码器的组织使用 svc.Geocoder，重新加载时只需替换一处
+	svc.Tenants = tenant.NewRegistry(nil)
+	for _, o := range configOrgs(cfg) {
+		if _, err := svc.Tenants.Put(o); err != nil {
+			return nil, fmt.Errorf("invalid org %q: %w", o.ID, err)
+		}
+	}
+	if dir := cfg.Store.StateDir; dir != "" {
+		if err := svc.Tenants.Persist(filepath.Join(dir, "orgs.json")); err != nil {
+			return nil, err
+		}
+	}
+	svc.Media = service.MediaConfig{
+		Dir:           cfg.Media.Dir,
+		FFmpegPath:    cfg.Media.FFmpegPath,
+		MaxImageBytes: int64(cfg.Media.MaxImageMB) << 20,
+		MaxVideoBytes: int64(cfg.Media.MaxVideoMB) << 20,
+		URLExpiry:     time.Duration(cfg.Storage.URLExpirySeconds) * time.Second,
+	}
+	if svc.Blobs, err = newBlobStore(cfg); err != nil {
+		return nil, err
+	}
+
+	for _, r := range cfg.Retention.Rules {
+		svc.Retention = append(svc.Retention, service.RetentionRule{
+			Name:   r.Name,
+			Status: r.Status,
+			MaxAge: time.Duration(r.AfterDays) * 24 * time.Hour,
+			Action: r.Action,
+		})
+	}
+	if err := service.ValidateRetentionRules(svc.Retention); err != nil {
+		return nil, fmt.Errorf("invalid retention: %w", err)
+	}
+	return svc, nil
+}
+
+// newHandler 构造 HTTP 处理器及其 webhook 分发器
+func newHandler(cfg *config.Config, svc *service.ReportService) (*api.Handler, *webhook.Dispatcher, error) {
+	dispatcher := webhook.NewDispatcher(cfg.Webhooks.MaxAttempts, time.Duration(cfg.Webhooks.BackoffSeconds)*time.Second)
+	dispatcher.AllowPrivate = cfg.Webhooks.AllowPrivateNetworks
+	for _, s := range cfg.Webhooks.Subscriptions {
+		sub, err := dispatcher.Add(s.OrgID, s.URL, s.Events, s.Secret)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid webhook %s: %w", s.URL, err)
+		}
+		log.Printf("Webhook %s -> %s %v", sub.ID, sub.URL, sub.Events)
+	}
+	if dir := cfg.Store.StateDir; dir != "" {
+		if err := dispatcher.Persist(filepath.Join(dir, "webhooks.json")); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	handler := api.NewHandler(svc)
+	handler.Webhooks = dispatcher
+	handler.Tenants = svc.Tenants
+	handler.Metrics = svc.Metrics
+	handler.ReconcileGrace = time.Duration(cfg.Storage.Reconcile.GraceMinutes) * time.Minute
+	if cfg.Idempotency.WindowSeconds > 0 {
+		handler.Idempotency = idempotency.New(time.Duration(cfg.Idempotency.WindowSeconds) * time.Second)
+	}
+	if cfg.Dashboard.Enabled {
+		handler.Dashboard = dashboard.Handler(dashboard.Config{
+			TilesURL:    cfg.Dashboard.TilesURL,
+			Attribution: cfg.Dashboard.Attribution,
+			Center:      cfg.Dashboard.Center,
+			Zoom:        cfg.Dashboard.Zoom,
+		})
+	}
+	handler.Auth = auth.NewRegistry(cfg.Auth.Enabled)
+	for _, u := range cfg.Auth.Users {
+		if u.OrgID != "" {
+			if _, ok := svc.Tenants.Get(u.OrgID); !ok {
+				return nil, nil, fmt.Errorf("auth user %q belongs to unknown org %q", u.ID, u.OrgID)
+			}
+		}
+		err := handler.Auth.Add(auth.User{
+			ID:      u.ID,
+			OrgID:   u.OrgID,
+			Name:    u.Name,
+			Role:    auth.Role(u.Role),
+			Devices: u.Devices,
+			KeyHash: u.APIKeySHA256,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid auth user %q: %w", u.ID, err)
+		}
+	}
+	if dir := cfg.Store.StateDir; dir != "" {
+		if err := handler.Auth.Persist(filepath.Join(dir, "users.json")); err != nil {
+			return nil, nil, err
+		}
+	}
+	svc.Metrics.KnownDevices(handler.Auth.HasDevice)
+	return handler, dispatcher, nil
+}